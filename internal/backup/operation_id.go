@@ -0,0 +1,123 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	biav2 "github.com/vmware-tanzu/velero/pkg/plugin/velero/backupitemaction/v2"
+)
+
+const (
+	// volumeSnapshotOperationIDPrefix starts the operation IDs of volumesnapshots, followed by the version of the
+	// encoding and the base64 encoded JSON operation. The "." can't be part of a namespace, so it tells the operation
+	// IDs apart from the legacy ones of the form <namespace>/<volumesnapshot-name>/<started-time>.
+	volumeSnapshotOperationIDPrefix  = "vs.v"
+	volumeSnapshotOperationIDVersion = 1
+)
+
+// volumeSnapshotOperation is the snapshot operation of a volumesnapshot, encoded in its operation ID.
+type volumeSnapshotOperation struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+	BackupUID types.UID `json:"backupUID,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+// newVolumeSnapshotOperationID returns the operation ID of the snapshot of the volumesnapshot, started now by the backup.
+func newVolumeSnapshotOperationID(vs *snapshotv1api.VolumeSnapshot, backup *velerov1api.Backup) (string, error) {
+	operation, err := json.Marshal(volumeSnapshotOperation{
+		Namespace: vs.Namespace,
+		Name:      vs.Name,
+		UID:       vs.UID,
+		BackupUID: backup.UID,
+		Started:   time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding operation ID")
+	}
+	return volumeSnapshotOperationIDPrefix + strconv.Itoa(volumeSnapshotOperationIDVersion) + "." + base64.RawURLEncoding.EncodeToString(operation), nil
+}
+
+// parseVolumeSnapshotOperationID returns the operation of the operation ID. The UIDs of the operations
+// of legacy operation IDs, of the form <namespace>/<volumesnapshot-name>/<started-time>, are empty.
+func parseVolumeSnapshotOperationID(operationID string, log logrus.FieldLogger) (*volumeSnapshotOperation, error) {
+	if operationID == "" {
+		return nil, biav2.InvalidOperationIDError(operationID)
+	}
+
+	if !strings.HasPrefix(operationID, volumeSnapshotOperationIDPrefix) {
+		operationIDParts := strings.Split(operationID, "/")
+		if len(operationIDParts) != 3 {
+			log.Errorf("invalid operation ID %s", operationID)
+			return nil, biav2.InvalidOperationIDError(operationID)
+		}
+		started, err := time.Parse(time.RFC3339, operationIDParts[2])
+		if err != nil {
+			log.Errorf("error parsing operation ID's StartedTime part into time %s: %s", operationID, err.Error())
+			return nil, errors.WithStack(err)
+		}
+		return &volumeSnapshotOperation{Namespace: operationIDParts[0], Name: operationIDParts[1], Started: started}, nil
+	}
+
+	version, encoded, found := strings.Cut(strings.TrimPrefix(operationID, volumeSnapshotOperationIDPrefix), ".")
+	if !found {
+		log.Errorf("invalid operation ID %s", operationID)
+		return nil, biav2.InvalidOperationIDError(operationID)
+	}
+	if version != strconv.Itoa(volumeSnapshotOperationIDVersion) {
+		return nil, errors.Errorf("version %s of operation ID %s is not supported, the latest supported version is %d", version, operationID, volumeSnapshotOperationIDVersion)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		log.Errorf("error decoding operation ID %s: %s", operationID, err.Error())
+		return nil, biav2.InvalidOperationIDError(operationID)
+	}
+	operation := &volumeSnapshotOperation{}
+	if err := json.Unmarshal(decoded, operation); err != nil {
+		log.Errorf("error decoding operation ID %s: %s", operationID, err.Error())
+		return nil, biav2.InvalidOperationIDError(operationID)
+	}
+	if operation.Namespace == "" || operation.Name == "" {
+		return nil, biav2.InvalidOperationIDError(operationID)
+	}
+	return operation, nil
+}
+
+// verify returns an error if the volumesnapshot or the backup is not the one the operation was started for,
+// e.g. because the volumesnapshot was re-created with the same name. The UIDs of legacy operations are not verified.
+func (o *volumeSnapshotOperation) verify(vs *snapshotv1api.VolumeSnapshot, backup *velerov1api.Backup) error {
+	if o.UID != "" && vs.UID != o.UID {
+		return errors.Errorf("volumesnapshot %s/%s has UID %s, not UID %s of the operation, it was re-created", vs.Namespace, vs.Name, vs.UID, o.UID)
+	}
+	if o.BackupUID != "" && backup.UID != "" && backup.UID != o.BackupUID {
+		return errors.Errorf("operation on volumesnapshot %s/%s was started by backup UID %s, not backup %s/%s with UID %s",
+			vs.Namespace, vs.Name, o.BackupUID, backup.Namespace, backup.Name, backup.UID)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	snapshotfake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestVolumeSnapshotOperationID(t *testing.T) {
+	vs := builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithUID("vs-uid")).Result()
+	backup := builder.ForBackup("velero", "backup").ObjectMeta(builder.WithUID("backup-uid")).Result()
+
+	operationID, err := newVolumeSnapshotOperationID(vs, backup)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(operationID, "vs.v1."))
+	assert.NotContains(t, operationID, "/")
+
+	operation, err := parseVolumeSnapshotOperationID(operationID, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, "ns", operation.Namespace)
+	assert.Equal(t, "vs", operation.Name)
+	assert.Equal(t, vs.UID, operation.UID)
+	assert.Equal(t, backup.UID, operation.BackupUID)
+	assert.WithinDuration(t, time.Now(), operation.Started, 2*time.Second)
+	assert.NoError(t, operation.verify(vs, backup))
+
+	recreated := builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithUID("other-uid")).Result()
+	assert.EqualError(t, operation.verify(recreated, backup), "volumesnapshot ns/vs has UID other-uid, not UID vs-uid of the operation, it was re-created")
+	otherBackup := builder.ForBackup("velero", "backup").ObjectMeta(builder.WithUID("other-uid")).Result()
+	assert.Error(t, operation.verify(vs, otherBackup))
+
+	// legacy operation IDs are still accepted, without UIDs to verify
+	started := time.Now().Truncate(time.Second)
+	operation, err = parseVolumeSnapshotOperationID("ns/vs/"+started.Format(time.RFC3339), logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, &volumeSnapshotOperation{Namespace: "ns", Name: "vs", Started: operation.Started}, operation)
+	assert.True(t, started.Equal(operation.Started))
+	assert.NoError(t, operation.verify(recreated, otherBackup))
+
+	for _, invalid := range []string{"", "ns/vs", "ns/vs/yesterday", "vs.v1", "vs.v1.!!!", "vs.v1.e30", "vs.v2.e30"} {
+		_, err := parseVolumeSnapshotOperationID(invalid, logrus.New())
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestVolumeSnapshotOperationRecreatedVolumeSnapshot(t *testing.T) {
+	vs := builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithUID("vs-uid")).Result()
+	backup := builder.ForBackup("velero", "backup").ObjectMeta(builder.WithUID("backup-uid")).Result()
+	operationID, err := newVolumeSnapshotOperationID(vs, backup)
+	require.NoError(t, err)
+
+	recreated := builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithUID("other-uid")).Result()
+	snapshotClient := snapshotfake.NewSimpleClientset(recreated)
+	vsBIA := VolumeSnapshotBackupItemAction{
+		Log:            logrus.New(),
+		Client:         fake.NewSimpleClientset(),
+		SnapshotClient: snapshotClient,
+	}
+
+	_, err = vsBIA.Progress(operationID, backup)
+	assert.Error(t, err)
+
+	// the re-created volumesnapshot is not deleted
+	require.NoError(t, vsBIA.Cancel(operationID, backup))
+	_, err = snapshotClient.SnapshotV1().VolumeSnapshots("ns").Get(context.TODO(), "vs", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
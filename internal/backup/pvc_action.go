@@ -18,18 +18,23 @@ package backup
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
+	groupsnapshotv1alpha1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumegroupsnapshot/v1alpha1"
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
 	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1api "k8s.io/api/core/v1"
+	storagev1api "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -41,6 +46,7 @@ import (
 	"github.com/vmware-tanzu/velero/pkg/label"
 	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
 	biav2 "github.com/vmware-tanzu/velero/pkg/plugin/velero/backupitemaction/v2"
+	"github.com/vmware-tanzu/velero/pkg/podexec"
 	uploaderUtil "github.com/vmware-tanzu/velero/pkg/uploader/util"
 	"github.com/vmware-tanzu/velero/pkg/util/boolptr"
 )
@@ -51,6 +57,8 @@ type PVCBackupItemAction struct {
 	Client         kubernetes.Interface
 	SnapshotClient snapshotterClientSet.Interface
 	CRClient       crclient.Client
+	// PodCommandExecutor runs the freeze and thaw commands in the pods using the PVC.
+	PodCommandExecutor podexec.PodCommandExecutor
 }
 
 // AppliesTo returns information indicating that the PVCBackupItemAction should be invoked to backup PVCs.
@@ -89,13 +97,39 @@ func (p *PVCBackupItemAction) Execute(item runtime.Unstructured, backup *velerov
 		return nil, nil, "", nil, errors.WithStack(err)
 	}
 
+	pluginConfig, err := util.GetPVCBackupPluginConfig(backup.Namespace, p.Client.CoreV1())
+	if err != nil {
+		return nil, nil, "", nil, errors.WithStack(err)
+	}
+
+	// A PVC not bound yet, e.g. waiting for its first consumer, has no data to snapshot. Unless the policy
+	// is to back up its spec only so it can be recreated on restore, getting its PV below fails the item.
+	unboundPVCPolicy, err := util.GetUnboundPVCPolicy(backup, pluginConfig)
+	if err != nil {
+		return nil, nil, "", nil, errors.WithStack(err)
+	}
+	if !util.IsPVCBound(&pvc) && unboundPVCPolicy == util.UnboundPVCPolicyBackupSpec {
+		p.Log.Warnf("PVC %s/%s is in phase %v and is not bound to a volume, backing up its spec only", pvc.Namespace, pvc.Name, pvc.Status.Phase)
+
+		util.AddAnnotations(&pvc.ObjectMeta, map[string]string{
+			util.SkippedUnboundPVCAnnotation: "true",
+		})
+		data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pvc)
+		return &unstructured.Unstructured{Object: data}, nil, "", nil, err
+	}
+
 	p.Log.Debugf("Fetching underlying PV for PVC %s", fmt.Sprintf("%s/%s", pvc.Namespace, pvc.Name))
 	// Do nothing if this is not a CSI provisioned volume
 	pv, err := util.GetPVForPVC(&pvc, p.Client.CoreV1())
 	if err != nil {
 		return nil, nil, "", nil, errors.WithStack(err)
 	}
-	if pv.Spec.PersistentVolumeSource.CSI == nil {
+	// PVs of in-tree plugins migrated to CSI are snapshotted through their CSI driver
+	csiSource, err := util.GetCSIPersistentVolumeSource(pv)
+	if err != nil {
+		return nil, nil, "", nil, errors.WithStack(err)
+	}
+	if csiSource == nil {
 		p.Log.Infof("Skipping PVC %s/%s, associated PV %s is not a CSI volume", pvc.Namespace, pvc.Name, pv.Name)
 
 		util.AddAnnotations(&pvc.ObjectMeta, map[string]string{
@@ -115,20 +149,40 @@ func (p *PVCBackupItemAction) Execute(item runtime.Unstructured, backup *velerov
 		return item, nil, "", nil, nil
 	}
 
-	// no storage class: we don't know how to map to a VolumeSnapshotClass
-	if pvc.Spec.StorageClassName == nil {
-		return item, nil, "", nil, errors.Errorf("Cannot snapshot PVC %s/%s, PVC has no storage class.", pvc.Namespace, pvc.Name)
+	// The CSI driver serving the volume picks the VolumeSnapshotClass. Statically provisioned PVs
+	// and PVs whose StorageClass was deleted have no StorageClass to take the driver from.
+	driver := csiSource.Driver
+	var storageClass *storagev1api.StorageClass
+	if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
+		p.Log.Infof("Fetching storage class for PV %s", *pvc.Spec.StorageClassName)
+		storageClass, err = p.Client.StorageV1().StorageClasses().Get(context.TODO(), *pvc.Spec.StorageClassName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			storageClass = nil
+			p.Log.Infof("Storage class %s of PVC %s/%s is not found, using CSI driver %s of PV %s", *pvc.Spec.StorageClassName, pvc.Namespace, pvc.Name, driver, pv.Name)
+		} else if err != nil {
+			return nil, nil, "", nil, errors.Wrap(err, "error getting storage class")
+		} else if util.GetProvisionerCSIDriver(storageClass.Provisioner) != driver {
+			p.Log.Warnf("Provisioner %s of storage class %s doesn't match CSI driver %s of PV %s, using CSI driver %s",
+				storageClass.Provisioner, storageClass.Name, driver, pv.Name, driver)
+		}
+	} else {
+		p.Log.Infof("PVC %s/%s has no storage class, using CSI driver %s of PV %s", pvc.Namespace, pvc.Name, driver, pv.Name)
 	}
 
-	p.Log.Infof("Fetching storage class for PV %s", *pvc.Spec.StorageClassName)
-	storageClass, err := p.Client.StorageV1().StorageClasses().Get(context.TODO(), *pvc.Spec.StorageClassName, metav1.GetOptions{})
+	classifier, err := util.NewSnapshotErrorClassifier(pluginConfig)
 	if err != nil {
-		return nil, nil, "", nil, errors.Wrap(err, "error getting storage class")
+		return nil, nil, "", nil, errors.WithStack(err)
 	}
-	p.Log.Debugf("Fetching volumesnapshot class for %s", storageClass.Provisioner)
-	snapshotClass, err := util.GetVolumeSnapshotClass(storageClass.Provisioner, backup, &pvc, p.Log, p.SnapshotClient.SnapshotV1())
+
+	policyRule, err := p.matchVolumeSnapshotClassPolicy(pluginConfig, &pvc, driver)
+	if err != nil {
+		return nil, nil, "", nil, errors.WithStack(err)
+	}
+
+	p.Log.Debugf("Fetching volumesnapshot class for %s", driver)
+	snapshotClass, err := util.GetVolumeSnapshotClass(driver, backup, &pvc, policyRule, storageClass, p.Log, p.SnapshotClient.SnapshotV1())
 	if err != nil {
-		return nil, nil, "", nil, errors.Wrapf(err, "failed to get volumesnapshotclass for storageclass %s", storageClass.Name)
+		return nil, nil, "", nil, errors.Wrapf(err, "failed to get volumesnapshotclass for CSI driver %s", driver)
 	}
 	p.Log.Infof("volumesnapshot class=%s", snapshotClass.Name)
 
@@ -137,27 +191,100 @@ func (p *PVCBackupItemAction) Execute(item runtime.Unstructured, backup *velerov
 		vsLabels[k] = v
 	}
 	vsLabels[velerov1api.BackupNameLabel] = label.GetValidName(backup.Name)
+	vsLabels[velerov1api.BackupUIDLabel] = string(backup.UID)
+	vsLabels[velerov1api.PVCUIDLabel] = string(pvc.UID)
 
-	// Craft the snapshot object to be created
-	snapshot := snapshotv1api.VolumeSnapshot{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "velero-" + pvc.Name + "-",
-			Namespace:    pvc.Namespace,
-			Labels:       vsLabels,
-		},
-		Spec: snapshotv1api.VolumeSnapshotSpec{
-			Source: snapshotv1api.VolumeSnapshotSource{
-				PersistentVolumeClaimName: &pvc.Name,
-			},
-			VolumeSnapshotClassName: &snapshotClass.Name,
-		},
+	concurrency, err := util.ParseSnapshotConcurrencyConfig(pluginConfig)
+	if err != nil {
+		return nil, nil, "", nil, errors.WithStack(err)
 	}
 
-	upd, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(pvc.Namespace).Create(context.TODO(), &snapshot, metav1.CreateOptions{})
-	if err != nil {
-		return nil, nil, "", nil, errors.Wrapf(err, "error creating volume snapshot")
+	var upd *snapshotv1api.VolumeSnapshot
+	consistencyLevel := util.ConsistencyLevelCrash
+	if groupName, ok := util.GetVolumeGroupName(&pvc, backup); ok {
+		// PVCs of the same volume group are snapshotted together by a VolumeGroupSnapshot,
+		// the VolumeSnapshot of this PVC is one of its members.
+		upd, consistencyLevel, err = p.getVolumeSnapshotFromGroup(&pvc, pv, backup, driver, groupName, concurrency, vsLabels)
+		if err != nil {
+			return nil, nil, "", nil, errors.Wrapf(err, "error getting volume snapshot of volume group %s", groupName)
+		}
+		p.Log.Infof("Using volumesnapshot %s of volume group %s", fmt.Sprintf("%s/%s", upd.Namespace, upd.Name), groupName)
+	} else if upd, err = p.getExistingVolumeSnapshot(&pvc, backup); err != nil {
+		return nil, nil, "", nil, errors.WithStack(err)
+	} else if upd != nil {
+		// The item is executed again, e.g. retried, the volumesnapshot created by the former execution is reused.
+		p.Log.Infof("Reusing volumesnapshot %s created for PVC %s/%s", fmt.Sprintf("%s/%s", upd.Namespace, upd.Name), pvc.Namespace, pvc.Name)
+	} else {
+		// Wait for the number of in-flight snapshots to drop below the limits of the plugin config,
+		// the created VolumeSnapshot then takes a slot until its Progress sees it complete.
+		if err := util.WaitForSnapshotSlot(driver, 1, concurrency, p.SnapshotClient.SnapshotV1(), p.CRClient, p.Log, backup.Spec.CSISnapshotTimeout.Duration); err != nil {
+			return nil, nil, "", nil, errors.WithStack(err)
+		}
+		if concurrency != nil {
+			for k, v := range util.SnapshotInFlightLabels(driver) {
+				vsLabels[k] = v
+			}
+		}
+
+		// The name is deterministic so that concurrent executions of the item can't create two volumesnapshots.
+		snapshotName := util.DefaultVolumeSnapshotName(backup, &pvc)
+		if tmpl := util.GetVolumeSnapshotNameTemplate(backup, pluginConfig); tmpl != "" {
+			if snapshotName, err = util.RenderVolumeSnapshotName(tmpl, backup, &pvc); err != nil {
+				return nil, nil, "", nil, errors.WithStack(err)
+			}
+		}
+
+		// Quiesce the pods using the PVC which opted in to it, for the duration of the snapshot.
+		pods, err := util.GetPodsUsingPVC(pvc.Namespace, pvc.Name, p.Client.CoreV1())
+		if err != nil {
+			return nil, nil, "", nil, errors.WithStack(err)
+		}
+		quiescer := newQuiescer(p.PodCommandExecutor, p.Log)
+		if err := quiescer.freeze(pods, pvc.Name); err != nil {
+			return nil, nil, "", nil, errors.Wrapf(err, "error quiescing pods using PVC %s/%s", pvc.Namespace, pvc.Name)
+		}
+		defer quiescer.thaw()
+
+		// Craft the snapshot object to be created
+		snapshot := snapshotv1api.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      snapshotName,
+				Namespace: pvc.Namespace,
+				Labels:    vsLabels,
+			},
+			Spec: snapshotv1api.VolumeSnapshotSpec{
+				Source: snapshotv1api.VolumeSnapshotSource{
+					PersistentVolumeClaimName: &pvc.Name,
+				},
+				VolumeSnapshotClassName: &snapshotClass.Name,
+			},
+		}
+
+		upd, err = p.SnapshotClient.SnapshotV1().VolumeSnapshots(pvc.Namespace).Create(context.TODO(), &snapshot, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// Another execution of the item created the volumesnapshot in the meantime.
+			upd, err = p.getVolumeSnapshotOfPVC(pvc.Namespace, snapshotName, &pvc, backup)
+			if err != nil {
+				return nil, nil, "", nil, errors.WithStack(err)
+			}
+			p.Log.Infof("Reusing volumesnapshot %s created for PVC %s/%s", fmt.Sprintf("%s/%s", upd.Namespace, upd.Name), pvc.Namespace, pvc.Name)
+			// the snapshot may have been cut before the pods were frozen
+			quiescer.thaw()
+		} else if err != nil {
+			return nil, nil, "", nil, errors.Wrapf(err, "error creating volume snapshot")
+		} else {
+			p.Log.Infof("Created volumesnapshot %s", fmt.Sprintf("%s/%s", upd.Namespace, upd.Name))
+		}
+
+		if quiescer.isFrozen() {
+			// The snapshot is cut once the volumesnapshotcontent has a snapshot handle.
+			if _, err := util.GetVolumeSnapshotContentForVolumeSnapshot(upd, p.SnapshotClient.SnapshotV1(), classifier, p.Log, true, quiescer.timeout); err != nil {
+				quiescer.degrade(err)
+			}
+			quiescer.thaw()
+			consistencyLevel = quiescer.consistencyLevel()
+		}
 	}
-	p.Log.Infof("Created volumesnapshot %s", fmt.Sprintf("%s/%s", upd.Namespace, upd.Name))
 
 	labels := map[string]string{
 		util.VolumeSnapshotLabel:    upd.Name,
@@ -167,6 +294,10 @@ func (p *PVCBackupItemAction) Execute(item runtime.Unstructured, backup *velerov
 	annotations := map[string]string{
 		util.VolumeSnapshotLabel:                 upd.Name,
 		util.MustIncludeAdditionalItemAnnotation: "true",
+		util.SnapshotConsistencyAnnotation:       consistencyLevel,
+	}
+	if policyRule != nil && snapshotClass.Name == policyRule.VolumeSnapshotClass {
+		annotations[util.VolumeSnapshotClassPolicyRuleAnnotation] = policyRule.Name
 	}
 
 	var additionalItems []velero.ResourceIdentifier
@@ -185,7 +316,7 @@ func (p *PVCBackupItemAction) Execute(item runtime.Unstructured, backup *velerov
 		// Wait until VS associated VSC snapshot handle created before returning with
 		// the Async operation for data mover.
 		_, err := util.GetVolumeSnapshotContentForVolumeSnapshot(upd, p.SnapshotClient.SnapshotV1(),
-			dataUploadLog, true, backup.Spec.CSISnapshotTimeout.Duration)
+			classifier, dataUploadLog, true, backup.Spec.CSISnapshotTimeout.Duration)
 		if err != nil {
 			dataUploadLog.Errorf("Fail to wait VolumeSnapshot snapshot handle created: %s", err.Error())
 			util.CleanupVolumeSnapshot(upd, p.SnapshotClient.SnapshotV1(), p.Log)
@@ -303,8 +434,220 @@ func (p *PVCBackupItemAction) Cancel(operationID string, backup *velerov1api.Bac
 	return cancelDataUpload(context.Background(), p.CRClient, dataUpload)
 }
 
+// matchVolumeSnapshotClassPolicy returns the rule of the VolumeSnapshotClass policy in the plugin config matching the PVC,
+// or nil if there is no policy or no rule matches.
+func (p *PVCBackupItemAction) matchVolumeSnapshotClassPolicy(config *corev1api.ConfigMap, pvc *corev1api.PersistentVolumeClaim,
+	driver string) (*util.VolumeSnapshotClassRule, error) {
+	policy, err := util.ParseVolumeSnapshotClassPolicy(config)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+
+	namespace, err := p.Client.CoreV1().Namespaces().Get(context.TODO(), pvc.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting namespace %s", pvc.Namespace)
+	}
+	storageClassName := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClassName = *pvc.Spec.StorageClassName
+	}
+
+	return policy.Match(pvc, namespace, storageClassName, driver, p.Log)
+}
+
+// getExistingVolumeSnapshot returns the volumesnapshot a former execution of the item created for the PVC in the backup,
+// nil if there is none.
+func (p *PVCBackupItemAction) getExistingVolumeSnapshot(pvc *corev1api.PersistentVolumeClaim, backup *velerov1api.Backup) (*snapshotv1api.VolumeSnapshot, error) {
+	selector := labels.SelectorFromSet(map[string]string{
+		velerov1api.BackupUIDLabel: string(backup.UID),
+		velerov1api.PVCUIDLabel:    string(pvc.UID),
+	})
+	vsList, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(pvc.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing volumesnapshots of PVC %s/%s", pvc.Namespace, pvc.Name)
+	}
+	for i := range vsList.Items {
+		if vsList.Items[i].DeletionTimestamp == nil {
+			return &vsList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// getVolumeSnapshotOfPVC gets the volumesnapshot with the name, it fails if it wasn't created for the PVC in the backup.
+func (p *PVCBackupItemAction) getVolumeSnapshotOfPVC(namespace, name string, pvc *corev1api.PersistentVolumeClaim, backup *velerov1api.Backup) (*snapshotv1api.VolumeSnapshot, error) {
+	vs, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting volumesnapshot %s/%s", namespace, name)
+	}
+	if vs.Labels[velerov1api.BackupUIDLabel] != string(backup.UID) || vs.Labels[velerov1api.PVCUIDLabel] != string(pvc.UID) {
+		return nil, errors.Errorf("volumesnapshot %s/%s already exists and was not created for PVC %s/%s by backup %s", namespace, name, pvc.Namespace, pvc.Name, backup.Name)
+	}
+	return vs, nil
+}
+
+// getVolumeSnapshotFromGroup returns the VolumeSnapshot taken for the PVC by the VolumeGroupSnapshot of its volume group.
+// The VolumeGroupSnapshot is created by the first PVC of the group processed in the backup and reused by the others,
+// it only selects the PVCs of the group in the scope of the backup.
+func (p *PVCBackupItemAction) getVolumeSnapshotFromGroup(pvc *corev1api.PersistentVolumeClaim, pv *corev1api.PersistentVolume,
+	backup *velerov1api.Backup, driver, groupName string, concurrency *util.SnapshotConcurrencyConfig,
+	vsLabels map[string]string) (*snapshotv1api.VolumeSnapshot, string, error) {
+	groupSnapshotClient := p.SnapshotClient.GroupsnapshotV1alpha1()
+	vgsName := util.GetVolumeGroupSnapshotName(backup, groupName)
+	memberSelector, err := util.GetVolumeGroupMemberSelector(backup, groupName)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	// The member volumesnapshots take a slot each until their Progress sees them complete, like a volumesnapshot
+	// created for a single PVC, the group snapshot waits for the slots of all of them.
+	if concurrency != nil {
+		for k, v := range util.SnapshotInFlightLabels(driver) {
+			vsLabels[k] = v
+		}
+	}
+
+	vgs, err := groupSnapshotClient.VolumeGroupSnapshots(pvc.Namespace).Get(context.TODO(), vgsName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		groupSnapshotClass, err := util.GetVolumeGroupSnapshotClass(driver, backup, p.Log, groupSnapshotClient)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to get volumegroupsnapshotclass for driver %s", driver)
+		}
+
+		members, err := p.listVolumeGroupMembers(pvc.Namespace, memberSelector)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := util.WaitForSnapshotSlot(driver, len(members), concurrency, p.SnapshotClient.SnapshotV1(), p.CRClient, p.Log,
+			backup.Spec.CSISnapshotTimeout.Duration); err != nil {
+			return nil, "", errors.Wrapf(err, "error waiting for the snapshot slots of the %d PVCs of volume group %s", len(members), groupName)
+		}
+
+		// Quiesce the pods using the PVCs of the group which opted in to it, for the duration of the group snapshot.
+		quiescer, err := p.freezeVolumeGroup(members)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "error quiescing pods using the PVCs of volume group %s", groupName)
+		}
+		defer quiescer.thaw()
+
+		vgs = &groupsnapshotv1alpha1api.VolumeGroupSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      vgsName,
+				Namespace: pvc.Namespace,
+				Labels: map[string]string{
+					velerov1api.BackupNameLabel: label.GetValidName(backup.Name),
+				},
+			},
+			Spec: groupsnapshotv1alpha1api.VolumeGroupSnapshotSpec{
+				Source: groupsnapshotv1alpha1api.VolumeGroupSnapshotSource{
+					Selector: memberSelector,
+				},
+				VolumeGroupSnapshotClassName: &groupSnapshotClass.Name,
+			},
+		}
+		created, err := groupSnapshotClient.VolumeGroupSnapshots(pvc.Namespace).Create(context.TODO(), vgs, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, "", errors.Wrapf(err, "error creating volumegroupsnapshot %s/%s", pvc.Namespace, vgsName)
+		}
+		if err == nil {
+			vgs = created
+			p.Log.Infof("Created volumegroupsnapshot %s/%s for volume group %s", vgs.Namespace, vgs.Name, groupName)
+		} else {
+			// Another execution created the volumegroupsnapshot in the meantime, it may have been cut before the pods were frozen.
+			quiescer.thaw()
+		}
+
+		if quiescer.isFrozen() {
+			// The group snapshot is cut once its member volumesnapshots are listed.
+			if _, err := util.WaitVolumeGroupSnapshotMembers(vgs, groupSnapshotClient, p.Log, quiescer.timeout); err != nil {
+				quiescer.degrade(err)
+			}
+			quiescer.thaw()
+
+			// The other PVCs of the group find the consistency level of the group snapshot on it.
+			pb, err := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{"annotations": map[string]string{util.SnapshotConsistencyAnnotation: quiescer.consistencyLevel()}},
+			})
+			if err != nil {
+				return nil, "", errors.WithStack(err)
+			}
+			if vgs, err = groupSnapshotClient.VolumeGroupSnapshots(vgs.Namespace).Patch(context.TODO(), vgs.Name, types.MergePatchType, pb, metav1.PatchOptions{}); err != nil {
+				return nil, "", errors.Wrapf(err, "error recording the consistency level on volumegroupsnapshot %s/%s", pvc.Namespace, vgsName)
+			}
+		}
+	} else if err != nil {
+		return nil, "", errors.Wrapf(err, "error getting volumegroupsnapshot %s/%s", pvc.Namespace, vgsName)
+	}
+
+	vgs, err = util.WaitVolumeGroupSnapshotMembers(vgs, groupSnapshotClient, p.Log, backup.Spec.CSISnapshotTimeout.Duration)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	vs, err := util.GetVolumeSnapshotForPVCInGroup(vgs, pvc, pv, p.SnapshotClient.SnapshotV1())
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	consistencyLevel := vgs.Annotations[util.SnapshotConsistencyAnnotation]
+	if consistencyLevel == "" {
+		consistencyLevel = util.ConsistencyLevelCrash
+	}
+
+	// Label the member volumesnapshot the same way as a volumesnapshot created for a single PVC,
+	// so the VolumeSnapshot actions handle it as taken by this backup.
+	memberLabels := map[string]string{util.VolumeGroupSnapshotLabel: vgs.Name}
+	for k, v := range vsLabels {
+		memberLabels[k] = v
+	}
+	pb, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": memberLabels},
+	})
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	vs, err = p.SnapshotClient.SnapshotV1().VolumeSnapshots(vs.Namespace).Patch(context.TODO(), vs.Name, types.MergePatchType, pb, metav1.PatchOptions{})
+	return vs, consistencyLevel, err
+}
+
+// listVolumeGroupMembers returns the PVCs of the volume group selected by the selector of its VolumeGroupSnapshot.
+func (p *PVCBackupItemAction) listVolumeGroupMembers(namespace string, memberSelector *metav1.LabelSelector) ([]corev1api.PersistentVolumeClaim, error) {
+	selector, err := metav1.LabelSelectorAsSelector(memberSelector)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	members, err := p.Client.CoreV1().PersistentVolumeClaims(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing the PVCs of namespace %s", namespace)
+	}
+	return members.Items, nil
+}
+
+// freezeVolumeGroup freezes the pods using the PVCs of the volume group which opted in to quiescing.
+func (p *PVCBackupItemAction) freezeVolumeGroup(members []corev1api.PersistentVolumeClaim) (*quiescer, error) {
+	quiescer := newQuiescer(p.PodCommandExecutor, p.Log)
+	for _, member := range members {
+		pods, err := util.GetPodsUsingPVC(member.Namespace, member.Name, p.Client.CoreV1())
+		if err != nil {
+			quiescer.thaw()
+			return nil, errors.WithStack(err)
+		}
+		if err := quiescer.freeze(pods, member.Name); err != nil {
+			return nil, err
+		}
+	}
+	return quiescer, nil
+}
+
 func newDataUpload(backup *velerov1api.Backup, vs *snapshotv1api.VolumeSnapshot,
 	pvc *corev1api.PersistentVolumeClaim, operationID string, vsClass *snapshotv1api.VolumeSnapshotClass) *velerov2alpha1.DataUpload {
+	storageClassName := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClassName = *pvc.Spec.StorageClassName
+	}
 	dataUpload := &velerov2alpha1.DataUpload{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: velerov2alpha1.SchemeGroupVersion.String(),
@@ -333,7 +676,7 @@ func newDataUpload(backup *velerov1api.Backup, vs *snapshotv1api.VolumeSnapshot,
 			SnapshotType: velerov2alpha1.SnapshotTypeCSI,
 			CSISnapshot: &velerov2alpha1.CSISnapshotSpec{
 				VolumeSnapshot: vs.Name,
-				StorageClass:   *pvc.Spec.StorageClassName,
+				StorageClass:   storageClassName,
 				SnapshotClass:  vsClass.Name,
 			},
 			SourcePVC:             pvc.Name,
@@ -355,9 +698,18 @@ func newDataUpload(backup *velerov1api.Backup, vs *snapshotv1api.VolumeSnapshot,
 func createDataUpload(ctx context.Context, backup *velerov1api.Backup, crClient crclient.Client,
 	vs *snapshotv1api.VolumeSnapshot, pvc *corev1api.PersistentVolumeClaim, operationID string,
 	vsClass *snapshotv1api.VolumeSnapshotClass) (*velerov2alpha1.DataUpload, error) {
+	// The item is executed again, e.g. retried, the DataUpload created for the operation by the former execution is reused.
+	existing, err := getExistingDataUpload(ctx, crClient, operationID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
 	dataUpload := newDataUpload(backup, vs, pvc, operationID, vsClass)
 
-	err := crClient.Create(ctx, dataUpload)
+	err = crClient.Create(ctx, dataUpload)
 	if err != nil {
 		return nil, errors.Wrap(err, "fail to create DataUpload CR")
 	}
@@ -365,6 +717,24 @@ func createDataUpload(ctx context.Context, backup *velerov1api.Backup, crClient
 	return dataUpload, err
 }
 
+// getExistingDataUpload returns the DataUpload created for the operation by a former execution of the item,
+// nil if there is none.
+func getExistingDataUpload(ctx context.Context, crClient crclient.Client, operationID string) (*velerov2alpha1.DataUpload, error) {
+	dataUploadList := new(velerov2alpha1.DataUploadList)
+	err := crClient.List(ctx, dataUploadList, &crclient.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{velerov1api.AsyncOperationIDLabel: operationID}),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing DataUploads of operationID %s", operationID)
+	}
+	for i := range dataUploadList.Items {
+		if dataUploadList.Items[i].DeletionTimestamp == nil {
+			return &dataUploadList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
 func getDataUpload(ctx context.Context,
 	crClient crclient.Client, operationID string) (*velerov2alpha1.DataUpload, error) {
 	dataUploadList := new(velerov2alpha1.DataUploadList)
@@ -18,15 +18,18 @@ package backup
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	groupsnapshotv1alpha1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumegroupsnapshot/v1alpha1"
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
 	v1 "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
 	snapshotfake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
@@ -36,6 +39,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
@@ -50,6 +54,7 @@ import (
 
 func TestExecute(t *testing.T) {
 	boolTrue := true
+	vsName := util.DefaultVolumeSnapshotName(builder.ForBackup("velero", "test").Result(), builder.ForPersistentVolumeClaim("velero", "testPVC").Result())
 	tests := []struct {
 		name               string
 		backup             *velerov1api.Backup
@@ -57,8 +62,10 @@ func TestExecute(t *testing.T) {
 		pv                 *corev1.PersistentVolume
 		sc                 *storagev1.StorageClass
 		vsClass            *snapshotv1api.VolumeSnapshotClass
+		vs                 *snapshotv1api.VolumeSnapshot
 		operationID        string
 		expectedErr        error
+		expectedErrMsg     string
 		expectedBackup     *velerov1api.Backup
 		expectedDataUpload *velerov2alpha1.DataUpload
 		expectedPVC        *corev1.PersistentVolumeClaim
@@ -73,6 +80,102 @@ func TestExecute(t *testing.T) {
 			backup:      builder.ForBackup("velero", "test").Phase(velerov1api.BackupPhaseFinalizing).Result(),
 			expectedErr: nil,
 		},
+		{
+			name:           "Fail PVC waiting for first consumer by default",
+			backup:         builder.ForBackup("velero", "test").Result(),
+			pvc:            builder.ForPersistentVolumeClaim("velero", "testPVC").StorageClass("testSC").Phase(corev1.ClaimPending).Result(),
+			expectedErrMsg: "PVC velero/testPVC has no volume backing this claim",
+		},
+		{
+			name:           "Fail on invalid unbound PVC policy",
+			backup:         builder.ForBackup("velero", "test").ObjectMeta(builder.WithAnnotations(util.UnboundPVCPolicyBackupAnnotation, "skip")).Result(),
+			pvc:            builder.ForPersistentVolumeClaim("velero", "testPVC").StorageClass("testSC").Phase(corev1.ClaimPending).Result(),
+			expectedErrMsg: `invalid unbound PVC policy "skip", expected "fail" or "backupSpec"`,
+		},
+		{
+			name:        "Back up spec only of PVC waiting for first consumer",
+			backup:      builder.ForBackup("velero", "test").ObjectMeta(builder.WithAnnotations(util.UnboundPVCPolicyBackupAnnotation, util.UnboundPVCPolicyBackupSpec)).Result(),
+			pvc:         builder.ForPersistentVolumeClaim("velero", "testPVC").StorageClass("testSC").Phase(corev1.ClaimPending).Result(),
+			expectedErr: nil,
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
+				ObjectMeta(builder.WithAnnotations(util.SkippedUnboundPVCAnnotation, "true")).
+				StorageClass("testSC").Phase(corev1.ClaimPending).Result(),
+		},
+		{
+			name:    "Snapshot statically provisioned PV without storage class",
+			backup:  builder.ForBackup("velero", "test").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").VolumeName("testPV").Phase(corev1.ClaimBound).Result(),
+			pv:      builder.ForPersistentVolume("testPV").CSI("hostpath", "testVolume").Result(),
+			vsClass: builder.ForVolumeSnapshotClass("testVSClass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
+				ObjectMeta(builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, vsName)).
+				VolumeName("testPV").Phase(corev1.ClaimBound).Result(),
+		},
+		{
+			name:    "Snapshot in-tree PV migrated to CSI",
+			backup:  builder.ForBackup("velero", "test").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").VolumeName("testPV").StorageClass("testSC").Phase(corev1.ClaimBound).Result(),
+			pv:      builder.ForPersistentVolume("testPV").AWSEBSVolumeID("aws://us-east-1a/vol-1").ObjectMeta(builder.WithAnnotations(util.AnnMigratedTo, util.AWSEBSCSIDriverName)).Result(),
+			sc:      builder.ForStorageClass("testSC").Provisioner("kubernetes.io/aws-ebs").Result(),
+			vsClass: builder.ForVolumeSnapshotClass("testVSClass").Driver(util.AWSEBSCSIDriverName).ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
+				ObjectMeta(builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, vsName)).
+				VolumeName("testPV").StorageClass("testSC").Phase(corev1.ClaimBound).Result(),
+		},
+		{
+			name:    "Snapshot PV whose storage class was deleted",
+			backup:  builder.ForBackup("velero", "test").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").VolumeName("testPV").StorageClass("deletedSC").Phase(corev1.ClaimBound).Result(),
+			pv:      builder.ForPersistentVolume("testPV").CSI("hostpath", "testVolume").Result(),
+			vsClass: builder.ForVolumeSnapshotClass("testVSClass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
+				ObjectMeta(builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, vsName)).
+				VolumeName("testPV").StorageClass("deletedSC").Phase(corev1.ClaimBound).Result(),
+		},
+		{
+			name:    "Snapshot with CSI driver of PV when storage class provisioner differs",
+			backup:  builder.ForBackup("velero", "test").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").VolumeName("testPV").StorageClass("testSC").Phase(corev1.ClaimBound).Result(),
+			pv:      builder.ForPersistentVolume("testPV").CSI("hostpath", "testVolume").Result(),
+			sc:      builder.ForStorageClass("testSC").Provisioner("other").Result(),
+			vsClass: builder.ForVolumeSnapshotClass("testVSClass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
+				ObjectMeta(builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, vsName)).
+				VolumeName("testPV").StorageClass("testSC").Phase(corev1.ClaimBound).Result(),
+		},
+		{
+			name:    "Name volumesnapshot with template of backup annotation",
+			backup:  builder.ForBackup("velero", "test").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotNameTemplateBackupAnnotation, "{{.BackupName}}-{{.PVCName}}")).Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").VolumeName("testPV").Phase(corev1.ClaimBound).Result(),
+			pv:      builder.ForPersistentVolume("testPV").CSI("hostpath", "testVolume").Result(),
+			vsClass: builder.ForVolumeSnapshotClass("testVSClass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
+				ObjectMeta(builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, "test-testpvc")).
+				VolumeName("testPV").Phase(corev1.ClaimBound).Result(),
+		},
+		{
+			name:   "Reuse volumesnapshot created by a former execution of the item",
+			backup: builder.ForBackup("velero", "test").ObjectMeta(builder.WithUID("backup-uid")).Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithUID("pvc-uid")).
+				VolumeName("testPV").Phase(corev1.ClaimBound).Result(),
+			pv:      builder.ForPersistentVolume("testPV").CSI("hostpath", "testVolume").Result(),
+			vsClass: builder.ForVolumeSnapshotClass("testVSClass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+			vs: builder.ForVolumeSnapshot("velero", "velero-testPVC-abcde").
+				ObjectMeta(builder.WithLabels(velerov1api.BackupUIDLabel, "backup-uid", velerov1api.PVCUIDLabel, "pvc-uid")).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
+				ObjectMeta(builder.WithUID("pvc-uid"), builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, "velero-testPVC-abcde")).
+				VolumeName("testPV").Phase(corev1.ClaimBound).Result(),
+		},
+		{
+			name:    "Fail when volumesnapshot of the same name was not created for the PVC by the backup",
+			backup:  builder.ForBackup("velero", "test").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotNameTemplateBackupAnnotation, "{{.PVCName}}")).Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").VolumeName("testPV").Phase(corev1.ClaimBound).Result(),
+			pv:      builder.ForPersistentVolume("testPV").CSI("hostpath", "testVolume").Result(),
+			vsClass: builder.ForVolumeSnapshotClass("testVSClass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testpvc").
+				ObjectMeta(builder.WithLabels(velerov1api.BackupUIDLabel, "other-backup-uid", velerov1api.PVCUIDLabel, "")).Result(),
+			expectedErrMsg: "volumesnapshot velero/testpvc already exists and was not created for PVC velero/testPVC by backup test",
+		},
 		{
 			name:        "Test SnapshotMoveData",
 			backup:      builder.ForBackup("velero", "test").SnapshotMoveData(true).Result(),
@@ -109,7 +212,7 @@ func TestExecute(t *testing.T) {
 				Spec: velerov2alpha1.DataUploadSpec{
 					SnapshotType: velerov2alpha1.SnapshotTypeCSI,
 					CSISnapshot: &velerov2alpha1.CSISnapshotSpec{
-						VolumeSnapshot: "",
+						VolumeSnapshot: vsName,
 						StorageClass:   "testSC",
 						SnapshotClass:  "testVSClass",
 					},
@@ -128,8 +231,8 @@ func TestExecute(t *testing.T) {
 			operationID: ".",
 			expectedErr: nil,
 			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").
-				ObjectMeta(builder.WithAnnotations(util.MustIncludeAdditionalItemAnnotation, "true", util.DataUploadNameAnnotation, "velero/", util.VolumeSnapshotLabel, ""),
-					builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, "")).
+				ObjectMeta(builder.WithAnnotations(util.MustIncludeAdditionalItemAnnotation, "true", util.DataUploadNameAnnotation, "velero/", util.VolumeSnapshotLabel, vsName),
+					builder.WithLabels(velerov1api.BackupNameLabel, "test", util.VolumeSnapshotLabel, vsName)).
 				VolumeName("testPV").StorageClass("testSC").Phase(corev1.ClaimBound).Result(),
 		},
 	}
@@ -158,6 +261,10 @@ func TestExecute(t *testing.T) {
 				_, err := snapshotClient.SnapshotV1().VolumeSnapshotClasses().Create(context.Background(), tc.vsClass, metav1.CreateOptions{})
 				require.NoError(t, err)
 			}
+			if tc.vs != nil {
+				_, err := snapshotClient.SnapshotV1().VolumeSnapshots(tc.vs.Namespace).Create(context.Background(), tc.vs, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
 
 			pvcBIA := PVCBackupItemAction{
 				Log:            logger,
@@ -197,6 +304,11 @@ func TestExecute(t *testing.T) {
 			resultUnstructed, _, _, _, err := pvcBIA.Execute(&unstructured.Unstructured{Object: pvcMap}, tc.backup)
 			if tc.expectedErr != nil {
 				require.Equal(t, err, tc.expectedErr)
+			} else if tc.expectedErrMsg != "" {
+				require.EqualError(t, err, tc.expectedErrMsg)
+				return
+			} else {
+				require.NoError(t, err)
 			}
 
 			if tc.expectedDataUpload != nil {
@@ -211,6 +323,9 @@ func TestExecute(t *testing.T) {
 				resultPVC := new(corev1.PersistentVolumeClaim)
 				runtime.DefaultUnstructuredConverter.FromUnstructured(resultUnstructed.UnstructuredContent(), resultPVC)
 				require.True(t, cmp.Equal(tc.expectedPVC, resultPVC, cmpopts.IgnoreFields(corev1.PersistentVolumeClaim{}, "Annotations")))
+				if _, ok := tc.expectedPVC.Annotations[util.SkippedUnboundPVCAnnotation]; ok {
+					require.Equal(t, "true", resultPVC.Annotations[util.SkippedUnboundPVCAnnotation])
+				}
 			}
 		})
 	}
@@ -376,3 +491,241 @@ func TestCancel(t *testing.T) {
 		})
 	}
 }
+
+// newVolumeGroupSnapshotClient returns a snapshot client reconciling the volumegroupsnapshots it creates right away,
+// with a member volumesnapshot for each of the PVCs.
+func newVolumeGroupSnapshotClient(t *testing.T, pvcNames ...string) *snapshotfake.Clientset {
+	snapshotClient := snapshotfake.NewSimpleClientset(
+		builder.ForVolumeSnapshotClass("vsclass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+		&groupsnapshotv1alpha1api.VolumeGroupSnapshotClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "vgsclass", Labels: map[string]string{util.VolumeGroupSnapshotClassSelectorLabel: ""}},
+			Driver:     "hostpath",
+		},
+	)
+	snapshotClient.PrependReactor("create", "volumegroupsnapshots", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		vgs := action.(k8stesting.CreateAction).GetObject().(*groupsnapshotv1alpha1api.VolumeGroupSnapshot)
+		vgs.Status = &groupsnapshotv1alpha1api.VolumeGroupSnapshotStatus{}
+		for _, name := range pvcNames {
+			member := builder.ForVolumeSnapshot(vgs.Namespace, name+"-member").SourcePVC(name).Result()
+			require.NoError(t, snapshotClient.Tracker().Add(member))
+			vgs.Status.VolumeSnapshotRefList = append(vgs.Status.VolumeSnapshotRefList, corev1.ObjectReference{Namespace: vgs.Namespace, Name: member.Name})
+		}
+		return false, nil, nil
+	})
+	return snapshotClient
+}
+
+func TestExecuteVolumeGroupQuiesce(t *testing.T) {
+	backup := builder.ForBackup("velero", "test").Result()
+	client := fake.NewSimpleClientset(builder.ForStorageClass("sc").Provisioner("hostpath").Result())
+	for _, name := range []string{"data", "logs"} {
+		_, err := client.CoreV1().PersistentVolumes().Create(context.Background(),
+			builder.ForPersistentVolume("pv-"+name).CSI("hostpath", "volume-"+name).Result(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = client.CoreV1().PersistentVolumeClaims("ns").Create(context.Background(),
+			builder.ForPersistentVolumeClaim("ns", name).VolumeName("pv-"+name).StorageClass("sc").Phase(corev1.ClaimBound).
+				ObjectMeta(builder.WithLabels(util.VolumeGroupLabel, "db")).Result(), metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// the pod using both PVCs of the group is frozen once around the group snapshot
+	pod := builder.ForPod("ns", "db").ObjectMeta(builder.WithAnnotations(
+		util.QuiesceFreezeCommandAnnotation, "db-freeze",
+		util.QuiesceThawCommandAnnotation, "db-thaw",
+	)).Phase(corev1.PodRunning).Containers(&corev1.Container{Name: "app"}).Volumes(
+		builder.ForVolume("data").PersistentVolumeClaimSource("data").Result(),
+		builder.ForVolume("logs").PersistentVolumeClaimSource("logs").Result(),
+	).Result()
+	_, err := client.CoreV1().Pods("ns").Create(context.Background(), pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+	executor := &velerotest.MockPodCommandExecutor{}
+	expectCommand(executor, "db", "freeze", []string{"db-freeze"}, nil)
+	expectCommand(executor, "db", "thaw", []string{"db-thaw"}, nil)
+
+	pvcBIA := PVCBackupItemAction{
+		Log:                logrus.New(),
+		Client:             client,
+		SnapshotClient:     newVolumeGroupSnapshotClient(t, "data", "logs"),
+		CRClient:           velerotest.NewFakeControllerRuntimeClient(t),
+		PodCommandExecutor: executor,
+	}
+
+	for _, name := range []string{"data", "logs"} {
+		pvc, err := client.CoreV1().PersistentVolumeClaims("ns").Get(context.Background(), name, metav1.GetOptions{})
+		require.NoError(t, err)
+		pvcMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pvc)
+		require.NoError(t, err)
+
+		item, _, _, _, err := pvcBIA.Execute(&unstructured.Unstructured{Object: pvcMap}, backup)
+		require.NoError(t, err)
+		assert.Equal(t, name+"-member", item.(*unstructured.Unstructured).GetAnnotations()[util.VolumeSnapshotLabel])
+		assert.Equal(t, util.ConsistencyLevelApplication, item.(*unstructured.Unstructured).GetAnnotations()[util.SnapshotConsistencyAnnotation])
+	}
+	executor.AssertExpectations(t)
+}
+
+func TestExecuteVolumeGroupBackupScope(t *testing.T) {
+	backup := builder.ForBackup("velero", "test").LabelSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"app": "db"},
+	}).Result()
+	client := fake.NewSimpleClientset(builder.ForStorageClass("sc").Provisioner("hostpath").Result())
+	for name, pvcLabels := range map[string][]string{
+		"data":  {util.VolumeGroupLabel, "db", "app", "db"},
+		"cache": {util.VolumeGroupLabel, "db"},
+	} {
+		_, err := client.CoreV1().PersistentVolumes().Create(context.Background(),
+			builder.ForPersistentVolume("pv-"+name).CSI("hostpath", "volume-"+name).Result(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = client.CoreV1().PersistentVolumeClaims("ns").Create(context.Background(),
+			builder.ForPersistentVolumeClaim("ns", name).VolumeName("pv-"+name).StorageClass("sc").Phase(corev1.ClaimBound).
+				ObjectMeta(builder.WithLabels(pvcLabels...)).Result(), metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// the pod using the PVC out of the scope of the backup isn't frozen, the executor expects no command
+	pod := builder.ForPod("ns", "cache").ObjectMeta(builder.WithAnnotations(
+		util.QuiesceFreezeCommandAnnotation, "cache-freeze",
+		util.QuiesceThawCommandAnnotation, "cache-thaw",
+	)).Phase(corev1.PodRunning).Containers(&corev1.Container{Name: "app"}).Volumes(
+		builder.ForVolume("cache").PersistentVolumeClaimSource("cache").Result(),
+	).Result()
+	_, err := client.CoreV1().Pods("ns").Create(context.Background(), pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+	executor := &velerotest.MockPodCommandExecutor{}
+
+	snapshotClient := newVolumeGroupSnapshotClient(t, "data")
+	pvcBIA := PVCBackupItemAction{
+		Log:                logrus.New(),
+		Client:             client,
+		SnapshotClient:     snapshotClient,
+		CRClient:           velerotest.NewFakeControllerRuntimeClient(t),
+		PodCommandExecutor: executor,
+	}
+
+	pvc, err := client.CoreV1().PersistentVolumeClaims("ns").Get(context.Background(), "data", metav1.GetOptions{})
+	require.NoError(t, err)
+	pvcMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pvc)
+	require.NoError(t, err)
+	_, _, _, _, err = pvcBIA.Execute(&unstructured.Unstructured{Object: pvcMap}, backup)
+	require.NoError(t, err)
+	executor.AssertExpectations(t)
+
+	vgs, err := snapshotClient.GroupsnapshotV1alpha1().VolumeGroupSnapshots("ns").Get(context.Background(),
+		util.GetVolumeGroupSnapshotName(backup, "db"), metav1.GetOptions{})
+	require.NoError(t, err)
+	selector, err := metav1.LabelSelectorAsSelector(vgs.Spec.Source.Selector)
+	require.NoError(t, err)
+	assert.True(t, selector.Matches(labels.Set{util.VolumeGroupLabel: "db", "app": "db"}))
+	assert.False(t, selector.Matches(labels.Set{util.VolumeGroupLabel: "db"}))
+}
+
+func TestExecuteVolumeGroupSnapshotSlot(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxInFlight int
+		pvcNames    []string
+	}{
+		{
+			name:        "the only slot is taken by a volumesnapshot of another backup which isn't ready yet",
+			maxInFlight: 1,
+			pvcNames:    []string{"data"},
+		},
+		{
+			name:        "a slot is left, the group needs one for each of its PVCs",
+			maxInFlight: 2,
+			pvcNames:    []string{"data", "logs"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			backup := builder.ForBackup("velero", "test").CSISnapshotTimeout(time.Second).Result()
+			client := fake.NewSimpleClientset(
+				builder.ForConfigMap("velero", "config").
+					ObjectMeta(builder.WithLabels("velero.io/plugin-config", "", "velero.io/csi-pvc-backupper", "BackupItemAction")).
+					Data(util.SnapshotConcurrencyConfigKey, fmt.Sprintf("maxInFlight: %d", tc.maxInFlight)).Result(),
+				builder.ForStorageClass("sc").Provisioner("hostpath").Result(),
+			)
+			for _, name := range tc.pvcNames {
+				_, err := client.CoreV1().PersistentVolumes().Create(context.Background(),
+					builder.ForPersistentVolume("pv-"+name).CSI("hostpath", "volume-"+name).Result(), metav1.CreateOptions{})
+				require.NoError(t, err)
+				_, err = client.CoreV1().PersistentVolumeClaims("ns").Create(context.Background(),
+					builder.ForPersistentVolumeClaim("ns", name).VolumeName("pv-"+name).StorageClass("sc").Phase(corev1.ClaimBound).
+						ObjectMeta(builder.WithLabels(util.VolumeGroupLabel, "db")).Result(), metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			snapshotClient := newVolumeGroupSnapshotClient(t, tc.pvcNames...)
+			inFlight := builder.ForVolumeSnapshot("other", "in-flight").ObjectMeta(builder.WithLabels(util.VolumeSnapshotInFlightLabel, "hostpath")).Result()
+			require.NoError(t, snapshotClient.Tracker().Add(inFlight))
+
+			pvcBIA := PVCBackupItemAction{
+				Log:            logrus.New(),
+				Client:         client,
+				SnapshotClient: snapshotClient,
+				CRClient:       velerotest.NewFakeControllerRuntimeClient(t),
+			}
+
+			pvc, err := client.CoreV1().PersistentVolumeClaims("ns").Get(context.Background(), tc.pvcNames[0], metav1.GetOptions{})
+			require.NoError(t, err)
+			pvcMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pvc)
+			require.NoError(t, err)
+			_, _, _, _, err = pvcBIA.Execute(&unstructured.Unstructured{Object: pvcMap}, backup)
+			require.ErrorContains(t, err, "timed out after 1s waiting for a snapshot slot")
+
+			vgsList, err := snapshotClient.GroupsnapshotV1alpha1().VolumeGroupSnapshots("ns").List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Empty(t, vgsList.Items)
+		})
+	}
+}
+
+func TestExecuteDataMoverRetry(t *testing.T) {
+	backup := builder.ForBackup("velero", "test").ObjectMeta(builder.WithUID("backup-uid")).SnapshotMoveData(true).Result()
+	pvc := builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithUID("pvc-uid")).
+		VolumeName("testPV").StorageClass("testSC").Phase(corev1.ClaimBound).Result()
+	client := fake.NewSimpleClientset(
+		builder.ForStorageClass("testSC").Provisioner("hostpath").Result(),
+		builder.ForPersistentVolume("testPV").CSI("hostpath", "testVolume").Result(),
+		pvc,
+	)
+
+	// the volumesnapshot of the former execution of the item already has its snapshot handle
+	vscName, handle := "testVSC", "testHandle"
+	snapshotClient := snapshotfake.NewSimpleClientset(
+		builder.ForVolumeSnapshotClass("testVSClass").Driver("hostpath").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "")).Result(),
+		builder.ForVolumeSnapshot("velero", "velero-testPVC-abcde").
+			ObjectMeta(builder.WithLabels(velerov1api.BackupUIDLabel, "backup-uid", velerov1api.PVCUIDLabel, "pvc-uid")).
+			Status().BoundVolumeSnapshotContentName(vscName).Result(),
+		builder.ForVolumeSnapshotContent(vscName).Status(&snapshotv1api.VolumeSnapshotContentStatus{SnapshotHandle: &handle}).Result(),
+	)
+	crClient := velerotest.NewFakeControllerRuntimeClient(t)
+
+	pvcBIA := PVCBackupItemAction{
+		Log:            logrus.New(),
+		Client:         client,
+		SnapshotClient: snapshotClient,
+		CRClient:       crClient,
+	}
+
+	pvcMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pvc)
+	require.NoError(t, err)
+	var dataUploadNames []string
+	var operationIDs []string
+	for i := 0; i < 2; i++ {
+		item, _, operationID, _, err := pvcBIA.Execute(&unstructured.Unstructured{Object: pvcMap}, backup)
+		require.NoError(t, err)
+		dataUploadNames = append(dataUploadNames, item.(*unstructured.Unstructured).GetAnnotations()[util.DataUploadNameAnnotation])
+		operationIDs = append(operationIDs, operationID)
+	}
+	assert.Equal(t, dataUploadNames[0], dataUploadNames[1])
+	assert.Equal(t, operationIDs[0], operationIDs[1])
+
+	dataUploadList := new(velerov2alpha1.DataUploadList)
+	require.NoError(t, crClient.List(context.Background(), dataUploadList))
+	require.Len(t, dataUploadList.Items, 1)
+
+	_, err = getDataUpload(context.Background(), crClient, operationIDs[0])
+	require.NoError(t, err)
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/podexec"
+)
+
+const defaultQuiesceTimeout = 30 * time.Second
+
+// quiesceTarget is a pod frozen before the snapshot, along with what is needed to thaw it.
+type quiesceTarget struct {
+	pod         *corev1api.Pod
+	container   string
+	thawCommand []string
+	timeout     time.Duration
+}
+
+// quiescer freezes the pods using PVCs before their snapshot is created and thaws them once
+// the snapshot is cut. thaw can be called any number of times, so it is safe to defer it.
+type quiescer struct {
+	log      logrus.FieldLogger
+	executor podexec.PodCommandExecutor
+	frozen   []quiesceTarget
+	// level is the weakest consistency level of the PVCs frozen so far, empty while none is.
+	level    string
+	degraded bool
+	timeout  time.Duration
+}
+
+func newQuiescer(executor podexec.PodCommandExecutor, log logrus.FieldLogger) *quiescer {
+	return &quiescer{
+		log:      log,
+		executor: executor,
+	}
+}
+
+// freeze runs the freeze command in the running pods using the PVC which opted in to quiescing. It can be
+// called for several PVCs snapshotted together, the pods of all of them are then thawed together.
+// On failure, the pods frozen so far are thawed and an error is returned, unless the failing pod
+// asked to continue on error, in which case the snapshot is taken crash-consistent and the other pods are still frozen.
+func (q *quiescer) freeze(pods []corev1api.Pod, pvcName string) error {
+	level := ""
+	frozen := false
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1api.PodRunning {
+			q.log.Debugf("Pod %s/%s is not running, not quiescing it", pod.Namespace, pod.Name)
+			continue
+		}
+		if !isQuiesceRequested(pod) {
+			q.log.Infof("Pod %s/%s using PVC %s didn't opt in to quiescing", pod.Namespace, pod.Name, pvcName)
+			level = util.ConsistencyLevelCrash
+			continue
+		}
+
+		target, freezeCommand, podLevel, err := getQuiesceTarget(pod, pvcName)
+		if err == nil && q.isTargetFrozen(target) {
+			// the pod uses another PVC snapshotted together, its custom freeze command already ran
+			frozen = true
+			level = weakerConsistencyLevel(level, podLevel)
+			continue
+		}
+		if err == nil {
+			err = q.exec(target, "freeze", freezeCommand)
+		}
+		if err != nil {
+			if velerov1api.HookErrorMode(pod.Annotations[util.QuiesceOnErrorAnnotation]) == velerov1api.HookErrorModeContinue {
+				q.log.WithError(err).Warnf("Failed to freeze pod %s/%s, the snapshot of PVC %s will be crash-consistent", pod.Namespace, pod.Name, pvcName)
+				q.degraded = true
+				continue
+			}
+			q.thaw()
+			return errors.Wrapf(err, "failed to freeze pod %s/%s", pod.Namespace, pod.Name)
+		}
+
+		q.log.Infof("Froze pod %s/%s using PVC %s", pod.Namespace, pod.Name, pvcName)
+		q.frozen = append(q.frozen, *target)
+		if target.timeout > q.timeout {
+			q.timeout = target.timeout
+		}
+		frozen = true
+		level = weakerConsistencyLevel(level, podLevel)
+	}
+
+	if !frozen {
+		level = util.ConsistencyLevelCrash
+	}
+	q.level = weakerConsistencyLevel(q.level, level)
+	return nil
+}
+
+// isTargetFrozen returns whether the thaw command of the target is already to be run in its pod.
+func (q *quiescer) isTargetFrozen(target *quiesceTarget) bool {
+	for _, frozen := range q.frozen {
+		if frozen.pod.Namespace == target.pod.Namespace && frozen.pod.Name == target.pod.Name &&
+			frozen.container == target.container && strings.Join(frozen.thawCommand, " ") == strings.Join(target.thawCommand, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// thaw runs the thaw command in every frozen pod. A failure is logged and doesn't stop
+// the other pods from being thawed.
+func (q *quiescer) thaw() {
+	for _, target := range q.frozen {
+		if err := q.exec(&target, "thaw", target.thawCommand); err != nil {
+			q.log.WithError(err).Errorf("Failed to thaw pod %s/%s", target.pod.Namespace, target.pod.Name)
+			continue
+		}
+		q.log.Infof("Thawed pod %s/%s", target.pod.Namespace, target.pod.Name)
+	}
+	q.frozen = nil
+}
+
+// isFrozen returns whether any pod is frozen.
+func (q *quiescer) isFrozen() bool {
+	return len(q.frozen) > 0
+}
+
+// degrade records that the snapshot may not have been cut while the pods were frozen.
+func (q *quiescer) degrade(err error) {
+	q.log.WithError(err).Warn("Snapshot was not cut before the quiesce timeout, thawing pods. The snapshot will be crash-consistent")
+	q.degraded = true
+}
+
+// consistencyLevel returns the consistency level of the snapshot of the PVCs frozen, crash-consistent if a freeze
+// failed or the snapshot may not have been cut while the pods were frozen.
+func (q *quiescer) consistencyLevel() string {
+	if q.degraded || q.level == "" {
+		return util.ConsistencyLevelCrash
+	}
+	return q.level
+}
+
+func (q *quiescer) exec(target *quiesceTarget, hookName string, command []string) error {
+	if q.executor == nil {
+		return errors.New("pod command executor is not configured")
+	}
+	podMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(target.pod)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	hook := &velerov1api.ExecHook{
+		Container: target.container,
+		Command:   command,
+		OnError:   velerov1api.HookErrorModeFail,
+		Timeout:   metav1.Duration{Duration: target.timeout},
+	}
+	return q.executor.ExecutePodCommand(q.log, podMap, target.pod.Namespace, target.pod.Name, hookName, hook)
+}
+
+func isQuiesceRequested(pod *corev1api.Pod) bool {
+	if _, ok := pod.Annotations[util.QuiesceFreezeCommandAnnotation]; ok {
+		return true
+	}
+	return pod.Annotations[util.QuiesceFSFreezeAnnotation] == "true"
+}
+
+// getQuiesceTarget returns how to quiesce the pod from its annotations: the custom freeze and thaw
+// commands when set, fsfreeze on the mount path of the PVC otherwise.
+func getQuiesceTarget(pod *corev1api.Pod, pvcName string) (*quiesceTarget, []string, string, error) {
+	target := &quiesceTarget{
+		pod:       pod,
+		container: pod.Annotations[util.QuiesceContainerAnnotation],
+		timeout:   defaultQuiesceTimeout,
+	}
+	if target.container == "" && len(pod.Spec.Containers) > 0 {
+		target.container = pod.Spec.Containers[0].Name
+	}
+	if value, ok := pod.Annotations[util.QuiesceTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, nil, "", errors.Wrapf(err, "invalid value %q for annotation %s", value, util.QuiesceTimeoutAnnotation)
+		}
+		// the timeout bounds the freeze and thaw commands and how long the application stays frozen
+		if timeout <= 0 {
+			return nil, nil, "", errors.Errorf("invalid value %q for annotation %s, the timeout must be positive", value, util.QuiesceTimeoutAnnotation)
+		}
+		target.timeout = timeout
+	}
+
+	if value, ok := pod.Annotations[util.QuiesceFreezeCommandAnnotation]; ok {
+		freezeCommand, err := parseCommand(value)
+		if err != nil {
+			return nil, nil, "", errors.Wrapf(err, "invalid value for annotation %s", util.QuiesceFreezeCommandAnnotation)
+		}
+		thawCommand, err := parseCommand(pod.Annotations[util.QuiesceThawCommandAnnotation])
+		if err != nil {
+			return nil, nil, "", errors.Wrapf(err, "invalid value for annotation %s", util.QuiesceThawCommandAnnotation)
+		}
+		target.thawCommand = thawCommand
+		return target, freezeCommand, util.ConsistencyLevelApplication, nil
+	}
+
+	mountPath, err := getPVCMountPath(pod, target.container, pvcName)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	target.thawCommand = []string{"fsfreeze", "--unfreeze", mountPath}
+	return target, []string{"fsfreeze", "--freeze", mountPath}, util.ConsistencyLevelFilesystem, nil
+}
+
+// getPVCMountPath returns the path the PVC is mounted at in the container of the pod.
+func getPVCMountPath(pod *corev1api.Pod, container, pvcName string) (string, error) {
+	volumeName, err := util.GetPodVolumeNameForPVC(*pod, pvcName)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name != container {
+			continue
+		}
+		for _, m := range c.VolumeMounts {
+			if m.Name == volumeName {
+				return m.MountPath, nil
+			}
+		}
+	}
+	return "", errors.Errorf("container %s of pod %s/%s doesn't mount PVC %s", container, pod.Namespace, pod.Name, pvcName)
+}
+
+// parseCommand parses a command annotation, either a JSON array or a single command.
+func parseCommand(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, errors.New("command is empty")
+	}
+	if !strings.HasPrefix(value, "[") {
+		return []string{value}, nil
+	}
+	var command []string
+	if err := json.Unmarshal([]byte(value), &command); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(command) == 0 {
+		return nil, errors.New("command is empty")
+	}
+	return command, nil
+}
+
+// weakerConsistencyLevel returns the weaker of two consistency levels, an empty level being the strongest.
+func weakerConsistencyLevel(a, b string) string {
+	order := map[string]int{
+		"":                               3,
+		util.ConsistencyLevelApplication: 2,
+		util.ConsistencyLevelFilesystem:  1,
+		util.ConsistencyLevelCrash:       0,
+	}
+	if order[a] < order[b] {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerotest "github.com/vmware-tanzu/velero/pkg/test"
+)
+
+func newQuiescePod(name string, phase corev1.PodPhase, annotations map[string]string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Annotations: annotations},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:         "app",
+					VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "data",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc"},
+					},
+				},
+			},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func expectCommand(executor *velerotest.MockPodCommandExecutor, pod, hookName string, command []string, err error) {
+	executor.On("ExecutePodCommand", mock.Anything, mock.Anything, "ns", pod, hookName,
+		mock.MatchedBy(func(hook *velerov1api.ExecHook) bool {
+			return assert.ObjectsAreEqual(command, hook.Command) && hook.Container == "app"
+		})).Return(err).Once()
+}
+
+func TestQuiesce(t *testing.T) {
+	fsfreeze := map[string]string{util.QuiesceFSFreezeAnnotation: "true"}
+	custom := map[string]string{
+		util.QuiesceFreezeCommandAnnotation: `["/bin/sh", "-c", "db-freeze"]`,
+		util.QuiesceThawCommandAnnotation:   "db-thaw",
+	}
+
+	tests := []struct {
+		name          string
+		pods          []corev1.Pod
+		setup         func(*velerotest.MockPodCommandExecutor)
+		expectedErr   bool
+		expectedLevel string
+	}{
+		{
+			name:          "no pod opted in",
+			pods:          []corev1.Pod{newQuiescePod("pod", corev1.PodRunning, nil)},
+			setup:         func(*velerotest.MockPodCommandExecutor) {},
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+		{
+			name: "custom commands",
+			pods: []corev1.Pod{newQuiescePod("pod", corev1.PodRunning, custom)},
+			setup: func(e *velerotest.MockPodCommandExecutor) {
+				expectCommand(e, "pod", "freeze", []string{"/bin/sh", "-c", "db-freeze"}, nil)
+				expectCommand(e, "pod", "thaw", []string{"db-thaw"}, nil)
+			},
+			expectedLevel: util.ConsistencyLevelApplication,
+		},
+		{
+			name: "fsfreeze on the mount path, pods not running are skipped",
+			pods: []corev1.Pod{
+				newQuiescePod("pod", corev1.PodRunning, fsfreeze),
+				newQuiescePod("pending", corev1.PodPending, custom),
+			},
+			setup: func(e *velerotest.MockPodCommandExecutor) {
+				expectCommand(e, "pod", "freeze", []string{"fsfreeze", "--freeze", "/data"}, nil)
+				expectCommand(e, "pod", "thaw", []string{"fsfreeze", "--unfreeze", "/data"}, nil)
+			},
+			expectedLevel: util.ConsistencyLevelFilesystem,
+		},
+		{
+			name: "a running pod not opted in makes the snapshot crash-consistent",
+			pods: []corev1.Pod{
+				newQuiescePod("pod", corev1.PodRunning, custom),
+				newQuiescePod("other", corev1.PodRunning, nil),
+			},
+			setup: func(e *velerotest.MockPodCommandExecutor) {
+				expectCommand(e, "pod", "freeze", []string{"/bin/sh", "-c", "db-freeze"}, nil)
+				expectCommand(e, "pod", "thaw", []string{"db-thaw"}, nil)
+			},
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+		{
+			name: "failed freeze thaws the frozen pods and fails",
+			pods: []corev1.Pod{
+				newQuiescePod("pod", corev1.PodRunning, custom),
+				newQuiescePod("failing", corev1.PodRunning, fsfreeze),
+			},
+			setup: func(e *velerotest.MockPodCommandExecutor) {
+				expectCommand(e, "pod", "freeze", []string{"/bin/sh", "-c", "db-freeze"}, nil)
+				expectCommand(e, "failing", "freeze", []string{"fsfreeze", "--freeze", "/data"}, errors.New("freeze failed"))
+				expectCommand(e, "pod", "thaw", []string{"db-thaw"}, nil)
+			},
+			expectedErr:   true,
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+		{
+			name: "failed freeze with continue on error degrades to crash-consistent",
+			pods: []corev1.Pod{
+				newQuiescePod("failing", corev1.PodRunning, map[string]string{
+					util.QuiesceFSFreezeAnnotation: "true",
+					util.QuiesceOnErrorAnnotation:  string(velerov1api.HookErrorModeContinue),
+				}),
+			},
+			setup: func(e *velerotest.MockPodCommandExecutor) {
+				expectCommand(e, "failing", "freeze", []string{"fsfreeze", "--freeze", "/data"}, errors.New("freeze failed"))
+			},
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+		{
+			name: "failed freeze with continue on error still freezes the other pods",
+			pods: []corev1.Pod{
+				newQuiescePod("failing", corev1.PodRunning, map[string]string{
+					util.QuiesceFSFreezeAnnotation: "true",
+					util.QuiesceOnErrorAnnotation:  string(velerov1api.HookErrorModeContinue),
+				}),
+				newQuiescePod("pod", corev1.PodRunning, custom),
+			},
+			setup: func(e *velerotest.MockPodCommandExecutor) {
+				expectCommand(e, "failing", "freeze", []string{"fsfreeze", "--freeze", "/data"}, errors.New("freeze failed"))
+				expectCommand(e, "pod", "freeze", []string{"/bin/sh", "-c", "db-freeze"}, nil)
+				expectCommand(e, "pod", "thaw", []string{"db-thaw"}, nil)
+			},
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+		{
+			name: "invalid timeout",
+			pods: []corev1.Pod{
+				newQuiescePod("pod", corev1.PodRunning, map[string]string{
+					util.QuiesceFSFreezeAnnotation: "true",
+					util.QuiesceTimeoutAnnotation:  "forever",
+				}),
+			},
+			setup:         func(*velerotest.MockPodCommandExecutor) {},
+			expectedErr:   true,
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+		{
+			name: "zero timeout",
+			pods: []corev1.Pod{
+				newQuiescePod("pod", corev1.PodRunning, map[string]string{
+					util.QuiesceFSFreezeAnnotation: "true",
+					util.QuiesceTimeoutAnnotation:  "0s",
+				}),
+			},
+			setup:         func(*velerotest.MockPodCommandExecutor) {},
+			expectedErr:   true,
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+		{
+			name: "negative timeout",
+			pods: []corev1.Pod{
+				newQuiescePod("pod", corev1.PodRunning, map[string]string{
+					util.QuiesceFSFreezeAnnotation: "true",
+					util.QuiesceTimeoutAnnotation:  "-1m",
+				}),
+			},
+			setup:         func(*velerotest.MockPodCommandExecutor) {},
+			expectedErr:   true,
+			expectedLevel: util.ConsistencyLevelCrash,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			executor := &velerotest.MockPodCommandExecutor{}
+			tc.setup(executor)
+
+			q := newQuiescer(executor, logrus.New())
+			err := q.freeze(tc.pods, "pvc")
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			q.thaw()
+			// thawing again must not run the thaw commands twice
+			q.thaw()
+
+			assert.Equal(t, tc.expectedLevel, q.consistencyLevel())
+			executor.AssertExpectations(t)
+		})
+	}
+}
+
+func TestQuiesceSeveralPVCs(t *testing.T) {
+	executor := &velerotest.MockPodCommandExecutor{}
+	expectCommand(executor, "db", "freeze", []string{"db-freeze"}, nil)
+	expectCommand(executor, "logs", "freeze", []string{"fsfreeze", "--freeze", "/data"}, nil)
+	expectCommand(executor, "db", "thaw", []string{"db-thaw"}, nil)
+	expectCommand(executor, "logs", "thaw", []string{"fsfreeze", "--unfreeze", "/data"}, nil)
+
+	// the pod using both PVCs is frozen once
+	db := newQuiescePod("db", corev1.PodRunning, map[string]string{
+		util.QuiesceFreezeCommandAnnotation: "db-freeze",
+		util.QuiesceThawCommandAnnotation:   "db-thaw",
+	})
+	db.Spec.Volumes = append(db.Spec.Volumes, corev1.Volume{
+		Name:         "wal",
+		VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "wal"}},
+	})
+	logs := newQuiescePod("logs", corev1.PodRunning, map[string]string{util.QuiesceFSFreezeAnnotation: "true"})
+	logs.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = "wal"
+
+	q := newQuiescer(executor, logrus.New())
+	require.NoError(t, q.freeze([]corev1.Pod{db}, "pvc"))
+	require.NoError(t, q.freeze([]corev1.Pod{db, logs}, "wal"))
+	q.thaw()
+
+	assert.Equal(t, util.ConsistencyLevelFilesystem, q.consistencyLevel())
+	executor.AssertExpectations(t)
+}
+
+func TestQuiesceDegrade(t *testing.T) {
+	executor := &velerotest.MockPodCommandExecutor{}
+	expectCommand(executor, "pod", "freeze", []string{"fsfreeze", "--freeze", "/data"}, nil)
+	expectCommand(executor, "pod", "thaw", []string{"fsfreeze", "--unfreeze", "/data"}, nil)
+
+	q := newQuiescer(executor, logrus.New())
+	require.NoError(t, q.freeze([]corev1.Pod{newQuiescePod("pod", corev1.PodRunning, map[string]string{util.QuiesceFSFreezeAnnotation: "true"})}, "pvc"))
+	assert.True(t, q.isFrozen())
+	assert.Equal(t, defaultQuiesceTimeout, q.timeout)
+
+	q.degrade(errors.New("timed out"))
+	q.thaw()
+	assert.False(t, q.isFrozen())
+	assert.Equal(t, util.ConsistencyLevelCrash, q.consistencyLevel())
+	executor.AssertExpectations(t)
+}
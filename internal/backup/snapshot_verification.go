@@ -0,0 +1,321 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+	storagev1api "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+const (
+	snapshotVerificationVolumeName = "data"
+	snapshotVerificationMountPath  = "/data"
+	snapshotVerificationDevicePath = "/dev/data"
+)
+
+// snapshotVerificationName is the name of the temporary objects verifying the snapshot of the volumesnapshot.
+func snapshotVerificationName(vs *snapshotv1api.VolumeSnapshot) string {
+	return "velero-verify-" + string(vs.UID)
+}
+
+// verifySnapshot provisions a temporary PVC from the snapshot of the volumesnapshot in the backup namespace, and runs
+// the check pod against it if one is configured. It returns the result of the verification with a message telling why
+// it failed, the result is empty while the verification is in progress.
+func (p *VolumeSnapshotBackupItemAction) verifySnapshot(vs *snapshotv1api.VolumeSnapshot, vsc *snapshotv1api.VolumeSnapshotContent,
+	backup *velerov1api.Backup, config *util.SnapshotVerificationConfig) (string, string, error) {
+	name := snapshotVerificationName(vs)
+
+	pvc, err := p.Client.CoreV1().PersistentVolumeClaims(backup.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		var failure string
+		pvc, failure, err = p.createSnapshotVerificationPVC(vs, vsc, backup, config)
+		if err != nil {
+			return "", "", err
+		}
+		if pvc == nil {
+			return util.SnapshotVerificationFailed, failure, nil
+		}
+	} else if err != nil {
+		return "", "", errors.Wrapf(err, "error getting verification PVC %s/%s", backup.Namespace, name)
+	}
+
+	var pod *corev1api.Pod
+	if config.Check != nil {
+		pod, err = p.Client.CoreV1().Pods(backup.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			pod, err = p.Client.CoreV1().Pods(backup.Namespace).Create(context.TODO(), newSnapshotVerificationPod(pvc, config.Check), metav1.CreateOptions{})
+		}
+		if err != nil {
+			return "", "", errors.Wrapf(err, "error getting verification pod %s/%s", backup.Namespace, name)
+		}
+	}
+
+	switch {
+	case pvc.Status.Phase == corev1api.ClaimLost:
+		return util.SnapshotVerificationFailed, fmt.Sprintf("verification PVC %s/%s lost its volume", pvc.Namespace, pvc.Name), nil
+	case pod != nil && pod.Status.Phase == corev1api.PodSucceeded:
+		return util.SnapshotVerificationPassed, "", nil
+	case pod != nil && pod.Status.Phase == corev1api.PodFailed:
+		return util.SnapshotVerificationFailed, fmt.Sprintf("check pod %s/%s failed: %s", pod.Namespace, pod.Name, snapshotVerificationPodFailure(pod)), nil
+	case pod == nil && pvc.Status.Phase == corev1api.ClaimBound:
+		return util.SnapshotVerificationPassed, "", nil
+	}
+
+	if !pvc.CreationTimestamp.IsZero() && time.Since(pvc.CreationTimestamp.Time) > config.Timeout.Duration {
+		if pvc.Status.Phase != corev1api.ClaimBound {
+			return util.SnapshotVerificationFailed, fmt.Sprintf("timed out after %v waiting for verification PVC %s/%s to be bound", config.Timeout.Duration, pvc.Namespace, pvc.Name), nil
+		}
+		return util.SnapshotVerificationFailed, fmt.Sprintf("timed out after %v waiting for check pod %s/%s to complete", config.Timeout.Duration, pod.Namespace, pod.Name), nil
+	}
+	return "", "", nil
+}
+
+// createSnapshotVerificationPVC creates the PVC provisioned from the snapshot, with the volumesnapshot and the statically
+// bound volumesnapshotcontent it is provisioned from. The volumesnapshotcontent retains the snapshot when deleted.
+// nil is returned with the reason if the PVC can't be verified, e.g. its size can't be known.
+func (p *VolumeSnapshotBackupItemAction) createSnapshotVerificationPVC(vs *snapshotv1api.VolumeSnapshot, vsc *snapshotv1api.VolumeSnapshotContent,
+	backup *velerov1api.Backup, config *util.SnapshotVerificationConfig) (*corev1api.PersistentVolumeClaim, string, error) {
+	name := snapshotVerificationName(vs)
+	labels := map[string]string{util.SnapshotVerificationLabel: string(vs.UID)}
+
+	// the verification PVC looks like the snapshotted PVC, if it is still around
+	var sourcePVC *corev1api.PersistentVolumeClaim
+	if vs.Spec.Source.PersistentVolumeClaimName != nil {
+		var err error
+		sourcePVC, err = p.Client.CoreV1().PersistentVolumeClaims(vs.Namespace).Get(context.TODO(), *vs.Spec.Source.PersistentVolumeClaimName, metav1.GetOptions{})
+		if err != nil {
+			p.Log.Warnf("Failed to get PVC %s/%s snapshotted by volumesnapshot %s: %v", vs.Namespace, *vs.Spec.Source.PersistentVolumeClaimName, vs.Name, err)
+			sourcePVC = nil
+		}
+	}
+
+	var size *resource.Quantity
+	if vsc.Status != nil && vsc.Status.RestoreSize != nil {
+		size = resource.NewQuantity(*vsc.Status.RestoreSize, resource.BinarySI)
+	}
+	if sourcePVC != nil {
+		if request, ok := sourcePVC.Spec.Resources.Requests[corev1api.ResourceStorage]; ok && (size == nil || request.Cmp(*size) > 0) {
+			size = &request
+		}
+	}
+	if size == nil {
+		return nil, "the size of the snapshot is unknown", nil
+	}
+
+	apiGroup := snapshotv1api.GroupName
+	pvc := &corev1api.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1api.PersistentVolumeClaimSpec{
+			AccessModes: []corev1api.PersistentVolumeAccessMode{corev1api.ReadWriteOnce},
+			DataSource: &corev1api.TypedLocalObjectReference{
+				APIGroup: &apiGroup,
+				Kind:     util.VolumeSnapshotKindName,
+				Name:     name,
+			},
+			Resources: corev1api.VolumeResourceRequirements{
+				Requests: corev1api.ResourceList{corev1api.ResourceStorage: *size},
+			},
+		},
+	}
+	if sourcePVC != nil {
+		pvc.Spec.AccessModes = sourcePVC.Spec.AccessModes
+		pvc.Spec.StorageClassName = sourcePVC.Spec.StorageClassName
+		pvc.Spec.VolumeMode = sourcePVC.Spec.VolumeMode
+	}
+	if config.StorageClassName != "" {
+		pvc.Spec.StorageClassName = &config.StorageClassName
+	}
+	if vsc.Spec.SourceVolumeMode != nil {
+		pvc.Spec.VolumeMode = vsc.Spec.SourceVolumeMode
+	}
+
+	// Without a check nothing consumes the PVC, so a volume bound on its first consumer would never be provisioned.
+	if config.Check == nil && (pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != "") {
+		storageClassName := ""
+		if pvc.Spec.StorageClassName != nil {
+			storageClassName = *pvc.Spec.StorageClassName
+		}
+		storageClass, err := util.GetStorageClassOrDefault(storageClassName, p.Client.StorageV1())
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, "", err
+		}
+		if storageClass != nil && storageClass.VolumeBindingMode != nil && *storageClass.VolumeBindingMode == storagev1api.VolumeBindingWaitForFirstConsumer {
+			return nil, fmt.Sprintf("storage class %s binds volumes on their first consumer, the verification PVC is only bound with a check set in %s of the plugin config",
+				storageClass.Name, util.SnapshotVerificationConfigKey), nil
+		}
+	}
+
+	verificationVSC := &snapshotv1api.VolumeSnapshotContent{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: snapshotv1api.VolumeSnapshotContentSpec{
+			DeletionPolicy: snapshotv1api.VolumeSnapshotContentRetain,
+			Driver:         vsc.Spec.Driver,
+			VolumeSnapshotRef: corev1api.ObjectReference{
+				Kind:      util.VolumeSnapshotKindName,
+				Namespace: backup.Namespace,
+				Name:      name,
+			},
+			Source: snapshotv1api.VolumeSnapshotContentSource{
+				SnapshotHandle: vsc.Status.SnapshotHandle,
+			},
+			VolumeSnapshotClassName: vsc.Spec.VolumeSnapshotClassName,
+			SourceVolumeMode:        vsc.Spec.SourceVolumeMode,
+		},
+	}
+	if _, err := p.SnapshotClient.SnapshotV1().VolumeSnapshotContents().Create(context.TODO(), verificationVSC, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, "", errors.Wrapf(err, "error creating verification volumesnapshotcontent %s", name)
+	}
+
+	verificationVS := &snapshotv1api.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: snapshotv1api.VolumeSnapshotSpec{
+			Source: snapshotv1api.VolumeSnapshotSource{
+				VolumeSnapshotContentName: &name,
+			},
+			VolumeSnapshotClassName: vsc.Spec.VolumeSnapshotClassName,
+		},
+	}
+	if _, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(backup.Namespace).Create(context.TODO(), verificationVS, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, "", errors.Wrapf(err, "error creating verification volumesnapshot %s/%s", backup.Namespace, name)
+	}
+
+	created, err := p.Client.CoreV1().PersistentVolumeClaims(backup.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "error creating verification PVC %s/%s", backup.Namespace, name)
+	}
+	p.Log.Infof("Created PVC %s/%s to verify the snapshot of volumesnapshot %s/%s", created.Namespace, created.Name, vs.Namespace, vs.Name)
+	return created, "", nil
+}
+
+// newSnapshotVerificationPod returns the pod running the check against the verification PVC.
+func newSnapshotVerificationPod(pvc *corev1api.PersistentVolumeClaim, check *util.SnapshotVerificationCheck) *corev1api.Pod {
+	container := corev1api.Container{
+		Name:    "verify",
+		Image:   check.Image,
+		Command: check.Command,
+	}
+	if pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == corev1api.PersistentVolumeBlock {
+		container.VolumeDevices = []corev1api.VolumeDevice{{Name: snapshotVerificationVolumeName, DevicePath: snapshotVerificationDevicePath}}
+	} else {
+		container.VolumeMounts = []corev1api.VolumeMount{{Name: snapshotVerificationVolumeName, MountPath: snapshotVerificationMountPath, ReadOnly: true}}
+	}
+
+	return &corev1api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvc.Name,
+			Namespace: pvc.Namespace,
+			Labels:    pvc.Labels,
+		},
+		Spec: corev1api.PodSpec{
+			RestartPolicy: corev1api.RestartPolicyNever,
+			Containers:    []corev1api.Container{container},
+			Volumes: []corev1api.Volume{{
+				Name: snapshotVerificationVolumeName,
+				VolumeSource: corev1api.VolumeSource{
+					PersistentVolumeClaim: &corev1api.PersistentVolumeClaimVolumeSource{ClaimName: pvc.Name},
+				},
+			}},
+		},
+	}
+}
+
+// snapshotVerificationPodFailure tells why the check pod failed.
+func snapshotVerificationPodFailure(pod *corev1api.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			if terminated.Message != "" {
+				return fmt.Sprintf("exit code %d: %s", terminated.ExitCode, terminated.Message)
+			}
+			return fmt.Sprintf("exit code %d", terminated.ExitCode)
+		}
+	}
+	if pod.Status.Message != "" {
+		return pod.Status.Message
+	}
+	return pod.Status.Reason
+}
+
+// recordSnapshotVerification records the result of the verification on the volumesnapshot, so it is in the backup
+// once the volumesnapshot is updated when the backup is finalized.
+func (p *VolumeSnapshotBackupItemAction) recordSnapshotVerification(vs *snapshotv1api.VolumeSnapshot, result, message string) error {
+	annotations := map[string]interface{}{util.SnapshotVerificationAnnotation: result}
+	if message != "" {
+		annotations[util.SnapshotVerificationMessageAnnotation] = message
+	}
+	pb, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(vs.Namespace).Patch(context.TODO(), vs.Name, types.MergePatchType, pb, metav1.PatchOptions{}); err != nil {
+		return errors.Wrapf(err, "error recording the snapshot verification on volumesnapshot %s/%s", vs.Namespace, vs.Name)
+	}
+	return nil
+}
+
+// cleanupSnapshotVerification deletes the temporary objects verifying the snapshot of the volumesnapshot, if any.
+// The snapshot itself is retained by the verification volumesnapshotcontent.
+func (p *VolumeSnapshotBackupItemAction) cleanupSnapshotVerification(vs *snapshotv1api.VolumeSnapshot, backup *velerov1api.Backup) {
+	name := snapshotVerificationName(vs)
+	propagation := metav1.DeletePropagationBackground
+	options := metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	deletions := []struct {
+		kind   string
+		delete func() error
+	}{
+		{"pod", func() error { return p.Client.CoreV1().Pods(backup.Namespace).Delete(context.TODO(), name, options) }},
+		{"PVC", func() error {
+			return p.Client.CoreV1().PersistentVolumeClaims(backup.Namespace).Delete(context.TODO(), name, options)
+		}},
+		{"volumesnapshot", func() error {
+			return p.SnapshotClient.SnapshotV1().VolumeSnapshots(backup.Namespace).Delete(context.TODO(), name, options)
+		}},
+		{"volumesnapshotcontent", func() error {
+			return p.SnapshotClient.SnapshotV1().VolumeSnapshotContents().Delete(context.TODO(), name, options)
+		}},
+	}
+	for _, deletion := range deletions {
+		if err := deletion.delete(); err != nil && !apierrors.IsNotFound(err) {
+			p.Log.Warnf("Failed to delete verification %s %s of volumesnapshot %s/%s: %v", deletion.kind, name, vs.Namespace, vs.Name, err)
+		}
+	}
+}
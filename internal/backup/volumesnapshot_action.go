@@ -18,33 +18,36 @@ package backup
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
 	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	"github.com/vmware-tanzu/velero/pkg/kuberesource"
 	"github.com/vmware-tanzu/velero/pkg/label"
 	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
-	biav2 "github.com/vmware-tanzu/velero/pkg/plugin/velero/backupitemaction/v2"
 	"github.com/vmware-tanzu/velero/pkg/util/boolptr"
 )
 
 // VolumeSnapshotBackupItemAction is a backup item action plugin to backup
 // CSI VolumeSnapshot objects using Velero
 type VolumeSnapshotBackupItemAction struct {
-	Log logrus.FieldLogger
+	Log            logrus.FieldLogger
+	Client         kubernetes.Interface
+	SnapshotClient snapshotterClientSet.Interface
 }
 
 // AppliesTo returns information indicating that the VolumeSnapshotBackupItemAction should be invoked to backup volumesnapshots.
@@ -67,16 +70,13 @@ func (p *VolumeSnapshotBackupItemAction) Execute(item runtime.Unstructured, back
 		return nil, nil, "", nil, errors.WithStack(err)
 	}
 
-	_, snapshotClient, err := util.GetClients()
-	if err != nil {
-		return nil, nil, "", nil, errors.WithStack(err)
-	}
-
-	additionalItems := []velero.ResourceIdentifier{
-		{
+	additionalItems := []velero.ResourceIdentifier{}
+	// The member volumesnapshots of a volumegroupsnapshot don't reference a volumesnapshotclass.
+	if vs.Spec.VolumeSnapshotClassName != nil {
+		additionalItems = append(additionalItems, velero.ResourceIdentifier{
 			GroupResource: kuberesource.VolumeSnapshotClasses,
 			Name:          *vs.Spec.VolumeSnapshotClassName,
-		},
+		})
 	}
 
 	// determine if we are backing up a volumesnapshot that was created by velero while performing backup of a
@@ -95,16 +95,34 @@ func (p *VolumeSnapshotBackupItemAction) Execute(item runtime.Unstructured, back
 
 	p.Log.Infof("Getting VolumesnapshotContent for Volumesnapshot %s/%s", vs.Namespace, vs.Name)
 
-	vsc, err := util.GetVolumeSnapshotContentForVolumeSnapshot(&vs, snapshotClient.SnapshotV1(), p.Log, backupOngoing, backup.Spec.CSISnapshotTimeout.Duration)
+	classifier, err := p.getSnapshotErrorClassifier(backup)
 	if err != nil {
-		util.CleanupVolumeSnapshot(&vs, snapshotClient.SnapshotV1(), p.Log)
+		return nil, nil, "", nil, errors.WithStack(err)
+	}
+
+	vsc, err := util.GetVolumeSnapshotContentForVolumeSnapshot(&vs, p.SnapshotClient.SnapshotV1(), classifier, p.Log, backupOngoing, backup.Spec.CSISnapshotTimeout.Duration)
+	if err != nil {
+		// volumesnapshots created outside of velero are owned by the user, never delete them
+		if backupOngoing {
+			util.CleanupVolumeSnapshot(&vs, p.SnapshotClient.SnapshotV1(), p.Log)
+		}
 		return nil, nil, "", nil, errors.WithStack(err)
 	}
 
 	if backup.Status.Phase == velerov1api.BackupPhaseFinalizing || backup.Status.Phase == velerov1api.BackupPhaseFinalizingPartiallyFailed {
+		if !backupOngoing || vsc == nil {
+			p.Log.WithField("Backup", fmt.Sprintf("%s/%s", backup.Namespace, backup.Name)).
+				WithField("BackupPhase", backup.Status.Phase).Debugf("Volumesnapshot %s/%s was not created by the backup, not cleaning it.", vs.Namespace, vs.Name)
+			return item, nil, "", nil, nil
+		}
 		p.Log.WithField("Backup", fmt.Sprintf("%s/%s", backup.Namespace, backup.Name)).
 			WithField("BackupPhase", backup.Status.Phase).Debugf("Clean VolumeSnapshots.")
-		util.DeleteVolumeSnapshot(vs, *vsc, backup, snapshotClient.SnapshotV1(), p.Log)
+		// the verification of the snapshot may have been interrupted, e.g. by the backup being canceled
+		p.cleanupSnapshotVerification(&vs, backup)
+		util.DeleteVolumeSnapshot(vs, *vsc, backup, p.SnapshotClient.SnapshotV1(), p.Log)
+		if vgsName, ok := vs.Labels[util.VolumeGroupSnapshotLabel]; ok {
+			util.CleanupVolumeGroupSnapshot(vs.Namespace, vgsName, p.SnapshotClient, p.Log)
+		}
 		return item, nil, "", nil, nil
 	}
 
@@ -120,18 +138,13 @@ func (p *VolumeSnapshotBackupItemAction) Execute(item runtime.Unstructured, back
 			GroupResource: kuberesource.VolumeSnapshotContents,
 			Name:          vsc.Name,
 		})
-		annotations[util.CSIVSCDeletionPolicy] = string(vsc.Spec.DeletionPolicy)
-
-		if vsc.Status != nil {
-			if vsc.Status.SnapshotHandle != nil {
-				// Capture storage provider snapshot handle and CSI driver name
-				// to be used on restore to create a static volumesnapshotcontent that will be the source of the volumesnapshot.
-				annotations[util.VolumeSnapshotHandleAnnotation] = *vsc.Status.SnapshotHandle
-				annotations[util.CSIDriverNameAnnotation] = vsc.Spec.Driver
-			}
-			if vsc.Status.RestoreSize != nil {
-				annotations[util.VolumeSnapshotRestoreSize] = resource.NewQuantity(*vsc.Status.RestoreSize, resource.BinarySI).String()
-			}
+
+		// Capture the storage provider snapshot handle, the CSI driver name and the volumesnapshotclass
+		// to be used on restore to create a static volumesnapshotcontent that will be the source of the volumesnapshot.
+		metadata := util.NewVolumeSnapshotMetadata(vsc, p.getVolumeSnapshotClass(&vs))
+		metadata.UserCreated = !backupOngoing
+		if annotations, err = metadata.Annotations(); err != nil {
+			return nil, nil, "", nil, errors.WithStack(err)
 		}
 
 		if backupOngoing {
@@ -148,31 +161,40 @@ func (p *VolumeSnapshotBackupItemAction) Execute(item runtime.Unstructured, back
 			// Further, we want to add this label only on volumesnapshotcontents that were created during an ongoing velero backup.
 
 			pb := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":"%s"}}}`, velerov1api.BackupNameLabel, label.GetValidName(backup.Name)))
-			if _, vscPatchError := snapshotClient.SnapshotV1().VolumeSnapshotContents().Patch(context.TODO(), vsc.Name, types.MergePatchType, pb, metav1.PatchOptions{}); vscPatchError != nil {
+			if _, vscPatchError := p.SnapshotClient.SnapshotV1().VolumeSnapshotContents().Patch(context.TODO(), vsc.Name, types.MergePatchType, pb, metav1.PatchOptions{}); vscPatchError != nil {
 				p.Log.Warnf("Failed to patch volumesnapshotcontent %s: %v", vsc.Name, vscPatchError)
 			}
 		}
 	}
 
-	// Before applying the BIA v2, the in-cluster VS state is not persisted into backup.
-	// After the change, because the final state of VS will be stored in backup as the
-	// result of async operation result, need to patch the annotations into VS to work,
-	// because restore will check the annotations information.
-	pb := "{\"metadata\":{\"annotations\":{"
-	for k, v := range annotations {
-		pb += fmt.Sprintf("\"%s\":\"%s\",", k, v)
+	if !backupOngoing && (vsc == nil || vsc.Status == nil || vsc.Status.SnapshotHandle == nil) {
+		// The volumesnapshot can't be restored without a snapshot, it's backed up as is and skipped on restore.
+		p.Log.Warnf("Volumesnapshot %s/%s is not bound to a snapshot yet, it won't be restored", vs.Namespace, vs.Name)
+		annotations = map[string]string{util.SkippedUnboundVolumeSnapshotAnnotation: "true"}
 	}
-	pb = strings.Trim(pb, ",")
-	pb += "}}}"
-	if _, err := snapshotClient.SnapshotV1().VolumeSnapshots(vs.Namespace).Patch(context.TODO(),
-		vs.Name, types.MergePatchType, []byte(pb), metav1.PatchOptions{}); err != nil {
-		p.Log.Errorf("Fail to patch volumesnapshot with content %s: %s.", pb, err.Error())
-		return nil, nil, "", nil, errors.WithStack(err)
+
+	if backupOngoing {
+		// Before applying the BIA v2, the in-cluster VS state is not persisted into backup.
+		// After the change, because the final state of VS will be stored in backup as the
+		// result of async operation result, need to patch the annotations into VS to work,
+		// because restore will check the annotations information.
+		// The volumesnapshots created outside of velero are backed up right away, they are left untouched.
+		pb, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+		if err != nil {
+			return nil, nil, "", nil, errors.WithStack(err)
+		}
+		if _, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(vs.Namespace).Patch(context.TODO(),
+			vs.Name, types.MergePatchType, pb, metav1.PatchOptions{}); err != nil {
+			p.Log.Errorf("Fail to patch volumesnapshot with content %s: %s.", pb, err.Error())
+			return nil, nil, "", nil, errors.WithStack(err)
+		}
 	}
 
 	annotations[util.MustIncludeAdditionalItemAnnotation] = "true"
 	// save newly applied annotations into the backed-up volumesnapshot item
 	util.AddAnnotations(&vs.ObjectMeta, annotations)
+	// the snapshot slot only matters in the cluster the backup is taken in
+	delete(vs.Labels, util.VolumeSnapshotInFlightLabel)
 
 	vsMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&vs)
 	if err != nil {
@@ -189,8 +211,10 @@ func (p *VolumeSnapshotBackupItemAction) Execute(item runtime.Unstructured, back
 
 	// Only return Async operation for VSC created for this backup.
 	if backupOngoing {
-		// The operationID is of the form <namespace>/<volumesnapshot-name>/<started-time>
-		operationID = vs.Namespace + "/" + vs.Name + "/" + time.Now().Format(time.RFC3339)
+		operationID, err = newVolumeSnapshotOperationID(&vs, backup)
+		if err != nil {
+			return nil, nil, "", nil, errors.WithStack(err)
+		}
 		itemToUpdate = []velero.ResourceIdentifier{
 			{
 				GroupResource: kuberesource.VolumeSnapshots,
@@ -213,83 +237,215 @@ func (p *VolumeSnapshotBackupItemAction) Name() string {
 
 func (p *VolumeSnapshotBackupItemAction) Progress(operationID string, backup *velerov1api.Backup) (velero.OperationProgress, error) {
 	progress := velero.OperationProgress{}
-	if operationID == "" {
-		return progress, biav2.InvalidOperationIDError(operationID)
-	}
-	// The operationID is of the form <namespace>/<volumesnapshot-name>/<started-time>
-	operationIDParts := strings.Split(operationID, "/")
-	if len(operationIDParts) != 3 {
-		p.Log.Errorf("invalid operation ID %s", operationID)
-		return progress, biav2.InvalidOperationIDError(operationID)
-	}
-	var err error
-	if progress.Started, err = time.Parse(time.RFC3339, operationIDParts[2]); err != nil {
-		p.Log.Errorf("error parsing operation ID's StartedTime part into time %s: %s", operationID, err.Error())
-		return progress, errors.WithStack(err)
-	}
-
-	_, snapshotClient, err := util.GetClients()
+	operation, err := parseVolumeSnapshotOperationID(operationID, p.Log)
 	if err != nil {
-		return progress, errors.WithStack(err)
+		return progress, err
 	}
+	progress.Started = operation.Started
 
-	vs, err := snapshotClient.SnapshotV1().VolumeSnapshots(operationIDParts[0]).Get(
-		context.Background(), operationIDParts[1], metav1.GetOptions{})
+	vs, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(operation.Namespace).Get(
+		context.Background(), operation.Name, metav1.GetOptions{})
 	if err != nil {
-		p.Log.Errorf("error getting volumesnapshot %s/%s: %s", operationIDParts[0], operationIDParts[1], err.Error())
+		p.Log.Errorf("error getting volumesnapshot %s/%s: %s", operation.Namespace, operation.Name, err.Error())
 		return progress, errors.WithStack(err)
 	}
+	if err := operation.verify(vs, backup); err != nil {
+		p.Log.Error(err)
+		return progress, err
+	}
+
+	now := time.Now()
+	progress.Updated = now
+	progress.OperationUnits = snapshotProgressUnits
 
 	if vs.Status == nil {
 		p.Log.Debugf("VolumeSnapshot %s/%s has an empty status. Skip progress update.", vs.Namespace, vs.Name)
+		setSnapshotProgressDescription(&progress, "Waiting for volumesnapshotcontent", now)
 		return progress, nil
 	}
+	setSnapshotProgressSize(&progress, vs.Status.RestoreSize)
 
 	if boolptr.IsSetToTrue(vs.Status.ReadyToUse) {
 		p.Log.Debugf("VolumeSnapshot %s/%s is ReadyToUse. Continue on querying corresponding VolumeSnapshotContent.",
 			vs.Namespace, vs.Name)
 	} else if vs.Status.Error != nil {
-		errorMessage := ""
-		if vs.Status.Error.Message != nil {
-			errorMessage = *vs.Status.Error.Message
+		classifier, err := p.getSnapshotErrorClassifier(backup)
+		if err != nil {
+			return progress, errors.WithStack(err)
+		}
+		category, errorMessage, _ := classifier.ClassifyVolumeSnapshotError(p.getVolumeSnapshotDriver(vs), vs.Status.Error)
+		if category == util.SnapshotErrorFatal {
+			p.Log.Warnf("VolumeSnapshot %s/%s has a %s error %s.", vs.Namespace, vs.Name, category, errorMessage)
+			progress.Completed = true
+			progress.Err = errorMessage
+			setSnapshotProgressDescription(&progress, fmt.Sprintf("Failed with %s error: %s", category, errorMessage), now)
+			util.ReleaseSnapshotSlot(vs, p.SnapshotClient.SnapshotV1(), p.Log)
+			return progress, nil
 		}
-		p.Log.Warnf("VolumeSnapshot has a temporary error %s. Snapshot controller will retry later.", errorMessage)
+		p.Log.Warnf("VolumeSnapshot %s/%s has a %s error %s. Snapshot controller will retry later.", vs.Namespace, vs.Name, category, errorMessage)
+		setSnapshotProgressDescription(&progress, fmt.Sprintf("%s error, retrying: %s", category, errorMessage), now)
 
 		return progress, nil
 	}
 
-	if vs.Status != nil && vs.Status.BoundVolumeSnapshotContentName != nil {
-		vsc, err := snapshotClient.SnapshotV1().VolumeSnapshotContents().Get(
-			context.Background(), *vs.Status.BoundVolumeSnapshotContentName, metav1.GetOptions{})
+	if vs.Status.BoundVolumeSnapshotContentName == nil {
+		setSnapshotProgressDescription(&progress, "Waiting for volumesnapshotcontent", now)
+		return progress, nil
+	}
+
+	vsc, err := p.SnapshotClient.SnapshotV1().VolumeSnapshotContents().Get(
+		context.Background(), *vs.Status.BoundVolumeSnapshotContentName, metav1.GetOptions{})
+	if err != nil {
+		p.Log.Errorf("error getting VolumeSnapshotContent %s: %s", *vs.Status.BoundVolumeSnapshotContentName, err.Error())
+		return progress, errors.WithStack(err)
+	}
+
+	if vsc.Status == nil {
+		p.Log.Debugf("VolumeSnapshotContent %s has an empty Status. Skip progress update.", vsc.Name)
+		setSnapshotProgressDescription(&progress, "Waiting for snapshot handle", now)
+		return progress, nil
+	}
+	if vsc.Status.RestoreSize != nil {
+		setSnapshotProgressSize(&progress, resource.NewQuantity(*vsc.Status.RestoreSize, resource.BinarySI))
+	}
+
+	if boolptr.IsSetToTrue(vsc.Status.ReadyToUse) {
+		progress.NCompleted = progress.NTotal
+		// The snapshot is no longer in flight while it is verified.
+		util.ReleaseSnapshotSlot(vs, p.SnapshotClient.SnapshotV1(), p.Log)
+		if err := p.progressSnapshotVerification(&progress, vs, vsc, backup, now); err != nil {
+			return progress, err
+		}
+	} else if vsc.Status.Error != nil {
+		classifier, err := p.getSnapshotErrorClassifier(backup)
 		if err != nil {
-			p.Log.Errorf("error getting VolumeSnapshotContent %s: %s", *vs.Status.BoundVolumeSnapshotContentName, err.Error())
 			return progress, errors.WithStack(err)
 		}
-
-		if vsc.Status == nil {
-			p.Log.Debugf("VolumeSnapshotContent %s has an empty Status. Skip progress update.", vsc.Name)
-			return progress, nil
+		category, errorMessage, _ := classifier.ClassifyVolumeSnapshotContentError(vsc)
+		if category == util.SnapshotErrorFatal {
+			progress.Completed = true
+			progress.Err = errorMessage
+			p.Log.Warnf("VolumeSnapshotContent meets a %s error %s.", category, errorMessage)
+			setSnapshotProgressDescription(&progress, fmt.Sprintf("Failed with %s error: %s", category, errorMessage), now)
+		} else {
+			p.Log.Warnf("VolumeSnapshotContent %s has a %s error %s. Snapshot controller will retry later.", vsc.Name, category, errorMessage)
+			setSnapshotProgressDescription(&progress, fmt.Sprintf("%s error, retrying: %s", category, errorMessage), now)
 		}
+	} else if vsc.Status.SnapshotHandle == nil {
+		setSnapshotProgressDescription(&progress, "Waiting for snapshot handle", now)
+	} else {
+		setSnapshotProgressDescription(&progress, "Waiting for snapshot to be ready to use", now)
+	}
+
+	if progress.Completed {
+		// The snapshot is no longer in flight, let the next PVC waiting for a snapshot slot take it.
+		util.ReleaseSnapshotSlot(vs, p.SnapshotClient.SnapshotV1(), p.Log)
+	}
 
-		now := time.Now()
+	return progress, nil
+}
 
-		if boolptr.IsSetToTrue(vsc.Status.ReadyToUse) {
-			progress.Completed = true
-			progress.Updated = now
-		} else if vsc.Status.Error != nil {
-			progress.Completed = true
-			progress.Updated = now
-			if vsc.Status.Error.Message != nil {
-				progress.Err = *vsc.Status.Error.Message
-			}
-			p.Log.Warnf("VolumeSnapshotContent meets an error %s.", progress.Err)
+// progressSnapshotVerification completes the progress of the ready snapshot once it is verified, if the verification is enabled.
+func (p *VolumeSnapshotBackupItemAction) progressSnapshotVerification(progress *velero.OperationProgress, vs *snapshotv1api.VolumeSnapshot,
+	vsc *snapshotv1api.VolumeSnapshotContent, backup *velerov1api.Backup, now time.Time) error {
+	config, err := util.GetPVCBackupPluginConfig(backup.Namespace, p.Client.CoreV1())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	verification, err := util.ParseSnapshotVerificationConfig(config)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	result, message := vs.Annotations[util.SnapshotVerificationAnnotation], vs.Annotations[util.SnapshotVerificationMessageAnnotation]
+	if verification == nil && result == "" {
+		progress.Completed = true
+		setSnapshotProgressDescription(progress, "Ready", now)
+		return nil
+	}
+
+	if result == "" {
+		if result, message, err = p.verifySnapshot(vs, vsc, backup, verification); err != nil {
+			return errors.WithStack(err)
+		}
+		if result == "" {
+			setSnapshotProgressDescription(progress, "Verifying snapshot", now)
+			return nil
+		}
+		p.Log.Infof("Verification of the snapshot of volumesnapshot %s/%s: %s %s", vs.Namespace, vs.Name, result, message)
+		if err := p.recordSnapshotVerification(vs, result, message); err != nil {
+			return err
 		}
 	}
+	p.cleanupSnapshotVerification(vs, backup)
+
+	progress.Completed = true
+	if result == util.SnapshotVerificationFailed {
+		progress.Err = "snapshot verification failed: " + message
+		setSnapshotProgressDescription(progress, "Verification failed: "+message, now)
+	} else {
+		setSnapshotProgressDescription(progress, "Ready, verified", now)
+	}
+	return nil
+}
 
-	return progress, nil
+// getSnapshotErrorClassifier returns the classifier of snapshot errors with the patterns of the plugin config.
+func (p *VolumeSnapshotBackupItemAction) getSnapshotErrorClassifier(backup *velerov1api.Backup) (*util.SnapshotErrorClassifier, error) {
+	config, err := util.GetPVCBackupPluginConfig(backup.Namespace, p.Client.CoreV1())
+	if err != nil {
+		return nil, err
+	}
+	return util.NewSnapshotErrorClassifier(config)
+}
+
+// getVolumeSnapshotDriver returns the CSI driver of the volumesnapshotclass of the volumesnapshot, or an empty string if it can't be found.
+func (p *VolumeSnapshotBackupItemAction) getVolumeSnapshotDriver(vs *snapshotv1api.VolumeSnapshot) string {
+	if class := p.getVolumeSnapshotClass(vs); class != nil {
+		return class.Driver
+	}
+	return ""
 }
 
+// getVolumeSnapshotClass returns the volumesnapshotclass of the volumesnapshot, or nil if it can't be found.
+func (p *VolumeSnapshotBackupItemAction) getVolumeSnapshotClass(vs *snapshotv1api.VolumeSnapshot) *snapshotv1api.VolumeSnapshotClass {
+	if vs.Spec.VolumeSnapshotClassName == nil {
+		return nil
+	}
+	class, err := p.SnapshotClient.SnapshotV1().VolumeSnapshotClasses().Get(context.TODO(), *vs.Spec.VolumeSnapshotClassName, metav1.GetOptions{})
+	if err != nil {
+		p.Log.Debugf("Failed to get volumesnapshotclass %s of volumesnapshot %s/%s: %v", *vs.Spec.VolumeSnapshotClassName, vs.Namespace, vs.Name, err)
+		return nil
+	}
+	return class
+}
+
+// snapshotProgressUnits are the units of the progress of snapshot operations, which is the restore size of the snapshot.
+const snapshotProgressUnits = "Bytes"
+
+// setSnapshotProgressSize sets the restore size of the snapshot, when known, as the total of the progress.
+func setSnapshotProgressSize(progress *velero.OperationProgress, restoreSize *resource.Quantity) {
+	if restoreSize != nil {
+		progress.NTotal = restoreSize.Value()
+	}
+}
+
+// setSnapshotProgressDescription sets the description of the progress, with the time elapsed since the operation started.
+func setSnapshotProgressDescription(progress *velero.OperationProgress, description string, now time.Time) {
+	progress.Description = fmt.Sprintf("%s (elapsed %s)", description, now.Sub(progress.Started).Truncate(time.Second))
+}
+
+// Cancel deletes the volumesnapshot of the operation along with its volumesnapshotcontent and the snapshot in the storage provider.
+// CSI Specification doesn't support canceling a snapshot creation, so the snapshot is deleted once created.
 func (p *VolumeSnapshotBackupItemAction) Cancel(operationID string, backup *velerov1api.Backup) error {
-	// CSI Specification doesn't support canceling a snapshot creation.
-	return nil
+	operation, err := parseVolumeSnapshotOperationID(operationID, p.Log)
+	if err != nil {
+		return err
+	}
+
+	vs, err := p.SnapshotClient.SnapshotV1().VolumeSnapshots(operation.Namespace).Get(context.TODO(), operation.Name, metav1.GetOptions{})
+	if err == nil && operation.verify(vs, backup) == nil {
+		p.cleanupSnapshotVerification(vs, backup)
+	}
+
+	return util.CancelVolumeSnapshot(operation.Namespace, operation.Name, operation.UID, p.SnapshotClient.SnapshotV1(), p.Log, util.GetResourceTimeout(backup, p.Log))
 }
@@ -0,0 +1,476 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotfake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+	storagev1api "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+	"github.com/vmware-tanzu/velero/pkg/util/boolptr"
+)
+
+func TestVolumeSnapshotProgress(t *testing.T) {
+	started := time.Now().Add(-90 * time.Second).Truncate(time.Second)
+	operationID := "ns/vs/" + started.Format(time.RFC3339)
+	restoreSize := int64(1 << 30)
+	handle := "handle"
+	vsError := "rate limited"
+	vscQuotaError := "quota exceeded"
+	vscFatalError := "invalid snapshot parameters"
+	vsFatalError := "volumesnapshotclass not found"
+	driverError := "SnapshotCreationPerVolumeRateExceeded"
+	pluginConfig := builder.ForConfigMap("velero", "config").
+		ObjectMeta(builder.WithLabels("velero.io/plugin-config", "", "velero.io/csi-pvc-backupper", "BackupItemAction")).
+		Data(util.SnapshotErrorPatternsConfigKey, "drivers:\n  hostpath.csi.k8s.io:\n    fatal: [\"PerVolumeRateExceeded\"]").Result()
+	driverErrorVSC := builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{
+		Error: &snapshotv1api.VolumeSnapshotError{Message: &driverError},
+	}).Result()
+	driverErrorVSC.Spec.Driver = "hostpath.csi.k8s.io"
+
+	tests := []struct {
+		name                string
+		objs                []runtime.Object
+		kubeObjs            []runtime.Object
+		expectedCompleted   bool
+		expectedErr         string
+		expectedNCompleted  int64
+		expectedNTotal      int64
+		expectedDescription string
+	}{
+		{
+			name:                "volumesnapshot not reconciled yet",
+			objs:                []runtime.Object{builder.ForVolumeSnapshot("ns", "vs").Result()},
+			expectedDescription: "Waiting for volumesnapshotcontent (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshot has a transient error",
+			objs: []runtime.Object{&snapshotv1api.VolumeSnapshot{
+				ObjectMeta: builder.ForVolumeSnapshot("ns", "vs").Result().ObjectMeta,
+				Status: &snapshotv1api.VolumeSnapshotStatus{
+					Error: &snapshotv1api.VolumeSnapshotError{Message: &vsError},
+				},
+			}},
+			expectedDescription: "Retryable error, retrying: rate limited (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshotcontent has no snapshot handle",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{}).Result(),
+			},
+			expectedDescription: "Waiting for snapshot handle (elapsed 1m30s)",
+		},
+		{
+			name: "snapshot is cut but not ready",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{
+					SnapshotHandle: &handle,
+					RestoreSize:    &restoreSize,
+				}).Result(),
+			},
+			expectedNTotal:      restoreSize,
+			expectedDescription: "Waiting for snapshot to be ready to use (elapsed 1m30s)",
+		},
+		{
+			name: "snapshot is ready",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").RestoreSize("1Gi").Result(),
+				builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{
+					SnapshotHandle: &handle,
+					ReadyToUse:     boolptr.True(),
+				}).Result(),
+			},
+			expectedCompleted:   true,
+			expectedNCompleted:  restoreSize,
+			expectedNTotal:      restoreSize,
+			expectedDescription: "Ready (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshot error matching a built-in fatal pattern is retried",
+			objs: []runtime.Object{&snapshotv1api.VolumeSnapshot{
+				ObjectMeta: builder.ForVolumeSnapshot("ns", "vs").Result().ObjectMeta,
+				Status: &snapshotv1api.VolumeSnapshotStatus{
+					Error: &snapshotv1api.VolumeSnapshotError{Message: &vsFatalError},
+				},
+			}},
+			expectedDescription: "Retryable error, retrying: volumesnapshotclass not found (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshot error is fatal per the plugin config",
+			objs: []runtime.Object{&snapshotv1api.VolumeSnapshot{
+				ObjectMeta: builder.ForVolumeSnapshot("ns", "vs").Result().ObjectMeta,
+				Status: &snapshotv1api.VolumeSnapshotStatus{
+					Error: &snapshotv1api.VolumeSnapshotError{Message: &vsFatalError},
+				},
+			}},
+			kubeObjs: []runtime.Object{builder.ForConfigMap("velero", "config").
+				ObjectMeta(builder.WithLabels("velero.io/plugin-config", "", "velero.io/csi-pvc-backupper", "BackupItemAction")).
+				Data(util.SnapshotErrorPatternsConfigKey, "fatal: [\"volumesnapshotclass not found\"]").Result()},
+			expectedCompleted:   true,
+			expectedErr:         vsFatalError,
+			expectedDescription: "Failed with Fatal error: volumesnapshotclass not found (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshotcontent is out of quota",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{
+					Error: &snapshotv1api.VolumeSnapshotError{Message: &vscQuotaError},
+				}).Result(),
+			},
+			expectedDescription: "Quota error, retrying: quota exceeded (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshotcontent failed",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{
+					Error: &snapshotv1api.VolumeSnapshotError{Message: &vscFatalError},
+				}).Result(),
+			},
+			expectedCompleted:   true,
+			expectedErr:         vscFatalError,
+			expectedDescription: "Failed with Fatal error: invalid snapshot parameters (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshotcontent error is fatal per the plugin config",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				driverErrorVSC,
+			},
+			kubeObjs:            []runtime.Object{pluginConfig},
+			expectedCompleted:   true,
+			expectedErr:         driverError,
+			expectedDescription: "Failed with Fatal error: SnapshotCreationPerVolumeRateExceeded (elapsed 1m30s)",
+		},
+		{
+			name: "volumesnapshotcontent error is retryable without the plugin config",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				driverErrorVSC,
+			},
+			expectedDescription: "Retryable error, retrying: SnapshotCreationPerVolumeRateExceeded (elapsed 1m30s)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vsBIA := VolumeSnapshotBackupItemAction{
+				Log:            logrus.New(),
+				Client:         fake.NewSimpleClientset(tc.kubeObjs...),
+				SnapshotClient: snapshotfake.NewSimpleClientset(tc.objs...),
+			}
+
+			progress, err := vsBIA.Progress(operationID, builder.ForBackup("velero", "backup").Result())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCompleted, progress.Completed)
+			assert.Equal(t, tc.expectedErr, progress.Err)
+			assert.Equal(t, tc.expectedNCompleted, progress.NCompleted)
+			assert.Equal(t, tc.expectedNTotal, progress.NTotal)
+			assert.Equal(t, "Bytes", progress.OperationUnits)
+			assert.True(t, started.Equal(progress.Started))
+			assert.Equal(t, tc.expectedDescription, progress.Description)
+		})
+	}
+}
+
+func TestVolumeSnapshotProgressVerification(t *testing.T) {
+	started := time.Now().Add(-90 * time.Second).Truncate(time.Second)
+	operationID := "ns/vs/" + started.Format(time.RFC3339)
+	restoreSize := int64(1 << 30)
+	handle := "handle"
+	verificationName := "velero-verify-vs-uid"
+
+	newPluginConfig := func(verification string) *corev1api.ConfigMap {
+		return builder.ForConfigMap("velero", "config").
+			ObjectMeta(builder.WithLabels("velero.io/plugin-config", "", "velero.io/csi-pvc-backupper", "BackupItemAction")).
+			Data(util.SnapshotVerificationConfigKey, verification).Result()
+	}
+	newVS := func(annotations ...string) *snapshotv1api.VolumeSnapshot {
+		vs := builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithUID("vs-uid"), builder.WithAnnotations(annotations...)).
+			SourcePVC("pvc").Status().BoundVolumeSnapshotContentName("vsc").RestoreSize("1Gi").Result()
+		return vs
+	}
+	newVerificationPVC := func(phase corev1api.PersistentVolumeClaimPhase, created time.Time) *corev1api.PersistentVolumeClaim {
+		pvc := builder.ForPersistentVolumeClaim("velero", verificationName).Phase(phase).Result()
+		pvc.CreationTimestamp = metav1.NewTime(created)
+		return pvc
+	}
+	waitForFirstConsumerClass := builder.ForStorageClass("local").Result()
+	waitForFirstConsumer := storagev1api.VolumeBindingWaitForFirstConsumer
+	waitForFirstConsumerClass.VolumeBindingMode = &waitForFirstConsumer
+	vsc := builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{
+		SnapshotHandle: &handle,
+		RestoreSize:    &restoreSize,
+		ReadyToUse:     boolptr.True(),
+	}).Result()
+	vsc.Spec.Driver = "hostpath.csi.k8s.io"
+
+	tests := []struct {
+		name                  string
+		vs                    *snapshotv1api.VolumeSnapshot
+		kubeObjs              []runtime.Object
+		expectedCompleted     bool
+		expectedErr           string
+		expectedDescription   string
+		expectedResult        string
+		expectVerificationPVC bool
+	}{
+		{
+			name:                  "verification PVC is created",
+			vs:                    newVS(),
+			kubeObjs:              []runtime.Object{newPluginConfig("timeout: 5m"), builder.ForPersistentVolumeClaim("ns", "pvc").Result()},
+			expectedDescription:   "Verifying snapshot (elapsed 1m30s)",
+			expectVerificationPVC: true,
+		},
+		{
+			name:                "verification PVC is bound",
+			vs:                  newVS(),
+			kubeObjs:            []runtime.Object{newPluginConfig("timeout: 5m"), newVerificationPVC(corev1api.ClaimBound, time.Now())},
+			expectedCompleted:   true,
+			expectedDescription: "Ready, verified (elapsed 1m30s)",
+			expectedResult:      util.SnapshotVerificationPassed,
+		},
+		{
+			name:                "verification PVC is not bound in time",
+			vs:                  newVS(),
+			kubeObjs:            []runtime.Object{newPluginConfig("timeout: 5m"), newVerificationPVC(corev1api.ClaimPending, time.Now().Add(-10*time.Minute))},
+			expectedCompleted:   true,
+			expectedErr:         "snapshot verification failed: timed out after 5m0s waiting for verification PVC velero/velero-verify-vs-uid to be bound",
+			expectedDescription: "Verification failed: timed out after 5m0s waiting for verification PVC velero/velero-verify-vs-uid to be bound (elapsed 1m30s)",
+			expectedResult:      util.SnapshotVerificationFailed,
+		},
+		{
+			name: "check pod failed",
+			vs:   newVS(),
+			kubeObjs: []runtime.Object{
+				newPluginConfig("check:\n  image: busybox\n  command: [ls, /data]"),
+				newVerificationPVC(corev1api.ClaimBound, time.Now()),
+				builder.ForPod("velero", verificationName).Phase(corev1api.PodFailed).ContainerStatuses(&corev1api.ContainerStatus{
+					State: corev1api.ContainerState{Terminated: &corev1api.ContainerStateTerminated{ExitCode: 1}},
+				}).Result(),
+			},
+			expectedCompleted:   true,
+			expectedErr:         "snapshot verification failed: check pod velero/velero-verify-vs-uid failed: exit code 1",
+			expectedDescription: "Verification failed: check pod velero/velero-verify-vs-uid failed: exit code 1 (elapsed 1m30s)",
+			expectedResult:      util.SnapshotVerificationFailed,
+		},
+		{
+			name:                "check pod is running",
+			vs:                  newVS(),
+			kubeObjs:            []runtime.Object{newPluginConfig("check:\n  image: busybox"), newVerificationPVC(corev1api.ClaimBound, time.Now())},
+			expectedDescription: "Verifying snapshot (elapsed 1m30s)",
+		},
+		{
+			name: "verification without check fails for a storage class binding volumes on first consumer",
+			vs:   newVS(),
+			kubeObjs: []runtime.Object{
+				newPluginConfig("timeout: 5m"),
+				builder.ForPersistentVolumeClaim("ns", "pvc").StorageClass("local").Result(),
+				waitForFirstConsumerClass,
+			},
+			expectedCompleted: true,
+			expectedErr: "snapshot verification failed: storage class local binds volumes on their first consumer, " +
+				"the verification PVC is only bound with a check set in snapshotVerification of the plugin config",
+			expectedDescription: "Verification failed: storage class local binds volumes on their first consumer, " +
+				"the verification PVC is only bound with a check set in snapshotVerification of the plugin config (elapsed 1m30s)",
+			expectedResult: util.SnapshotVerificationFailed,
+		},
+		{
+			name: "verification with check is created for a storage class binding volumes on first consumer",
+			vs:   newVS(),
+			kubeObjs: []runtime.Object{
+				newPluginConfig("check:\n  image: busybox"),
+				builder.ForPersistentVolumeClaim("ns", "pvc").StorageClass("local").Result(),
+				waitForFirstConsumerClass,
+			},
+			expectedDescription:   "Verifying snapshot (elapsed 1m30s)",
+			expectVerificationPVC: true,
+		},
+		{
+			name:                "snapshot was verified already",
+			vs:                  newVS(util.SnapshotVerificationAnnotation, util.SnapshotVerificationPassed),
+			kubeObjs:            []runtime.Object{newPluginConfig("timeout: 5m")},
+			expectedCompleted:   true,
+			expectedDescription: "Ready, verified (elapsed 1m30s)",
+			expectedResult:      util.SnapshotVerificationPassed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset(tc.kubeObjs...)
+			snapshotClient := snapshotfake.NewSimpleClientset(tc.vs, vsc)
+			vsBIA := VolumeSnapshotBackupItemAction{
+				Log:            logrus.New(),
+				Client:         kubeClient,
+				SnapshotClient: snapshotClient,
+			}
+
+			progress, err := vsBIA.Progress(operationID, builder.ForBackup("velero", "backup").Result())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCompleted, progress.Completed)
+			assert.Equal(t, tc.expectedErr, progress.Err)
+			assert.Equal(t, tc.expectedDescription, progress.Description)
+
+			vs, err := snapshotClient.SnapshotV1().VolumeSnapshots("ns").Get(context.TODO(), "vs", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, vs.Annotations[util.SnapshotVerificationAnnotation])
+
+			_, err = kubeClient.CoreV1().PersistentVolumeClaims("velero").Get(context.TODO(), verificationName, metav1.GetOptions{})
+			if tc.expectVerificationPVC {
+				require.NoError(t, err)
+				_, err = snapshotClient.SnapshotV1().VolumeSnapshots("velero").Get(context.TODO(), verificationName, metav1.GetOptions{})
+				require.NoError(t, err)
+				verificationVSC, err := snapshotClient.SnapshotV1().VolumeSnapshotContents().Get(context.TODO(), verificationName, metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, snapshotv1api.VolumeSnapshotContentRetain, verificationVSC.Spec.DeletionPolicy)
+				assert.Equal(t, handle, *verificationVSC.Spec.Source.SnapshotHandle)
+			} else if tc.expectedCompleted {
+				// the temporary objects are deleted once the snapshot is verified
+				assert.True(t, apierrors.IsNotFound(err))
+			}
+		})
+	}
+}
+
+func TestVolumeSnapshotCancel(t *testing.T) {
+	operationID := "ns/vs/" + time.Now().Format(time.RFC3339)
+	vs := builder.ForVolumeSnapshot("ns", "vs").Result()
+	snapshotClient := snapshotfake.NewSimpleClientset(vs)
+	vsBIA := VolumeSnapshotBackupItemAction{
+		Log:            logrus.New(),
+		Client:         fake.NewSimpleClientset(),
+		SnapshotClient: snapshotClient,
+	}
+	backup := builder.ForBackup("velero", "backup").Result()
+
+	assert.Error(t, vsBIA.Cancel("ns/vs", backup))
+
+	require.NoError(t, vsBIA.Cancel(operationID, backup))
+	_, err := snapshotClient.SnapshotV1().VolumeSnapshots("ns").Get(context.TODO(), "vs", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// the volumesnapshot is gone already
+	require.NoError(t, vsBIA.Cancel(operationID, backup))
+}
+
+func TestVolumeSnapshotExecuteUserCreated(t *testing.T) {
+	handle := "handle"
+	className := "class"
+	boundVS := builder.ForVolumeSnapshot("ns", "vs").VolumeSnapshotClass(className).Status().BoundVolumeSnapshotContentName("vsc").Result()
+	vsc := builder.ForVolumeSnapshotContent("vsc").Status(&snapshotv1api.VolumeSnapshotContentStatus{SnapshotHandle: &handle}).Result()
+	vsc.Spec.Driver = "hostpath.csi.k8s.io"
+
+	tests := []struct {
+		name                    string
+		vs                      *snapshotv1api.VolumeSnapshot
+		objs                    []runtime.Object
+		phase                   velerov1api.BackupPhase
+		expectedErr             bool
+		expectedAnnotations     []string
+		expectedAdditionalItems int
+	}{
+		{
+			name:                    "bound volumesnapshot records its snapshot",
+			vs:                      boundVS,
+			objs:                    []runtime.Object{boundVS, vsc},
+			expectedAnnotations:     []string{util.VolumeSnapshotMetadataAnnotation},
+			expectedAdditionalItems: 2,
+		},
+		{
+			name:                    "unbound volumesnapshot is skipped",
+			vs:                      builder.ForVolumeSnapshot("ns", "vs").VolumeSnapshotClass(className).Result(),
+			objs:                    []runtime.Object{builder.ForVolumeSnapshot("ns", "vs").VolumeSnapshotClass(className).Result()},
+			expectedAnnotations:     []string{util.SkippedUnboundVolumeSnapshotAnnotation},
+			expectedAdditionalItems: 1,
+		},
+		{
+			name:        "volumesnapshotcontent can't be found",
+			vs:          boundVS,
+			objs:        []runtime.Object{boundVS},
+			expectedErr: true,
+		},
+		{
+			name:  "volumesnapshot is not deleted when the backup is finalized",
+			vs:    builder.ForVolumeSnapshot("ns", "vs").Result(),
+			objs:  []runtime.Object{builder.ForVolumeSnapshot("ns", "vs").Result()},
+			phase: velerov1api.BackupPhaseFinalizing,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshotClient := snapshotfake.NewSimpleClientset(tc.objs...)
+			vsBIA := VolumeSnapshotBackupItemAction{
+				Log:            logrus.New(),
+				Client:         fake.NewSimpleClientset(),
+				SnapshotClient: snapshotClient,
+			}
+			backup := builder.ForBackup("velero", "backup").Phase(tc.phase).Result()
+			item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.vs)
+			require.NoError(t, err)
+
+			updated, additionalItems, operationID, itemsToUpdate, err := vsBIA.Execute(&unstructured.Unstructured{Object: item}, backup)
+
+			// the volumesnapshot is never deleted nor modified
+			live, getErr := snapshotClient.SnapshotV1().VolumeSnapshots("ns").Get(context.TODO(), "vs", metav1.GetOptions{})
+			require.NoError(t, getErr)
+			assert.Empty(t, live.Annotations)
+
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, operationID)
+			assert.Empty(t, itemsToUpdate)
+			assert.Len(t, additionalItems, tc.expectedAdditionalItems)
+
+			backedUp := new(snapshotv1api.VolumeSnapshot)
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(updated.UnstructuredContent(), backedUp))
+			for _, annotation := range tc.expectedAnnotations {
+				assert.Contains(t, backedUp.Annotations, annotation)
+			}
+			if _, ok := backedUp.Annotations[util.VolumeSnapshotMetadataAnnotation]; ok {
+				metadata, err := util.GetVolumeSnapshotMetadata(backedUp)
+				require.NoError(t, err)
+				assert.True(t, metadata.UserCreated)
+				assert.Equal(t, handle, metadata.SnapshotHandle)
+				assert.Equal(t, "hostpath.csi.k8s.io", metadata.Driver)
+			}
+		})
+	}
+}
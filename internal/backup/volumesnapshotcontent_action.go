@@ -96,6 +96,6 @@ func (p *VolumeSnapshotContentBackupItemAction) Progress(operationID string, bac
 }
 
 func (p *VolumeSnapshotContentBackupItemAction) Cancel(operationID string, backup *velerov1api.Backup) error {
-	// CSI Specification doesn't support canceling a snapshot creation.
+	// The snapshot operations are started, and canceled, by the VolumeSnapshotBackupItemAction.
 	return nil
 }
@@ -12,12 +12,14 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 // VolumeSnapshotDeleteItemAction is a backup item action plugin for Velero.
 type VolumeSnapshotDeleteItemAction struct {
-	Log logrus.FieldLogger
+	Log            logrus.FieldLogger
+	SnapshotClient snapshotterClientSet.Interface
 }
 
 // AppliesTo returns information indicating that the VolumeSnapshotBackupItemAction should be invoked to backup volumesnapshots.
@@ -46,15 +48,24 @@ func (p *VolumeSnapshotDeleteItemAction) Execute(input *velero.DeleteItemActionE
 		return nil
 	}
 
-	p.Log.Infof("Deleting Volumesnapshot %s/%s", vs.Namespace, vs.Name)
-	_, snapClient, err := util.GetClients()
+	// The label of a volumesnapshot restored by Velero names the backup it was restored from, which may have
+	// the name of the backup being deleted, so also skip the ones recorded as created outside of Velero.
+	// A metadata record which can't be read may be the one of a volumesnapshot created outside of Velero.
+	metadata, err := util.GetVolumeSnapshotMetadata(&vs)
 	if err != nil {
-		return errors.WithStack(err)
+		p.Log.WithError(err).Warnf("Failed to read the metadata of VolumeSnapshot %s/%s, skipping deletion", vs.Namespace, vs.Name)
+		return nil
+	}
+	if metadata != nil && metadata.UserCreated {
+		p.Log.Infof("VolumeSnapshot %s/%s was created outside of Velero, skipping deletion", vs.Namespace, vs.Name)
+		return nil
 	}
+
+	p.Log.Infof("Deleting Volumesnapshot %s/%s", vs.Namespace, vs.Name)
 	if vs.Status != nil && vs.Status.BoundVolumeSnapshotContentName != nil {
 		// we patch the DeletionPolicy of the volumesnapshotcontent to set it to Delete.
 		// This ensures that the volume snapshot in the storage provider is also deleted.
-		err := util.SetVolumeSnapshotContentDeletionPolicy(*vs.Status.BoundVolumeSnapshotContentName, snapClient.SnapshotV1())
+		err := util.SetVolumeSnapshotContentDeletionPolicy(*vs.Status.BoundVolumeSnapshotContentName, p.SnapshotClient.SnapshotV1())
 		if err != nil && !apierrors.IsNotFound(err) {
 			return errors.Wrapf(err, fmt.Sprintf("failed to patch DeletionPolicy of volume snapshot %s/%s", vs.Namespace, vs.Name))
 		}
@@ -63,7 +74,7 @@ func (p *VolumeSnapshotDeleteItemAction) Execute(input *velero.DeleteItemActionE
 			return nil
 		}
 	}
-	err = snapClient.SnapshotV1().VolumeSnapshots(vs.Namespace).Delete(context.TODO(), vs.Name, metav1.DeleteOptions{})
+	err = p.SnapshotClient.SnapshotV1().VolumeSnapshots(vs.Namespace).Delete(context.TODO(), vs.Name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
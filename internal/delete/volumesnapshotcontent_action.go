@@ -13,11 +13,13 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
 )
 
 // VolumeSnapshotContentDeleteItemAction is a restore item action plugin for Velero
 type VolumeSnapshotContentDeleteItemAction struct {
-	Log logrus.FieldLogger
+	Log            logrus.FieldLogger
+	SnapshotClient snapshotterClientSet.Interface
 }
 
 // AppliesTo returns information indicating VolumeSnapshotContentRestoreItemAction action should be invoked while restoring
@@ -46,12 +48,7 @@ func (p *VolumeSnapshotContentDeleteItemAction) Execute(input *velero.DeleteItem
 
 	p.Log.Infof("Deleting VolumeSnapshotContent %s", snapCont.Name)
 
-	_, snapClient, err := util.GetClients()
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	err = util.SetVolumeSnapshotContentDeletionPolicy(snapCont.Name, snapClient.SnapshotV1())
+	err := util.SetVolumeSnapshotContentDeletionPolicy(snapCont.Name, p.SnapshotClient.SnapshotV1())
 	if err != nil {
 		// #4764: Leave a warning when VolumeSnapshotContent cannot be found for deletion.
 		// Manual deleting VolumeSnapshotContent can cause this.
@@ -67,7 +64,7 @@ func (p *VolumeSnapshotContentDeleteItemAction) Execute(input *velero.DeleteItem
 		return errors.Wrapf(err, fmt.Sprintf("failed to set DeletionPolicy on volumesnapshotcontent %s. Skipping deletion", snapCont.Name))
 	}
 
-	err = snapClient.SnapshotV1().VolumeSnapshotContents().Delete(context.TODO(), snapCont.Name, metav1.DeleteOptions{})
+	err = p.SnapshotClient.SnapshotV1().VolumeSnapshotContents().Delete(context.TODO(), snapCont.Name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		p.Log.Infof("VolumeSnapshotContent %s not found", snapCont.Name)
 		return err
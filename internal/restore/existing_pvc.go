@@ -0,0 +1,398 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1api "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+)
+
+const (
+	// replaceOperationIDPrefix prefixes the ID of the operation scaling the workloads of a replaced PVC back up
+	// once it is restored, followed by the namespace and name of the PVC.
+	replaceOperationIDPrefix = "pvc-replace."
+	// defaultExistingPVCSuffix is the suffix of the name of the PVCs restored alongside an existing PVC.
+	defaultExistingPVCSuffix = "-restored"
+	// defaultExistingPVCTimeout is how long the pods using a replaced PVC and the PVC itself are waited for to be deleted
+	// when the restore sets no timeout.
+	defaultExistingPVCTimeout = 10 * time.Minute
+	// existingPVCPollInterval is how often the deletion of the pods and of the PVC is checked.
+	existingPVCPollInterval = time.Second
+
+	kindDeployment  = "Deployment"
+	kindStatefulSet = "StatefulSet"
+	kindReplicaSet  = "ReplicaSet"
+)
+
+// workload is a Deployment, StatefulSet or ReplicaSet whose pods use a PVC.
+type workload struct {
+	kind string
+	name string
+}
+
+// scaledDownWorkload is a workload scaled down by a restore.
+type scaledDownWorkload struct {
+	workload
+	metadata metav1.ObjectMeta
+}
+
+// getExistingPVCPolicy returns the policy of the restore for the PVCs which already exist, skip by default.
+func getExistingPVCPolicy(restore *velerov1api.Restore) (string, error) {
+	policy, ok := restore.Annotations[util.ExistingPVCPolicyRestoreAnnotation]
+	if !ok {
+		return util.ExistingPVCPolicySkip, nil
+	}
+	switch policy {
+	case util.ExistingPVCPolicySkip, util.ExistingPVCPolicyReplace, util.ExistingPVCPolicyRename:
+		return policy, nil
+	}
+	return "", errors.Errorf("invalid value %q of annotation %s of restore %s, it must be %s, %s or %s", policy,
+		util.ExistingPVCPolicyRestoreAnnotation, restore.Name, util.ExistingPVCPolicySkip, util.ExistingPVCPolicyReplace, util.ExistingPVCPolicyRename)
+}
+
+// getAlongsidePVCName returns the name of the PVC restored alongside the existing PVC of the name.
+func getAlongsidePVCName(name string, restore *velerov1api.Restore) string {
+	suffix := restore.Annotations[util.ExistingPVCSuffixRestoreAnnotation]
+	if suffix == "" {
+		suffix = defaultExistingPVCSuffix
+	}
+	return name + suffix
+}
+
+func newReplaceOperationID(namespace, name string) string {
+	return replaceOperationIDPrefix + namespace + "/" + name
+}
+
+// parseReplaceOperationID returns the namespace and name of the PVC of a replace operation ID,
+// ok is false for other operation IDs.
+func parseReplaceOperationID(operationID string) (namespace, name string, ok bool) {
+	if !strings.HasPrefix(operationID, replaceOperationIDPrefix) {
+		return "", "", false
+	}
+	namespace, name, ok = strings.Cut(strings.TrimPrefix(operationID, replaceOperationIDPrefix), "/")
+	return namespace, name, ok
+}
+
+// getExistingPVCTimeout returns how long the replacement of an existing PVC is waited for: the resource timeout of the
+// restore, else its item operation timeout.
+func getExistingPVCTimeout(restore *velerov1api.Restore, logger logrus.FieldLogger) time.Duration {
+	if value, ok := restore.Annotations[util.ResourceTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err == nil && timeout > 0 {
+			return timeout
+		}
+		logger.Warnf("Invalid value %q for annotation %s of restore %s/%s, ignoring it", value, util.ResourceTimeoutAnnotation, restore.Namespace, restore.Name)
+	}
+	if restore.Spec.ItemOperationTimeout.Duration > 0 {
+		return restore.Spec.ItemOperationTimeout.Duration
+	}
+	return defaultExistingPVCTimeout
+}
+
+// refuseToReplacePVC returns the error of an existing PVC which can't be replaced, as there is nothing to restore it from.
+func refuseToReplacePVC(existing *corev1api.PersistentVolumeClaim, reason string) error {
+	return errors.Errorf("refusing to replace existing PVC %s/%s, %s", existing.Namespace, existing.Name, reason)
+}
+
+// getExistingPVC returns the PVC of the name in the namespace, nil if there is none.
+func (p *PVCRestoreItemAction) getExistingPVC(namespace, name string) (*corev1api.PersistentVolumeClaim, error) {
+	pvc, err := p.Client.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error getting PVC %s/%s", namespace, name)
+	}
+	return pvc, nil
+}
+
+// replaceExistingPVC scales down the workloads using the existing PVC and deletes it, so that it is re-created from the backup.
+// The workloads are scaled back up by scaleUpWorkloads once the PVC is restored, or right away if the PVC can't be deleted.
+// The pods and the PVC are waited for to be deleted within the timeout of the restore.
+func (p *PVCRestoreItemAction) replaceExistingPVC(existing *corev1api.PersistentVolumeClaim, restore *velerov1api.Restore, logger logrus.FieldLogger) (err error) {
+	pods, err := util.GetPodsUsingPVC(existing.Namespace, existing.Name, p.Client.CoreV1())
+	if err != nil {
+		return errors.Wrapf(err, "error getting pods using PVC %s/%s", existing.Namespace, existing.Name)
+	}
+
+	var workloads []workload
+	for i := range pods {
+		w, err := p.getPodWorkload(&pods[i])
+		if err != nil {
+			return err
+		}
+		if !containsWorkload(workloads, w) {
+			workloads = append(workloads, w)
+		}
+	}
+
+	defer func() {
+		if err != nil {
+			if scaleErr := p.scaleUpWorkloads(existing.Namespace, existing.Name, restore, logger); scaleErr != nil {
+				logger.WithError(scaleErr).Errorf("Failed to scale up the workloads using PVC %s/%s", existing.Namespace, existing.Name)
+			}
+		}
+	}()
+
+	for _, w := range workloads {
+		if err := p.scaleDownWorkload(existing.Namespace, w, existing.Name, restore); err != nil {
+			return err
+		}
+		logger.Infof("Scaled down %s %s/%s using PVC %s", w.kind, existing.Namespace, w.name, existing.Name)
+	}
+
+	timeout := getExistingPVCTimeout(restore, logger)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err = wait.PollUntilContextCancel(ctx, existingPVCPollInterval, true, func(ctx context.Context) (bool, error) {
+		pods, err := util.GetPodsUsingPVC(existing.Namespace, existing.Name, p.Client.CoreV1())
+		if err != nil {
+			return false, errors.Wrapf(err, "error getting pods using PVC %s/%s", existing.Namespace, existing.Name)
+		}
+		return len(pods) == 0, nil
+	})
+	if wait.Interrupted(err) {
+		return errors.Errorf("timed out after %v waiting for the pods using PVC %s/%s to be deleted", timeout, existing.Namespace, existing.Name)
+	} else if err != nil {
+		return err
+	}
+
+	err = p.Client.CoreV1().PersistentVolumeClaims(existing.Namespace).Delete(ctx, existing.Name,
+		metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &existing.UID}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "error deleting PVC %s/%s", existing.Namespace, existing.Name)
+	}
+	err = wait.PollUntilContextCancel(ctx, existingPVCPollInterval, true, func(ctx context.Context) (bool, error) {
+		pvc, err := p.getExistingPVC(existing.Namespace, existing.Name)
+		if err != nil {
+			return false, err
+		}
+		return pvc == nil, nil
+	})
+	if wait.Interrupted(err) {
+		return errors.Errorf("timed out after %v waiting for PVC %s/%s to be deleted", timeout, existing.Namespace, existing.Name)
+	} else if err != nil {
+		return err
+	}
+	logger.Infof("Deleted PVC %s/%s to replace it", existing.Namespace, existing.Name)
+	return nil
+}
+
+// getPodWorkload returns the workload managing the pod, the Deployment of its ReplicaSet if it has one.
+func (p *PVCRestoreItemAction) getPodWorkload(pod *corev1api.Pod) (workload, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return workload{}, errors.Errorf("pod %s/%s is not managed by a Deployment, StatefulSet or ReplicaSet which can be scaled down", pod.Namespace, pod.Name)
+	}
+	switch owner.Kind {
+	case kindStatefulSet:
+		return workload{kind: kindStatefulSet, name: owner.Name}, nil
+	case kindReplicaSet:
+		rs, err := p.Client.AppsV1().ReplicaSets(pod.Namespace).Get(context.TODO(), owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return workload{}, errors.Wrapf(err, "error getting ReplicaSet %s/%s of pod %s", pod.Namespace, owner.Name, pod.Name)
+		}
+		if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil && rsOwner.Kind == kindDeployment {
+			return workload{kind: kindDeployment, name: rsOwner.Name}, nil
+		}
+		return workload{kind: kindReplicaSet, name: rs.Name}, nil
+	}
+	return workload{}, errors.Errorf("pod %s/%s is managed by %s %s, which can't be scaled down", pod.Namespace, pod.Name, owner.Kind, owner.Name)
+}
+
+// scaleDownWorkload scales the workload down to zero, recording its replicas and the PVC it waits for.
+// A workload already scaled down by the restore for another PVC waits for this PVC as well.
+func (p *PVCRestoreItemAction) scaleDownWorkload(namespace string, w workload, pvcName string, restore *velerov1api.Restore) error {
+	metadata, replicas, err := p.getWorkload(namespace, w)
+	if err != nil {
+		return err
+	}
+
+	restoreLabel := label.GetValidName(string(restore.UID))
+	replicasValue := metadata.Annotations[util.ScaledDownReplicasAnnotation]
+	var pvcs []string
+	if metadata.Labels[util.ScaledDownByRestoreLabel] != restoreLabel || replicasValue == "" {
+		replicasValue = "1"
+		if replicas != nil {
+			replicasValue = strconv.Itoa(int(*replicas))
+		}
+	} else if value := metadata.Annotations[util.ScaledDownForPVCsAnnotation]; value != "" {
+		pvcs = strings.Split(value, ",")
+	}
+	if !util.Contains(pvcs, pvcName) {
+		pvcs = append(pvcs, pvcName)
+	}
+
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{util.ScaledDownByRestoreLabel: restoreLabel},
+			"annotations": map[string]interface{}{
+				util.ScaledDownReplicasAnnotation: replicasValue,
+				util.ScaledDownForPVCsAnnotation:  strings.Join(pvcs, ","),
+			},
+		},
+		"spec": map[string]interface{}{"replicas": 0},
+	}
+	return p.patchWorkload(namespace, w, patch)
+}
+
+// scaleUpWorkloads scales back up the workloads the restore scaled down which were waiting only for the PVC.
+func (p *PVCRestoreItemAction) scaleUpWorkloads(namespace, pvcName string, restore *velerov1api.Restore, logger logrus.FieldLogger) error {
+	workloads, err := p.listScaledDownWorkloads(namespace, restore)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range workloads {
+		pvcs := strings.Split(w.metadata.Annotations[util.ScaledDownForPVCsAnnotation], ",")
+		if !util.Contains(pvcs, pvcName) {
+			continue
+		}
+		var remaining []string
+		for _, pvc := range pvcs {
+			if pvc != pvcName && pvc != "" {
+				remaining = append(remaining, pvc)
+			}
+		}
+
+		if len(remaining) > 0 {
+			patch := map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{util.ScaledDownForPVCsAnnotation: strings.Join(remaining, ",")},
+				},
+			}
+			if err := p.patchWorkload(namespace, w.workload, patch); err != nil {
+				return err
+			}
+			continue
+		}
+
+		replicas, err := strconv.Atoi(w.metadata.Annotations[util.ScaledDownReplicasAnnotation])
+		if err != nil {
+			return errors.Wrapf(err, "error parsing annotation %s of %s %s/%s", util.ScaledDownReplicasAnnotation, w.kind, namespace, w.name)
+		}
+		patch := map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": map[string]interface{}{util.ScaledDownByRestoreLabel: nil},
+				"annotations": map[string]interface{}{
+					util.ScaledDownReplicasAnnotation: nil,
+					util.ScaledDownForPVCsAnnotation:  nil,
+				},
+			},
+			"spec": map[string]interface{}{"replicas": replicas},
+		}
+		if err := p.patchWorkload(namespace, w.workload, patch); err != nil {
+			return err
+		}
+		logger.Infof("Scaled up %s %s/%s to %d replicas", w.kind, namespace, w.name, replicas)
+	}
+	return nil
+}
+
+func (p *PVCRestoreItemAction) getWorkload(namespace string, w workload) (metav1.ObjectMeta, *int32, error) {
+	switch w.kind {
+	case kindDeployment:
+		deployment, err := p.Client.AppsV1().Deployments(namespace).Get(context.TODO(), w.name, metav1.GetOptions{})
+		if err != nil {
+			return metav1.ObjectMeta{}, nil, errors.Wrapf(err, "error getting deployment %s/%s", namespace, w.name)
+		}
+		return deployment.ObjectMeta, deployment.Spec.Replicas, nil
+	case kindStatefulSet:
+		statefulSet, err := p.Client.AppsV1().StatefulSets(namespace).Get(context.TODO(), w.name, metav1.GetOptions{})
+		if err != nil {
+			return metav1.ObjectMeta{}, nil, errors.Wrapf(err, "error getting statefulset %s/%s", namespace, w.name)
+		}
+		return statefulSet.ObjectMeta, statefulSet.Spec.Replicas, nil
+	case kindReplicaSet:
+		replicaSet, err := p.Client.AppsV1().ReplicaSets(namespace).Get(context.TODO(), w.name, metav1.GetOptions{})
+		if err != nil {
+			return metav1.ObjectMeta{}, nil, errors.Wrapf(err, "error getting replicaset %s/%s", namespace, w.name)
+		}
+		return replicaSet.ObjectMeta, replicaSet.Spec.Replicas, nil
+	}
+	return metav1.ObjectMeta{}, nil, errors.Errorf("unsupported kind %s of workload %s/%s", w.kind, namespace, w.name)
+}
+
+func (p *PVCRestoreItemAction) listScaledDownWorkloads(namespace string, restore *velerov1api.Restore) ([]scaledDownWorkload, error) {
+	opts := metav1.ListOptions{LabelSelector: util.ScaledDownByRestoreLabel + "=" + label.GetValidName(string(restore.UID))}
+	var workloads []scaledDownWorkload
+
+	deployments, err := p.Client.AppsV1().Deployments(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing deployments scaled down by restore %s", restore.Name)
+	}
+	for _, d := range deployments.Items {
+		workloads = append(workloads, scaledDownWorkload{workload{kind: kindDeployment, name: d.Name}, d.ObjectMeta})
+	}
+	statefulSets, err := p.Client.AppsV1().StatefulSets(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing statefulsets scaled down by restore %s", restore.Name)
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, scaledDownWorkload{workload{kind: kindStatefulSet, name: s.Name}, s.ObjectMeta})
+	}
+	replicaSets, err := p.Client.AppsV1().ReplicaSets(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing replicasets scaled down by restore %s", restore.Name)
+	}
+	for _, r := range replicaSets.Items {
+		workloads = append(workloads, scaledDownWorkload{workload{kind: kindReplicaSet, name: r.Name}, r.ObjectMeta})
+	}
+	return workloads, nil
+}
+
+func (p *PVCRestoreItemAction) patchWorkload(namespace string, w workload, patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	switch w.kind {
+	case kindDeployment:
+		_, err = p.Client.AppsV1().Deployments(namespace).Patch(context.TODO(), w.name, types.MergePatchType, data, metav1.PatchOptions{})
+	case kindStatefulSet:
+		_, err = p.Client.AppsV1().StatefulSets(namespace).Patch(context.TODO(), w.name, types.MergePatchType, data, metav1.PatchOptions{})
+	case kindReplicaSet:
+		_, err = p.Client.AppsV1().ReplicaSets(namespace).Patch(context.TODO(), w.name, types.MergePatchType, data, metav1.PatchOptions{})
+	default:
+		return errors.Errorf("unsupported kind %s of workload %s/%s", w.kind, namespace, w.name)
+	}
+	return errors.Wrapf(err, "error patching %s %s/%s", w.kind, namespace, w.name)
+}
+
+func containsWorkload(workloads []workload, w workload) bool {
+	for _, existing := range workloads {
+		if existing == w {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,421 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotfake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1api "k8s.io/api/apps/v1"
+	corev1api "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	velerotest "github.com/vmware-tanzu/velero/pkg/test"
+	"github.com/vmware-tanzu/velero/pkg/util/boolptr"
+)
+
+func podUsingPVC(name, pvcName string, owner *metav1.OwnerReference) *corev1api.Pod {
+	pod := builder.ForPod("velero", name).Volumes(builder.ForVolume("data").PersistentVolumeClaimSource(pvcName).Result()).Result()
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func controllerRef(kind, name string) *metav1.OwnerReference {
+	return &metav1.OwnerReference{Kind: kind, Name: name, Controller: boolptr.True()}
+}
+
+func replicas(n int32) *int32 {
+	return &n
+}
+
+// newScaleDownClient returns a client deleting the pods of the workloads scaled down, like their controllers.
+func newScaleDownClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetResource().Resource != "deployments" && patch.GetResource().Resource != "statefulsets" {
+			return false, nil, nil
+		}
+		pods, err := client.Tracker().List(corev1api.SchemeGroupVersion.WithResource("pods"), corev1api.SchemeGroupVersion.WithKind("Pod"), patch.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		for _, pod := range pods.(*corev1api.PodList).Items {
+			// the pods of a deployment are owned by its replicasets
+			if owner := metav1.GetControllerOf(&pod); owner == nil || !strings.HasPrefix(owner.Name, patch.GetName()) {
+				continue
+			}
+			if err := client.Tracker().Delete(corev1api.SchemeGroupVersion.WithResource("pods"), pod.Namespace, pod.Name); err != nil {
+				return true, nil, err
+			}
+		}
+		return false, nil, nil
+	})
+	return client
+}
+
+func TestExecuteExistingPVC(t *testing.T) {
+	tests := []struct {
+		name            string
+		restore         *velerov1api.Restore
+		objects         []runtime.Object
+		snapshotted     bool
+		volumeSnapshot  *snapshotv1api.VolumeSnapshot
+		expectedName    string
+		expectedErr     string
+		expectedSkipped bool
+	}{
+		{
+			name:            "Skip existing PVC by default",
+			restore:         builder.ForRestore("velero", "testRestore").Backup("testBackup").RestorePVs(false).Result(),
+			objects:         []runtime.Object{builder.ForPersistentVolumeClaim("velero", "testPVC").Result()},
+			expectedName:    "testPVC",
+			expectedSkipped: true,
+		},
+		{
+			name: "Restore alongside existing PVC",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").RestorePVs(false).
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyRename)).Result(),
+			objects:      []runtime.Object{builder.ForPersistentVolumeClaim("velero", "testPVC").Result()},
+			expectedName: "testPVC-restored",
+		},
+		{
+			name: "Restore alongside existing PVC with suffix of restore",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").RestorePVs(false).
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyRename,
+					util.ExistingPVCSuffixRestoreAnnotation, "-rollback")).Result(),
+			objects:      []runtime.Object{builder.ForPersistentVolumeClaim("velero", "testPVC").Result()},
+			expectedName: "testPVC-rollback",
+		},
+		{
+			name: "Skip existing PVC already restored alongside",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").RestorePVs(false).
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyRename)).Result(),
+			objects: []runtime.Object{
+				builder.ForPersistentVolumeClaim("velero", "testPVC").Result(),
+				builder.ForPersistentVolumeClaim("velero", "testPVC-restored").Result(),
+			},
+			expectedName:    "testPVC",
+			expectedSkipped: true,
+		},
+		{
+			name: "Invalid policy",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").RestorePVs(false).
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, "overwrite")).Result(),
+			objects:     []runtime.Object{builder.ForPersistentVolumeClaim("velero", "testPVC").Result()},
+			expectedErr: `invalid value "overwrite" of annotation velero.io/csi-existing-pvc-policy of restore testRestore, it must be skip, replace or rename`,
+		},
+		{
+			name: "Fail to replace PVC used by a pod without workload",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyReplace)).Result(),
+			objects: []runtime.Object{
+				builder.ForPersistentVolumeClaim("velero", "testPVC").Result(),
+				podUsingPVC("pod", "testPVC", nil),
+			},
+			snapshotted:    true,
+			volumeSnapshot: builder.ForVolumeSnapshot("velero", "testVS").Result(),
+			expectedErr:    "error replacing existing PVC velero/testPVC: pod velero/pod is not managed by a Deployment, StatefulSet or ReplicaSet which can be scaled down",
+		},
+		{
+			name: "Refuse to replace PVC when the restore doesn't restore PVs",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").RestorePVs(false).
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyReplace)).Result(),
+			objects:        []runtime.Object{builder.ForPersistentVolumeClaim("velero", "testPVC").Result()},
+			snapshotted:    true,
+			volumeSnapshot: builder.ForVolumeSnapshot("velero", "testVS").Result(),
+			expectedErr:    "refusing to replace existing PVC velero/testPVC, the restore did not request for PVs to be restored",
+		},
+		{
+			name: "Refuse to replace PVC without volumesnapshot",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyReplace)).Result(),
+			objects:     []runtime.Object{builder.ForPersistentVolumeClaim("velero", "testPVC").Result()},
+			expectedErr: "refusing to replace existing PVC velero/testPVC, the PVC does not have a CSI volumesnapshot to restore it from",
+		},
+		{
+			name: "Keep PVC to replace when its volumesnapshot is missing",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyReplace)).Result(),
+			objects:     []runtime.Object{builder.ForPersistentVolumeClaim("velero", "testPVC").Result()},
+			snapshotted: true,
+			expectedErr: `Failed to get Volumesnapshot velero/testVS to restore PVC velero/testPVC: volumesnapshots.snapshot.storage.k8s.io "testVS" not found`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pvcRIA := PVCRestoreItemAction{
+				Log:            logrus.New(),
+				Client:         fake.NewSimpleClientset(tc.objects...),
+				SnapshotClient: snapshotfake.NewSimpleClientset(),
+				CRClient:       velerotest.NewFakeControllerRuntimeClient(t),
+			}
+			require.NoError(t, pvcRIA.CRClient.Create(context.Background(), builder.ForBackup("velero", "testBackup").Result()))
+			if tc.volumeSnapshot != nil {
+				_, err := pvcRIA.SnapshotClient.SnapshotV1().VolumeSnapshots("velero").Create(context.Background(), tc.volumeSnapshot, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			pvc := builder.ForPersistentVolumeClaim("velero", "testPVC").Result()
+			if tc.snapshotted {
+				pvc.Annotations = map[string]string{util.VolumeSnapshotLabel: "testVS"}
+			}
+			pvcMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pvc)
+			require.NoError(t, err)
+			input := &velero.RestoreItemActionExecuteInput{
+				Item:           &unstructured.Unstructured{Object: pvcMap},
+				ItemFromBackup: &unstructured.Unstructured{Object: pvcMap},
+				Restore:        tc.restore,
+			}
+
+			output, err := pvcRIA.Execute(input)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				// the existing PVC is kept when it can't be replaced
+				_, err = pvcRIA.Client.CoreV1().PersistentVolumeClaims("velero").Get(context.Background(), "testPVC", metav1.GetOptions{})
+				assert.NoError(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			pvc = new(corev1api.PersistentVolumeClaim)
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(output.UpdatedItem.UnstructuredContent(), pvc))
+			assert.Equal(t, tc.expectedName, pvc.Name)
+			assert.Empty(t, output.OperationID)
+			if tc.expectedSkipped {
+				assert.Equal(t, input.Item, output.UpdatedItem)
+			} else {
+				assert.Equal(t, "testPVC", pvc.Annotations[util.RestoredFromPVCAnnotation])
+			}
+		})
+	}
+}
+
+func TestReplaceExistingPVC(t *testing.T) {
+	restore := builder.ForRestore("velero", "testRestore").Backup("testBackup").
+		ObjectMeta(builder.WithUID("restore-uid"), builder.WithAnnotations(util.ExistingPVCPolicyRestoreAnnotation, util.ExistingPVCPolicyReplace)).Result()
+	deployment := &appsv1api.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "app"},
+		Spec:       appsv1api.DeploymentSpec{Replicas: replicas(3)},
+	}
+	replicaSet := &appsv1api.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "app-1234", OwnerReferences: []metav1.OwnerReference{*controllerRef("Deployment", "app")}},
+	}
+	statefulSet := &appsv1api.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "db"},
+		Spec:       appsv1api.StatefulSetSpec{Replicas: replicas(2)},
+	}
+	dbPod := podUsingPVC("db-0", "data", controllerRef("StatefulSet", "db"))
+	dbPod.Spec.Volumes = append(dbPod.Spec.Volumes, *builder.ForVolume("logs").PersistentVolumeClaimSource("logs").Result())
+	client := newScaleDownClient(deployment, replicaSet, statefulSet,
+		builder.ForPersistentVolumeClaim("velero", "data").Result(),
+		builder.ForPersistentVolumeClaim("velero", "logs").Result(),
+		podUsingPVC("app-1234-abcd", "data", controllerRef("ReplicaSet", "app-1234")),
+		dbPod,
+	)
+	pvcRIA := PVCRestoreItemAction{
+		Log:            logrus.New(),
+		Client:         client,
+		SnapshotClient: snapshotfake.NewSimpleClientset(builder.ForVolumeSnapshot("velero", "data-vs").Result(), builder.ForVolumeSnapshot("velero", "logs-vs").Result()),
+		CRClient:       velerotest.NewFakeControllerRuntimeClient(t),
+	}
+	require.NoError(t, pvcRIA.CRClient.Create(context.Background(), builder.ForBackup("velero", "testBackup").Result()))
+
+	execute := func(name string) string {
+		pvcMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(builder.ForPersistentVolumeClaim("velero", name).
+			ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, name+"-vs")).Result())
+		require.NoError(t, err)
+		output, err := pvcRIA.Execute(&velero.RestoreItemActionExecuteInput{
+			Item:           &unstructured.Unstructured{Object: pvcMap},
+			ItemFromBackup: &unstructured.Unstructured{Object: pvcMap},
+			Restore:        restore,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "pvc-replace.velero/"+name, output.OperationID)
+
+		// the existing PVC is deleted for the restored one to be created
+		_, err = client.CoreV1().PersistentVolumeClaims("velero").Get(context.Background(), name, metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+		_, err = client.CoreV1().PersistentVolumeClaims("velero").Create(context.Background(), builder.ForPersistentVolumeClaim("velero", name).Result(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		return output.OperationID
+	}
+	getReplicas := func() (int32, int32) {
+		d, err := client.AppsV1().Deployments("velero").Get(context.Background(), "app", metav1.GetOptions{})
+		require.NoError(t, err)
+		s, err := client.AppsV1().StatefulSets("velero").Get(context.Background(), "db", metav1.GetOptions{})
+		require.NoError(t, err)
+		return *d.Spec.Replicas, *s.Spec.Replicas
+	}
+
+	dataOperationID := execute("data")
+	deploymentReplicas, statefulSetReplicas := getReplicas()
+	assert.Equal(t, int32(0), deploymentReplicas)
+	assert.Equal(t, int32(0), statefulSetReplicas)
+	s, err := client.AppsV1().StatefulSets("velero").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "restore-uid", s.Labels[util.ScaledDownByRestoreLabel])
+	assert.Equal(t, "2", s.Annotations[util.ScaledDownReplicasAnnotation])
+	assert.Equal(t, "data", s.Annotations[util.ScaledDownForPVCsAnnotation])
+
+	// the pods using the other PVC are already deleted
+	logsOperationID := execute("logs")
+
+	progress, err := pvcRIA.Progress(dataOperationID, restore)
+	require.NoError(t, err)
+	assert.True(t, progress.Completed)
+	deploymentReplicas, statefulSetReplicas = getReplicas()
+	assert.Equal(t, int32(3), deploymentReplicas)
+	assert.Equal(t, int32(2), statefulSetReplicas)
+	s, err = client.AppsV1().StatefulSets("velero").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, s.Labels, util.ScaledDownByRestoreLabel)
+	assert.NotContains(t, s.Annotations, util.ScaledDownReplicasAnnotation)
+
+	progress, err = pvcRIA.Progress(logsOperationID, restore)
+	require.NoError(t, err)
+	assert.True(t, progress.Completed)
+}
+
+func TestGetExistingPVCTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		restore  *velerov1api.Restore
+		expected time.Duration
+	}{
+		{
+			name:     "default timeout",
+			restore:  builder.ForRestore("velero", "testRestore").Result(),
+			expected: defaultExistingPVCTimeout,
+		},
+		{
+			name:     "item operation timeout of the restore",
+			restore:  builder.ForRestore("velero", "testRestore").ItemOperationTimeout(time.Hour).Result(),
+			expected: time.Hour,
+		},
+		{
+			name: "resource timeout of the restore",
+			restore: builder.ForRestore("velero", "testRestore").ItemOperationTimeout(time.Hour).
+				ObjectMeta(builder.WithAnnotations(util.ResourceTimeoutAnnotation, "5m")).Result(),
+			expected: 5 * time.Minute,
+		},
+		{
+			name: "invalid resource timeout is ignored",
+			restore: builder.ForRestore("velero", "testRestore").ItemOperationTimeout(time.Hour).
+				ObjectMeta(builder.WithAnnotations(util.ResourceTimeoutAnnotation, "-5m")).Result(),
+			expected: time.Hour,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, getExistingPVCTimeout(tc.restore, logrus.New()))
+		})
+	}
+}
+
+func TestReplaceExistingPVCTimeout(t *testing.T) {
+	restore := builder.ForRestore("velero", "testRestore").
+		ObjectMeta(builder.WithUID("restore-uid"), builder.WithAnnotations(util.ResourceTimeoutAnnotation, "1s")).Result()
+	existing := builder.ForPersistentVolumeClaim("velero", "data").Result()
+	// the pod of the statefulset isn't deleted when it is scaled down
+	client := fake.NewSimpleClientset(
+		&appsv1api.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "db"},
+			Spec:       appsv1api.StatefulSetSpec{Replicas: replicas(2)},
+		},
+		existing,
+		podUsingPVC("db-0", "data", controllerRef("StatefulSet", "db")),
+	)
+	pvcRIA := PVCRestoreItemAction{
+		Log:    logrus.New(),
+		Client: client,
+	}
+
+	err := pvcRIA.replaceExistingPVC(existing, restore, pvcRIA.Log)
+	assert.EqualError(t, err, "timed out after 1s waiting for the pods using PVC velero/data to be deleted")
+
+	// the existing PVC is kept and the statefulset is scaled back up
+	_, err = client.CoreV1().PersistentVolumeClaims("velero").Get(context.Background(), "data", metav1.GetOptions{})
+	require.NoError(t, err)
+	s, err := client.AppsV1().StatefulSets("velero").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *s.Spec.Replicas)
+}
+
+func TestProgressReplaceWaitsForPVC(t *testing.T) {
+	restore := builder.ForRestore("velero", "testRestore").ObjectMeta(builder.WithUID("restore-uid")).Result()
+	pvcRIA := PVCRestoreItemAction{
+		Log:    logrus.New(),
+		Client: fake.NewSimpleClientset(),
+	}
+
+	progress, err := pvcRIA.Progress(newReplaceOperationID("velero", "data"), restore)
+	require.NoError(t, err)
+	assert.False(t, progress.Completed)
+}
+
+func TestScaleWorkloadForSeveralPVCs(t *testing.T) {
+	restore := builder.ForRestore("velero", "testRestore").ObjectMeta(builder.WithUID("restore-uid")).Result()
+	statefulSet := &appsv1api.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "db"},
+		Spec:       appsv1api.StatefulSetSpec{Replicas: replicas(2)},
+	}
+	client := fake.NewSimpleClientset(statefulSet)
+	pvcRIA := PVCRestoreItemAction{Log: logrus.New(), Client: client}
+	db := workload{kind: kindStatefulSet, name: "db"}
+
+	require.NoError(t, pvcRIA.scaleDownWorkload("velero", db, "data", restore))
+	// the replicas recorded for the first PVC are kept
+	require.NoError(t, pvcRIA.scaleDownWorkload("velero", db, "logs", restore))
+	s, err := client.AppsV1().StatefulSets("velero").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), *s.Spec.Replicas)
+	assert.Equal(t, "2", s.Annotations[util.ScaledDownReplicasAnnotation])
+	assert.Equal(t, "data,logs", s.Annotations[util.ScaledDownForPVCsAnnotation])
+
+	require.NoError(t, pvcRIA.scaleUpWorkloads("velero", "data", restore, logrus.New()))
+	s, err = client.AppsV1().StatefulSets("velero").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), *s.Spec.Replicas)
+	assert.Equal(t, "logs", s.Annotations[util.ScaledDownForPVCsAnnotation])
+
+	require.NoError(t, pvcRIA.scaleUpWorkloads("velero", "logs", restore, logrus.New()))
+	s, err = client.AppsV1().StatefulSets("velero").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *s.Spec.Replicas)
+	assert.Empty(t, s.Labels)
+	assert.Empty(t, s.Annotations)
+}
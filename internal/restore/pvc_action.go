@@ -26,6 +26,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1api "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -113,6 +114,16 @@ func setPVCStorageResourceRequest(pvc *corev1api.PersistentVolumeClaim, restoreS
 	}
 }
 
+// renamePVC returns a copy of the PVC item with the new name, recording the name of the backed-up PVC.
+func renamePVC(item runtime.Unstructured, pvc *corev1api.PersistentVolumeClaim, newName, backupName string) runtime.Unstructured {
+	renamed := &unstructured.Unstructured{Object: runtime.DeepCopyJSON(item.UnstructuredContent())}
+	renamed.SetName(newName)
+	util.AddAnnotations(&pvc.ObjectMeta, map[string]string{util.RestoredFromPVCAnnotation: backupName})
+	renamed.SetAnnotations(pvc.Annotations)
+	pvc.Name = newName
+	return renamed
+}
+
 // Execute modifies the PVC's spec to use the volumesnapshot object as the data source ensuring that the newly provisioned volume
 // can be pre-populated with data from the volumesnapshot.
 func (p *PVCRestoreItemAction) Execute(input *velero.RestoreItemActionExecuteInput) (*velero.RestoreItemActionExecuteOutput, error) {
@@ -131,17 +142,6 @@ func (p *PVCRestoreItemAction) Execute(input *velero.RestoreItemActionExecuteInp
 	})
 	logger.Info("Starting PVCRestoreItemAction for PVC")
 
-	// If PVC already exists, returns early.
-	if p.isResourceExist(pvc, *input.Restore) {
-		logger.Warnf("PVC already exists. Skip restore this PVC.")
-		return &velero.RestoreItemActionExecuteOutput{
-			UpdatedItem: input.Item,
-		}, nil
-	}
-
-	removePVCAnnotations(&pvc,
-		[]string{AnnBindCompleted, AnnBoundByController, AnnStorageProvisioner, AnnBetaStorageProvisioner, AnnSelectedNode})
-
 	// If cross-namespace restore is configured, change the namespace
 	// for PVC object to be restored
 	newNamespace, ok := input.Restore.Spec.NamespaceMapping[pvc.GetNamespace()]
@@ -150,6 +150,79 @@ func (p *PVCRestoreItemAction) Execute(input *velero.RestoreItemActionExecuteInp
 		newNamespace = pvc.Namespace
 	}
 
+	// The PVC is renamed if the restore maps its name, its VolumeSnapshot is renamed along by VolumeSnapshotRestoreItemAction.
+	item := input.Item
+	renameMapping, err := util.GetPVCRenameMapping(input.Restore)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	mappedName, renamed := renameMapping.NewName(pvcFromBackup.Namespace, pvcFromBackup.Name)
+	if renamed {
+		logger.Infof("Restoring PVC as %s/%s", newNamespace, mappedName)
+		item = renamePVC(item, &pvc, mappedName, pvcFromBackup.Name)
+	}
+
+	// If PVC already exists, it is skipped, replaced or restored alongside according to the policy of the restore.
+	// An existing PVC is replaced only once the PVC to restore is ready, as the last step, so that a restore
+	// failing before doesn't delete it and leave its workloads scaled down.
+	var replacedPVC *corev1api.PersistentVolumeClaim
+	existingPVC, err := p.getExistingPVC(newNamespace, pvc.Name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if existingPVC != nil {
+		policy, err := getExistingPVCPolicy(input.Restore)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		switch policy {
+		case util.ExistingPVCPolicyReplace:
+			logger.Infof("PVC already exists, replacing it.")
+			replacedPVC = existingPVC
+		case util.ExistingPVCPolicyRename:
+			newName := getAlongsidePVCName(pvc.Name, input.Restore)
+			if alongsidePVC, err := p.getExistingPVC(newNamespace, newName); err != nil {
+				return nil, errors.WithStack(err)
+			} else if alongsidePVC != nil {
+				logger.Warnf("PVC already exists, and so does PVC %s/%s to restore it alongside. Skip restore this PVC.", newNamespace, newName)
+				return &velero.RestoreItemActionExecuteOutput{
+					UpdatedItem: item,
+				}, nil
+			}
+			logger.Infof("PVC already exists, restoring it alongside as PVC %s/%s.", newNamespace, newName)
+			item = renamePVC(item, &pvc, newName, pvcFromBackup.Name)
+		default:
+			logger.Warnf("PVC already exists. Skip restore this PVC.")
+			return &velero.RestoreItemActionExecuteOutput{
+				UpdatedItem: item,
+			}, nil
+		}
+	}
+
+	removePVCAnnotations(&pvc,
+		[]string{AnnBindCompleted, AnnBoundByController, AnnStorageProvisioner, AnnBetaStorageProvisioner, AnnSelectedNode})
+
+	// The PVC was not bound when backed up, so it has no snapshot. Recreate the claim
+	// without volume and data source to be provisioned again.
+	if _, ok := pvcFromBackup.Annotations[util.SkippedUnboundPVCAnnotation]; ok {
+		logger.Info("PVC was not bound to a volume at backup time, restoring its spec only")
+		if replacedPVC != nil {
+			return nil, refuseToReplacePVC(replacedPVC, "the PVC was not bound to a volume at backup time")
+		}
+		removePVCAnnotations(&pvc, []string{util.SkippedUnboundPVCAnnotation})
+		pvc.Spec.VolumeName = ""
+		pvc.Spec.DataSource = nil
+		pvc.Spec.DataSourceRef = nil
+
+		pvcMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pvc)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &velero.RestoreItemActionExecuteOutput{
+			UpdatedItem: &unstructured.Unstructured{Object: pvcMap},
+		}, nil
+	}
+
 	operationID := ""
 
 	// remove the volumesnapshot name annotation as well
@@ -158,6 +231,9 @@ func (p *PVCRestoreItemAction) Execute(input *velero.RestoreItemActionExecuteInp
 
 	if boolptr.IsSetToFalse(input.Restore.Spec.RestorePVs) {
 		logger.Info("Restore did not request for PVs to be restored from snapshot")
+		if replacedPVC != nil {
+			return nil, refuseToReplacePVC(replacedPVC, "the restore did not request for PVs to be restored")
+		}
 		pvc.Spec.VolumeName = ""
 		pvc.Spec.DataSource = nil
 		pvc.Spec.DataSourceRef = nil
@@ -178,16 +254,42 @@ func (p *PVCRestoreItemAction) Execute(input *velero.RestoreItemActionExecuteInp
 			// so return early to let Velero tries to fall back to Velero native snapshot.
 			if _, ok := pvcFromBackup.Annotations[util.DataUploadNameAnnotation]; !ok {
 				logger.Warnf("PVC doesn't have a DataUpload for data mover. Return.")
+				if replacedPVC != nil {
+					return nil, refuseToReplacePVC(replacedPVC, "the PVC doesn't have a DataUpload to restore its data from")
+				}
 				return &velero.RestoreItemActionExecuteOutput{
-					UpdatedItem: input.Item,
+					UpdatedItem: item,
 				}, nil
 			}
 
+			if err := setPVCTargetSize(&pvc, &pvcFromBackup, newNamespace, input.Restore, p.Client, logger); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			dataUploadResult, err := getDataUploadResult(context.Background(), input.Restore, &pvcFromBackup, p.Client)
+			if err != nil {
+				logger.Errorf("Fail to restore from DataUploadResult: %s", err.Error())
+				return nil, errors.Wrapf(err, "fail get DataUploadResult for restore: %s", input.Restore.Name)
+			}
+
+			// The DataDownload must not find the existing PVC, it is replaced before the DataDownload is created.
+			if replacedPVC != nil {
+				if err := p.replaceExistingPVC(replacedPVC, input.Restore, logger); err != nil {
+					return nil, errors.Wrapf(err, "error replacing existing PVC %s/%s", newNamespace, pvc.Name)
+				}
+			}
+
 			operationID = label.GetValidName(string(velerov1api.AsyncOperationIDPrefixDataDownload) + string(input.Restore.UID) + "." + string(pvcFromBackup.UID))
-			dataDownload, err := restoreFromDataUploadResult(context.Background(), input.Restore, backup, &pvc, newNamespace,
-				operationID, p.Client, p.CRClient)
+			dataDownload, err := restoreFromDataUploadResult(context.Background(), input.Restore, backup, dataUploadResult, &pvc, newNamespace,
+				operationID, p.CRClient)
 			if err != nil {
 				logger.Errorf("Fail to restore from DataUploadResult: %s", err.Error())
+				if replacedPVC != nil {
+					// the workloads of the replaced PVC are not left scaled down
+					if scaleErr := p.scaleUpWorkloads(newNamespace, pvc.Name, input.Restore, logger); scaleErr != nil {
+						logger.WithError(scaleErr).Errorf("Failed to scale up the workloads using PVC %s/%s", newNamespace, pvc.Name)
+					}
+				}
 				return nil, errors.WithStack(err)
 			}
 			logger.Infof("DataDownload %s/%s is created successfully.", dataDownload.Namespace, dataDownload.Name)
@@ -195,15 +297,39 @@ func (p *PVCRestoreItemAction) Execute(input *velero.RestoreItemActionExecuteInp
 			volumeSnapshotName, ok := pvcFromBackup.Annotations[util.VolumeSnapshotLabel]
 			if !ok {
 				logger.Info("Skipping PVCRestoreItemAction for PVC , PVC does not have a CSI volumesnapshot.")
+				if replacedPVC != nil {
+					return nil, refuseToReplacePVC(replacedPVC, "the PVC does not have a CSI volumesnapshot to restore it from")
+				}
 				// Make no change in the input PVC.
 				return &velero.RestoreItemActionExecuteOutput{
-					UpdatedItem: input.Item,
+					UpdatedItem: item,
 				}, nil
 			}
-			if err := restoreFromVolumeSnapshot(&pvc, newNamespace, p.SnapshotClient, volumeSnapshotName, logger); err != nil {
+			pluginConfig, err := util.GetPVCRestorePluginConfig(input.Restore.Namespace, p.Client.CoreV1())
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			storageClassMapping, err := util.ParseStorageClassMappingConfig(pluginConfig)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if renamed {
+				volumeSnapshotName = util.RenamedVolumeSnapshotName(volumeSnapshotName, mappedName)
+			}
+			if err := restoreFromVolumeSnapshot(&pvc, newNamespace, p.SnapshotClient, p.Client, volumeSnapshotName, storageClassMapping, logger); err != nil {
 				logger.Errorf("Failed to restore PVC from VolumeSnapshot.")
 				return nil, errors.WithStack(err)
 			}
+			if err := setPVCTargetSize(&pvc, &pvcFromBackup, newNamespace, input.Restore, p.Client, logger); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			if replacedPVC != nil {
+				if err := p.replaceExistingPVC(replacedPVC, input.Restore, logger); err != nil {
+					return nil, errors.Wrapf(err, "error replacing existing PVC %s/%s", newNamespace, pvc.Name)
+				}
+				operationID = newReplaceOperationID(newNamespace, pvc.Name)
+			}
 		}
 	}
 
@@ -235,6 +361,10 @@ func (p *PVCRestoreItemAction) Progress(operationID string, restore *velerov1api
 		"Namespace":   restore.Namespace,
 	})
 
+	if namespace, name, ok := parseReplaceOperationID(operationID); ok {
+		return p.progressReplace(namespace, name, restore, logger)
+	}
+
 	dataDownload, err := getDataDownload(context.Background(), restore.Namespace, operationID, p.CRClient)
 	if err != nil {
 		logger.Errorf("fail to get DataDownload: %s", err.Error())
@@ -259,6 +389,10 @@ func (p *PVCRestoreItemAction) Progress(operationID string, restore *velerov1api
 		progress.Updated = dataDownload.Status.CompletionTimestamp.Time
 	}
 
+	if progressErr := p.scaleUpWorkloadsOfDataDownload(dataDownload, restore, logger); progressErr != nil {
+		return progress, progressErr
+	}
+
 	if dataDownload.Status.Phase == velerov2alpha1.DataDownloadPhaseCompleted {
 		progress.Completed = true
 	} else if dataDownload.Status.Phase == velerov2alpha1.DataDownloadPhaseCanceled {
@@ -282,6 +416,11 @@ func (p *PVCRestoreItemAction) Cancel(operationID string, restore *velerov1api.R
 		"Namespace":   restore.Namespace,
 	})
 
+	if namespace, name, ok := parseReplaceOperationID(operationID); ok {
+		// the workloads of the replaced PVC are not left scaled down
+		return p.scaleUpWorkloads(namespace, name, restore, logger)
+	}
+
 	dataDownload, err := getDataDownload(context.Background(), restore.Namespace, operationID, p.CRClient)
 	if err != nil {
 		logger.Errorf("fail to get DataDownload: %s", err.Error())
@@ -291,8 +430,38 @@ func (p *PVCRestoreItemAction) Cancel(operationID string, restore *velerov1api.R
 	err = cancelDataDownload(context.Background(), p.CRClient, dataDownload)
 	if err != nil {
 		logger.Errorf("fail to cancel DataDownload %s: %s", dataDownload.Name, err.Error())
+		return err
 	}
-	return err
+	return p.scaleUpWorkloads(dataDownload.Spec.TargetVolume.Namespace, dataDownload.Spec.TargetVolume.PVC, restore, logger)
+}
+
+// progressReplace completes the operation of a replaced PVC once it is restored, scaling its workloads back up.
+func (p *PVCRestoreItemAction) progressReplace(namespace, name string, restore *velerov1api.Restore, logger logrus.FieldLogger) (velero.OperationProgress, error) {
+	progress := velero.OperationProgress{}
+	pvc, err := p.getExistingPVC(namespace, name)
+	if err != nil {
+		return progress, err
+	}
+	if pvc == nil {
+		progress.Description = "Waiting for the PVC to be restored"
+		return progress, nil
+	}
+
+	if err := p.scaleUpWorkloads(namespace, name, restore, logger); err != nil {
+		return progress, err
+	}
+	progress.Description = "Restored, workloads scaled up"
+	progress.Completed = true
+	return progress, nil
+}
+
+// scaleUpWorkloadsOfDataDownload scales back up the workloads of a replaced PVC once the data is restored into it.
+func (p *PVCRestoreItemAction) scaleUpWorkloadsOfDataDownload(dataDownload *velerov2alpha1.DataDownload, restore *velerov1api.Restore, logger logrus.FieldLogger) error {
+	switch dataDownload.Status.Phase {
+	case velerov2alpha1.DataDownloadPhaseCompleted, velerov2alpha1.DataDownloadPhaseCanceled, velerov2alpha1.DataDownloadPhaseFailed:
+		return p.scaleUpWorkloads(dataDownload.Spec.TargetVolume.Namespace, dataDownload.Spec.TargetVolume.PVC, restore, logger)
+	}
+	return nil
 }
 
 func (p *PVCRestoreItemAction) AreAdditionalItemsReady(additionalItems []velero.ResourceIdentifier, restore *velerov1api.Restore) (bool, error) {
@@ -412,25 +581,32 @@ func newDataDownload(restore *velerov1api.Restore, backup *velerov1api.Backup, d
 }
 
 func restoreFromVolumeSnapshot(pvc *corev1api.PersistentVolumeClaim, newNamespace string, snapClient snapshotterClientSet.Interface,
-	volumeSnapshotName string, logger logrus.FieldLogger) error {
+	kubeClient kubernetes.Interface, volumeSnapshotName string, storageClassMapping map[string]string, logger logrus.FieldLogger) error {
 	vs, err := snapClient.SnapshotV1().VolumeSnapshots(newNamespace).Get(context.TODO(), volumeSnapshotName, metav1.GetOptions{})
 	if err != nil {
 		return errors.Wrapf(err, fmt.Sprintf("Failed to get Volumesnapshot %s/%s to restore PVC %s/%s", newNamespace, volumeSnapshotName, newNamespace, pvc.Name))
 	}
 
-	if _, exists := vs.Annotations[util.VolumeSnapshotRestoreSize]; exists {
-		restoreSize, err := resource.ParseQuantity(vs.Annotations[util.VolumeSnapshotRestoreSize])
-		if err != nil {
-			return errors.Wrapf(err, fmt.Sprintf("Failed to parse %s from annotation on Volumesnapshot %s/%s into restore size",
-				vs.Annotations[util.VolumeSnapshotRestoreSize], vs.Namespace, vs.Name))
-		}
+	metadata, err := util.GetVolumeSnapshotMetadata(vs)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get the metadata of Volumesnapshot %s/%s to restore PVC %s/%s", vs.Namespace, vs.Name, newNamespace, pvc.Name)
+	}
+	if metadata != nil && metadata.RestoreSize != nil {
 		// It is possible that the volume provider allocated a larger capacity volume than what was requested in the backed up PVC.
 		// In this scenario the volumesnapshot of the PVC will end being larger than its requested storage size.
 		// Such a PVC, on restore as-is, will be stuck attempting to use a Volumesnapshot as a data source for a PVC that
 		// is not large enough.
 		// To counter that, here we set the storage request on the PVC to the larger of the PVC's storage request and the size of the
 		// VolumeSnapshot
-		setPVCStorageResourceRequest(pvc, restoreSize, logger)
+		setPVCStorageResourceRequest(pvc, *metadata.RestoreSize, logger)
+	}
+
+	driver := ""
+	if metadata != nil {
+		driver = metadata.Driver
+	}
+	if err := changeStorageClass(pvc, newNamespace, storageClassMapping, driver, kubeClient, logger); err != nil {
+		return err
 	}
 
 	resetPVCSpec(pvc, volumeSnapshotName)
@@ -438,12 +614,97 @@ func restoreFromVolumeSnapshot(pvc *corev1api.PersistentVolumeClaim, newNamespac
 	return nil
 }
 
-func restoreFromDataUploadResult(ctx context.Context, restore *velerov1api.Restore, backup *velerov1api.Backup, pvc *corev1api.PersistentVolumeClaim,
-	newNamespace, operationID string, kubeClient kubernetes.Interface, crClient crclient.Client) (*velerov2alpha1.DataDownload, error) {
-	dataUploadResult, err := getDataUploadResult(ctx, restore, pvc, kubeClient)
+// changeStorageClass maps the storage class of the PVC restored from a snapshot of the CSI driver, and checks that
+// the storage class it is restored with is provisioned by the driver.
+func changeStorageClass(pvc *corev1api.PersistentVolumeClaim, newNamespace string, storageClassMapping map[string]string,
+	driver string, kubeClient kubernetes.Interface, logger logrus.FieldLogger) error {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return nil
+	}
+
+	storageClassName := *pvc.Spec.StorageClassName
+	newStorageClassName, mapped := storageClassMapping[storageClassName]
+	if mapped {
+		logger.Infof("Changing storage class of PVC %s/%s from %s to %s", newNamespace, pvc.Name, storageClassName, newStorageClassName)
+		pvc.Spec.StorageClassName = &newStorageClassName
+		storageClassName = newStorageClassName
+	}
+
+	storageClass, err := kubeClient.StorageV1().StorageClasses().Get(context.TODO(), storageClassName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) && !mapped {
+		logger.Warnf("Storage class %s of PVC %s/%s is not found, it can be mapped to another storage class with the %s key of the %s plugin config",
+			storageClassName, newNamespace, pvc.Name, util.StorageClassMappingConfigKey, util.PVCRestoreItemActionName)
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "Failed to get storage class %s to restore PVC %s/%s", storageClassName, newNamespace, pvc.Name)
+	}
+
+	if driver == "" {
+		logger.Warnf("CSI driver of the snapshot of PVC %s/%s is unknown, not checking the provisioner of storage class %s", newNamespace, pvc.Name, storageClassName)
+		return nil
+	}
+	if util.GetProvisionerCSIDriver(storageClass.Provisioner) != driver {
+		return errors.Errorf("Storage class %s of PVC %s/%s is provisioned by %s, which can't restore the snapshot of CSI driver %s",
+			storageClassName, newNamespace, pvc.Name, storageClass.Provisioner, driver)
+	}
+	return nil
+}
+
+// setPVCTargetSize sets the storage request of the PVC to the size the restore asks for it, if any. The size can't be smaller
+// than the size of the volume the PVC is restored from, and a larger size requires a storage class allowing volume expansion.
+func setPVCTargetSize(pvc, pvcFromBackup *corev1api.PersistentVolumeClaim, newNamespace string, restore *velerov1api.Restore,
+	kubeClient kubernetes.Interface, logger logrus.FieldLogger) error {
+	storageClassName := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClassName = *pvc.Spec.StorageClassName
+	}
+	targetSize, annotation, err := util.GetRestoreTargetSize(restore, pvcFromBackup.Namespace, pvcFromBackup.Name, storageClassName)
+	if err != nil || targetSize == nil {
+		return err
+	}
+
+	// The request of a PVC restored from a snapshot was already raised to the restore size of the snapshot.
+	sourceSize := pvc.Spec.Resources.Requests[corev1api.ResourceStorage]
+	if capacity, ok := pvcFromBackup.Status.Capacity[corev1api.ResourceStorage]; ok && capacity.Cmp(sourceSize) > 0 {
+		sourceSize = capacity
+	}
+	switch targetSize.Cmp(sourceSize) {
+	case -1:
+		return errors.Errorf("Size %s of PVC %s/%s set by annotation %s is smaller than %s, the size of the volume it is restored from",
+			targetSize.String(), newNamespace, pvc.Name, annotation, sourceSize.String())
+	case 1:
+		if err := checkVolumeExpansion(storageClassName, kubeClient); err != nil {
+			return errors.Wrapf(err, "Failed to restore PVC %s/%s with size %s set by annotation %s, larger than %s, the size of the volume it is restored from",
+				newNamespace, pvc.Name, targetSize.String(), annotation, sourceSize.String())
+		}
+	}
+
+	if pvc.Spec.Resources.Requests == nil {
+		pvc.Spec.Resources.Requests = corev1api.ResourceList{}
+	}
+	pvc.Spec.Resources.Requests[corev1api.ResourceStorage] = *targetSize
+	logger.Infof("Setting storage request of PVC %s/%s to %s set by annotation %s", newNamespace, pvc.Name, targetSize.String(), annotation)
+	return nil
+}
+
+// checkVolumeExpansion checks that the storage class, or the default storage class when it is empty, allows volume expansion.
+func checkVolumeExpansion(storageClassName string, kubeClient kubernetes.Interface) error {
+	storageClass, err := util.GetStorageClassOrDefault(storageClassName, kubeClient.StorageV1())
 	if err != nil {
-		return nil, errors.Wrapf(err, "fail get DataUploadResult for restore: %s", restore.Name)
+		return err
+	}
+	if storageClass == nil {
+		return errors.New("PVC has no storage class and there is no default storage class")
+	}
+
+	if !boolptr.IsSetToTrue(storageClass.AllowVolumeExpansion) {
+		return errors.Errorf("storage class %s does not allow volume expansion", storageClass.Name)
 	}
+	return nil
+}
+
+func restoreFromDataUploadResult(ctx context.Context, restore *velerov1api.Restore, backup *velerov1api.Backup, dataUploadResult *velerov2alpha1.DataUploadResult,
+	pvc *corev1api.PersistentVolumeClaim, newNamespace, operationID string, crClient crclient.Client) (*velerov2alpha1.DataDownload, error) {
 	pvc.Spec.VolumeName = ""
 	if pvc.Spec.Selector == nil {
 		pvc.Spec.Selector = &metav1.LabelSelector{}
@@ -454,22 +715,10 @@ func restoreFromDataUploadResult(ctx context.Context, restore *velerov1api.Resto
 	pvc.Spec.Selector.MatchLabels[util.DynamicPVRestoreLabel] = label.GetValidName(fmt.Sprintf("%s.%s.%s", newNamespace, pvc.Name, utilrand.String(GenerateNameRandomLength)))
 
 	dataDownload := newDataDownload(restore, backup, dataUploadResult, pvc, newNamespace, operationID)
-	err = crClient.Create(ctx, dataDownload)
+	err := crClient.Create(ctx, dataDownload)
 	if err != nil {
 		return nil, errors.Wrapf(err, "fail to create DataDownload")
 	}
 
 	return dataDownload, nil
 }
-
-func (p *PVCRestoreItemAction) isResourceExist(pvc corev1api.PersistentVolumeClaim, restore velerov1api.Restore) bool {
-	// get target namespace to restore into, if different from source namespace
-	targetNamespace := pvc.Namespace
-	if target, ok := restore.Spec.NamespaceMapping[pvc.Namespace]; ok {
-		targetNamespace = target
-	}
-	if _, err := p.Client.CoreV1().PersistentVolumeClaims(targetNamespace).Get(context.Background(), pvc.Name, metav1.GetOptions{}); err == nil {
-		return true
-	}
-	return false
-}
@@ -29,6 +29,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1api "k8s.io/api/core/v1"
+	storagev1api "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -431,6 +432,7 @@ func TestProgress(t *testing.T) {
 		t.Run(tc.name, func(*testing.T) {
 			pvcRIA := PVCRestoreItemAction{
 				Log:      logrus.New(),
+				Client:   fake.NewSimpleClientset(),
 				CRClient: velerotest.NewFakeControllerRuntimeClient(t),
 			}
 			if tc.dataDownload != nil {
@@ -523,6 +525,7 @@ func TestCancel(t *testing.T) {
 		t.Run(tc.name, func(*testing.T) {
 			pvcRIA := PVCRestoreItemAction{
 				Log:      logrus.New(),
+				Client:   fake.NewSimpleClientset(),
 				CRClient: velerotest.NewFakeControllerRuntimeClient(t),
 			}
 			if tc.dataDownload != nil {
@@ -554,9 +557,12 @@ func TestExecute(t *testing.T) {
 		pvc                  *corev1api.PersistentVolumeClaim
 		vs                   *snapshotv1api.VolumeSnapshot
 		dataUploadResult     *corev1api.ConfigMap
+		pluginConfig         *corev1api.ConfigMap
+		storageClass         *storagev1api.StorageClass
 		expectedErr          string
 		expectedDataDownload *velerov2alpha1.DataDownload
 		expectedPVC          *corev1api.PersistentVolumeClaim
+		expectedSize         string
 		preCreatePVC         bool
 	}{
 		{
@@ -565,6 +571,14 @@ func TestExecute(t *testing.T) {
 			pvc:         builder.ForPersistentVolumeClaim("velero", "testPVC").Result(),
 			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").VolumeName("").Result(),
 		},
+		{
+			name:    "Restore PVC that was not bound at backup time",
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.SkippedUnboundPVCAnnotation, "true", AnnSelectedNode, "node1")).
+				DataSource(&corev1api.TypedLocalObjectReference{APIGroup: &snapshotv1api.SchemeGroupVersion.Group, Kind: util.VolumeSnapshotKindName, Name: "testVS"}).
+				Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").Result(),
+		},
 		{
 			name:        "restore's backup cannot be found",
 			restore:     builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
@@ -590,6 +604,132 @@ func TestExecute(t *testing.T) {
 			vs:          builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotRestoreSize, "10Gi")).Result(),
 			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").Result(),
 		},
+		{
+			name:    "Restore from VolumeSnapshot with metadata record",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).
+				RequestResource(map[corev1api.ResourceName]resource.Quantity{corev1api.ResourceStorage: resource.MustParse("10Gi")}).Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io","restoreSize":"20Gi"}`)).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").Result(),
+		},
+		{
+			name:    "Restore from VolumeSnapshot with metadata record of a later version",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":2}`)).Result(),
+			expectedErr: "Failed to get the metadata of Volumesnapshot velero/testVS to restore PVC velero/testPVC: version 2 of velero.io/csi-volumesnapshot-metadata annotation of volumesnapshot velero/testVS is not supported, the latest supported version is 1",
+		},
+		{
+			name:    "Restore from VolumeSnapshot with mapped storage class",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("oldSC").Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io"}`)).Result(),
+			pluginConfig: storageClassMappingConfig("oldSC: newSC"),
+			storageClass: builder.ForStorageClass("newSC").Provisioner("hostpath.csi.k8s.io").Result(),
+			expectedPVC:  builder.ForPersistentVolumeClaim("velero", "testPVC").StorageClass("newSC").Result(),
+		},
+		{
+			name:    "Restore from VolumeSnapshot with storage class of in-tree plugin migrated to the CSI driver",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("gp2").Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"ebs.csi.aws.com"}`)).Result(),
+			storageClass: builder.ForStorageClass("gp2").Provisioner("kubernetes.io/aws-ebs").Result(),
+			expectedPVC:  builder.ForPersistentVolumeClaim("velero", "testPVC").StorageClass("gp2").Result(),
+		},
+		{
+			name:    "Restore from VolumeSnapshot with storage class which is not found",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("oldSC").Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io"}`)).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "testPVC").StorageClass("oldSC").Result(),
+		},
+		{
+			name:    "Fail to restore from VolumeSnapshot with mapped storage class which is not found",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("oldSC").Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io"}`)).Result(),
+			pluginConfig: storageClassMappingConfig("oldSC: newSC"),
+			expectedErr:  "Failed to get storage class newSC to restore PVC velero/testPVC: storageclasses.storage.k8s.io \"newSC\" not found",
+		},
+		{
+			name:    "Fail to restore from VolumeSnapshot with storage class of another provisioner",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("oldSC").Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io"}`)).Result(),
+			pluginConfig: storageClassMappingConfig("oldSC: newSC"),
+			storageClass: builder.ForStorageClass("newSC").Provisioner("ebs.csi.aws.com").Result(),
+			expectedErr:  "Storage class newSC of PVC velero/testPVC is provisioned by ebs.csi.aws.com, which can't restore the snapshot of CSI driver hostpath.csi.k8s.io",
+		},
+		{
+			name:   "Restore renamed PVC from the renamed VolumeSnapshot",
+			backup: builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithAnnotations(util.PVCRenameMappingRestoreAnnotation, "velero/testPVC: new-pvc")).Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).Result(),
+			vs: builder.ForVolumeSnapshot("velero", util.RenamedVolumeSnapshotName("testVS", "new-pvc")).ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io"}`)).Result(),
+			expectedPVC: builder.ForPersistentVolumeClaim("velero", "new-pvc").ObjectMeta(builder.WithAnnotations(util.RestoredFromPVCAnnotation, "testPVC")).Result(),
+		},
+		{
+			name:    "Fail to restore PVC with invalid rename mapping",
+			backup:  builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").ObjectMeta(builder.WithAnnotations(util.PVCRenameMappingRestoreAnnotation, "[testPVC]")).Result(),
+			pvc:     builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).Result(),
+			expectedErr: "error parsing annotation velero.io/csi-pvc-rename-mapping of restore testRestore: error unmarshaling JSON: " +
+				"while decoding JSON: json: cannot unmarshal array into Go value of type util.PVCRenameMapping",
+		},
+		{
+			name:   "Restore from VolumeSnapshot into a larger volume",
+			backup: builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithAnnotations(util.PVCSizeMappingRestoreAnnotation, "velero/testPVC: 20Gi")).Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("sc").
+				RequestResource(map[corev1api.ResourceName]resource.Quantity{corev1api.ResourceStorage: resource.MustParse("5Gi")}).Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io","restoreSize":"10Gi"}`)).Result(),
+			storageClass: expandableStorageClass("sc", "hostpath.csi.k8s.io"),
+			expectedPVC:  builder.ForPersistentVolumeClaim("velero", "testPVC").StorageClass("sc").Result(),
+			expectedSize: "20Gi",
+		},
+		{
+			name:   "Fail to restore from VolumeSnapshot into a volume smaller than the snapshot",
+			backup: builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithAnnotations(util.PVCSizeMappingRestoreAnnotation, "testPVC: 8Gi")).Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("sc").
+				RequestResource(map[corev1api.ResourceName]resource.Quantity{corev1api.ResourceStorage: resource.MustParse("5Gi")}).Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io","restoreSize":"10Gi"}`)).Result(),
+			storageClass: expandableStorageClass("sc", "hostpath.csi.k8s.io"),
+			expectedErr:  "Size 8Gi of PVC velero/testPVC set by annotation velero.io/csi-pvc-size-mapping is smaller than 10Gi, the size of the volume it is restored from",
+		},
+		{
+			name:   "Fail to restore from VolumeSnapshot into a larger volume of a storage class not allowing volume expansion",
+			backup: builder.ForBackup("velero", "testBackup").Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithAnnotations(util.StorageClassSizeMappingRestoreAnnotation, "sc: 20Gi")).Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotLabel, "testVS")).StorageClass("sc").
+				RequestResource(map[corev1api.ResourceName]resource.Quantity{corev1api.ResourceStorage: resource.MustParse("10Gi")}).Result(),
+			vs: builder.ForVolumeSnapshot("velero", "testVS").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io","restoreSize":"10Gi"}`)).Result(),
+			storageClass: builder.ForStorageClass("sc").Provisioner("hostpath.csi.k8s.io").Result(),
+			expectedErr: "Failed to restore PVC velero/testPVC with size 20Gi set by annotation velero.io/csi-storage-class-size-mapping, larger than 10Gi, " +
+				"the size of the volume it is restored from: storage class sc does not allow volume expansion",
+		},
 		{
 			name:        "Restore from VolumeSnapshot without volume-snapshot-name annotation",
 			backup:      builder.ForBackup("velero", "testBackup").Result(),
@@ -618,6 +758,45 @@ func TestExecute(t *testing.T) {
 					builder.WithLabelsMap(map[string]string{velerov1api.AsyncOperationIDLabel: "dd-uid.", velerov1api.RestoreNameLabel: "testRestore", velerov1api.RestoreUIDLabel: "uid"}),
 					builder.WithGenerateName("testRestore-")).Result(),
 		},
+		{
+			name:   "Restore renamed PVC from DataUploadResult",
+			backup: builder.ForBackup("velero", "testBackup").SnapshotMoveData(true).Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithUID("uid"), builder.WithAnnotations(util.PVCRenameMappingRestoreAnnotation, "testPVC: new-pvc")).Result(),
+			pvc:              builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.DataUploadNameAnnotation, "velero/")).Result(),
+			dataUploadResult: builder.ForConfigMap("velero", "testCM").Data("uid", "{}").ObjectMeta(builder.WithLabels(velerov1api.RestoreUIDLabel, "uid", velerov1api.PVCNamespaceNameLabel, "velero.testPVC", velerov1api.ResourceUsageLabel, label.GetValidName(string(velerov1api.VeleroResourceUsageDataUploadResult)))).Result(),
+			expectedPVC:      builder.ForPersistentVolumeClaim("velero", "new-pvc").ObjectMeta(builder.WithAnnotations(util.RestoredFromPVCAnnotation, "testPVC")).Result(),
+			expectedDataDownload: builder.ForDataDownload("velero", "name").TargetVolume(velerov2alpha1.TargetVolumeSpec{PVC: "new-pvc", Namespace: "velero"}).
+				ObjectMeta(builder.WithOwnerReference([]metav1.OwnerReference{{APIVersion: velerov1api.SchemeGroupVersion.String(), Kind: "Restore", Name: "testRestore", UID: "uid", Controller: boolptr.True()}}),
+					builder.WithLabelsMap(map[string]string{velerov1api.AsyncOperationIDLabel: "dd-uid.", velerov1api.RestoreNameLabel: "testRestore", velerov1api.RestoreUIDLabel: "uid"}),
+					builder.WithGenerateName("testRestore-")).Result(),
+		},
+		{
+			name:   "Restore from DataUploadResult into a larger volume of the default storage class",
+			backup: builder.ForBackup("velero", "testBackup").SnapshotMoveData(true).Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithUID("uid"), builder.WithAnnotations(util.PVCSizeMappingRestoreAnnotation, "testPVC: 20Gi")).Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.DataUploadNameAnnotation, "velero/")).
+				RequestResource(map[corev1api.ResourceName]resource.Quantity{corev1api.ResourceStorage: resource.MustParse("10Gi")}).Result(),
+			dataUploadResult: builder.ForConfigMap("velero", "testCM").Data("uid", "{}").ObjectMeta(builder.WithLabels(velerov1api.RestoreUIDLabel, "uid", velerov1api.PVCNamespaceNameLabel, "velero.testPVC", velerov1api.ResourceUsageLabel, label.GetValidName(string(velerov1api.VeleroResourceUsageDataUploadResult)))).Result(),
+			storageClass: func() *storagev1api.StorageClass {
+				sc := expandableStorageClass("default", "hostpath.csi.k8s.io")
+				sc.Annotations = map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}
+				return sc
+			}(),
+			expectedPVC:  builder.ForPersistentVolumeClaim("velero", "testPVC").Result(),
+			expectedSize: "20Gi",
+		},
+		{
+			name:   "Fail to restore from DataUploadResult into a larger volume without storage class",
+			backup: builder.ForBackup("velero", "testBackup").SnapshotMoveData(true).Result(),
+			restore: builder.ForRestore("velero", "testRestore").Backup("testBackup").
+				ObjectMeta(builder.WithUID("uid"), builder.WithAnnotations(util.PVCSizeMappingRestoreAnnotation, "testPVC: 20Gi")).Result(),
+			pvc: builder.ForPersistentVolumeClaim("velero", "testPVC").ObjectMeta(builder.WithAnnotations(util.DataUploadNameAnnotation, "velero/")).
+				RequestResource(map[corev1api.ResourceName]resource.Quantity{corev1api.ResourceStorage: resource.MustParse("10Gi")}).Result(),
+			expectedErr: "Failed to restore PVC velero/testPVC with size 20Gi set by annotation velero.io/csi-pvc-size-mapping, larger than 10Gi, " +
+				"the size of the volume it is restored from: PVC has no storage class and there is no default storage class",
+		},
 		{
 			name:             "Restore from DataUploadResult with long source PVC namespace and name",
 			backup:           builder.ForBackup("migre209d0da-49c7-45ba-8d5a-3e59fd591ec1", "testBackup").SnapshotMoveData(true).Result(),
@@ -687,6 +866,16 @@ func TestExecute(t *testing.T) {
 				require.NoError(t, err)
 			}
 
+			if tc.pluginConfig != nil {
+				_, err := pvcRIA.Client.CoreV1().ConfigMaps(tc.pluginConfig.Namespace).Create(context.Background(), tc.pluginConfig, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			if tc.storageClass != nil {
+				_, err := pvcRIA.Client.StorageV1().StorageClasses().Create(context.Background(), tc.storageClass, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
 			output, err := pvcRIA.Execute(input)
 			if tc.expectedErr != "" {
 				require.Equal(t, tc.expectedErr, err.Error())
@@ -699,12 +888,20 @@ func TestExecute(t *testing.T) {
 				err := runtime.DefaultUnstructuredConverter.FromUnstructured(output.UpdatedItem.UnstructuredContent(), pvc)
 				require.NoError(t, err)
 				require.Equal(t, tc.expectedPVC.GetObjectMeta(), pvc.GetObjectMeta())
+				require.Equal(t, tc.expectedPVC.Spec.StorageClassName, pvc.Spec.StorageClassName)
+				if tc.expectedSize != "" {
+					size := pvc.Spec.Resources.Requests[corev1api.ResourceStorage]
+					require.Equal(t, tc.expectedSize, size.String())
+				}
+				if _, ok := tc.pvc.Annotations[util.SkippedUnboundPVCAnnotation]; ok {
+					require.Nil(t, pvc.Spec.DataSource)
+				}
 				if pvc.Spec.Selector != nil && pvc.Spec.Selector.MatchLabels != nil {
 					// This is used for long name and namespace case.
-					if len(tc.pvc.Namespace+"."+tc.pvc.Name) >= validation.DNS1035LabelMaxLength {
-						require.Contains(t, pvc.Spec.Selector.MatchLabels[util.DynamicPVRestoreLabel], label.GetValidName(tc.pvc.Namespace + "." + tc.pvc.Name)[:56])
+					if len(tc.expectedPVC.Namespace+"."+tc.expectedPVC.Name) >= validation.DNS1035LabelMaxLength {
+						require.Contains(t, pvc.Spec.Selector.MatchLabels[util.DynamicPVRestoreLabel], label.GetValidName(tc.expectedPVC.Namespace + "." + tc.expectedPVC.Name)[:56])
 					} else {
-						require.Contains(t, pvc.Spec.Selector.MatchLabels[util.DynamicPVRestoreLabel], tc.pvc.Namespace+"."+tc.pvc.Name)
+						require.Contains(t, pvc.Spec.Selector.MatchLabels[util.DynamicPVRestoreLabel], tc.expectedPVC.Namespace+"."+tc.expectedPVC.Name)
 					}
 				}
 			}
@@ -719,3 +916,15 @@ func TestExecute(t *testing.T) {
 		})
 	}
 }
+
+func expandableStorageClass(name, provisioner string) *storagev1api.StorageClass {
+	storageClass := builder.ForStorageClass(name).Provisioner(provisioner).Result()
+	storageClass.AllowVolumeExpansion = boolptr.True()
+	return storageClass
+}
+
+func storageClassMappingConfig(mapping string) *corev1api.ConfigMap {
+	return builder.ForConfigMap("velero", "restore-config").
+		ObjectMeta(builder.WithLabels("velero.io/plugin-config", "", util.PVCRestoreItemActionName, "RestoreItemAction")).
+		Data(util.StorageClassMappingConfigKey, mapping).Result()
+}
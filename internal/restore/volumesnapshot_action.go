@@ -23,10 +23,13 @@ import (
 	"github.com/sirupsen/logrus"
 
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
 	core_v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
 	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
@@ -38,7 +41,9 @@ import (
 
 // VolumeSnapshotRestoreItemAction is a Velero restore item action plugin for VolumeSnapshots
 type VolumeSnapshotRestoreItemAction struct {
-	Log logrus.FieldLogger
+	Log            logrus.FieldLogger
+	Client         kubernetes.Interface
+	SnapshotClient snapshotterClientSet.Interface
 }
 
 // AppliesTo returns information indicating that VolumeSnapshotRestoreItemAction should be invoked while restoring
@@ -56,8 +61,71 @@ func resetVolumeSnapshotSpecForRestore(vs *snapshotv1api.VolumeSnapshot, vscName
 	vs.Spec.Source.VolumeSnapshotContentName = vscName
 }
 
-func resetVolumeSnapshotAnnotation(vs *snapshotv1api.VolumeSnapshot) {
-	vs.ObjectMeta.Annotations[util.CSIVSCDeletionPolicy] = string(snapshotv1api.VolumeSnapshotContentRetain)
+func resetVolumeSnapshotAnnotation(vs *snapshotv1api.VolumeSnapshot, metadata *util.VolumeSnapshotMetadata) error {
+	if _, ok := vs.Annotations[util.VolumeSnapshotMetadataAnnotation]; !ok {
+		vs.ObjectMeta.Annotations[util.CSIVSCDeletionPolicy] = string(snapshotv1api.VolumeSnapshotContentRetain)
+		vs.ObjectMeta.Annotations[util.CSIDriverNameAnnotation] = metadata.Driver
+		return nil
+	}
+	metadata.DeletionPolicy = snapshotv1api.VolumeSnapshotContentRetain
+	annotations, err := metadata.Annotations()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	util.AddAnnotations(&vs.ObjectMeta, annotations)
+	return nil
+}
+
+// restoreVolumeSnapshotClass makes sure the VolumeSnapshotClass of the volumesnapshot exists in the cluster for the driver of its
+// snapshot, re-pointing the volumesnapshot to another class of the driver or creating the backed-up class when it doesn't.
+func (p *VolumeSnapshotRestoreItemAction) restoreVolumeSnapshotClass(vs *snapshotv1api.VolumeSnapshot, metadata *util.VolumeSnapshotMetadata,
+	restore *velerov1api.Restore) error {
+	if vs.Spec.VolumeSnapshotClassName == nil {
+		return nil
+	}
+	className := *vs.Spec.VolumeSnapshotClassName
+	resolved, resolution, err := resolveVolumeSnapshotClass(className, metadata.Driver, p.SnapshotClient.SnapshotV1(), p.Log)
+	if err != nil {
+		return errors.Wrapf(err, "error resolving volumesnapshotclass of volumesnapshot %s/%s", vs.Namespace, vs.Name)
+	}
+
+	switch resolution {
+	case volumeSnapshotClassRepointed:
+		p.Log.Infof("Volumesnapshotclass %s of volumesnapshot %s/%s does not exist for driver %s, re-pointing it to volumesnapshotclass %s",
+			className, vs.Namespace, vs.Name, metadata.Driver, resolved)
+		util.AddAnnotations(&vs.ObjectMeta, map[string]string{
+			util.VolumeSnapshotClassRestoreAnnotation:  util.VolumeSnapshotClassRestoreRepointed,
+			util.BackedUpVolumeSnapshotClassAnnotation: className,
+		})
+	case volumeSnapshotClassMissing:
+		deletionPolicy := metadata.DeletionPolicy
+		if deletionPolicy == "" {
+			deletionPolicy = snapshotv1api.VolumeSnapshotContentDelete
+		}
+		class := snapshotv1api.VolumeSnapshotClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: className,
+				Labels: map[string]string{
+					velerov1api.RestoreNameLabel: label.GetValidName(restore.Name),
+				},
+				Annotations: map[string]string{
+					util.VolumeSnapshotClassRestoreAnnotation: util.VolumeSnapshotClassRestoreCreated,
+				},
+			},
+			Driver:         metadata.Driver,
+			Parameters:     metadata.VolumeSnapshotClassParameters,
+			DeletionPolicy: deletionPolicy,
+		}
+		// another volumesnapshot of the class may have created it meanwhile
+		if _, err := p.SnapshotClient.SnapshotV1().VolumeSnapshotClasses().Create(context.TODO(), &class, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "error creating volumesnapshotclass %s of volumesnapshot %s/%s", className, vs.Namespace, vs.Name)
+		}
+		p.Log.Infof("Volumesnapshotclass %s of volumesnapshot %s/%s does not exist and there is no volumesnapshotclass of driver %s, created it",
+			className, vs.Namespace, vs.Name, metadata.Driver)
+		util.AddAnnotations(&vs.ObjectMeta, map[string]string{util.VolumeSnapshotClassRestoreAnnotation: util.VolumeSnapshotClassRestoreCreated})
+	}
+	vs.Spec.VolumeSnapshotClassName = &resolved
+	return nil
 }
 
 // Execute uses the data such as CSI driver name, storage snapshot handle, snapshot deletion secret (if any) from the annotations
@@ -74,6 +142,11 @@ func (p *VolumeSnapshotRestoreItemAction) Execute(input *velero.RestoreItemActio
 		return &velero.RestoreItemActionExecuteOutput{}, errors.Wrapf(err, "failed to convert input.Item from unstructured")
 	}
 
+	if vs.Annotations[util.SkippedUnboundVolumeSnapshotAnnotation] == "true" {
+		p.Log.Infof("Volumesnapshot %s/%s was not bound to a snapshot when backed up, skipping its restore", vs.Namespace, vs.Name)
+		return &velero.RestoreItemActionExecuteOutput{SkipRestore: true}, nil
+	}
+
 	// If cross-namespace restore is configured, change the namespace
 	// for VolumeSnapshot object to be restored
 	newNamespace, ok := input.Restore.Spec.NamespaceMapping[vs.GetNamespace()]
@@ -82,20 +155,46 @@ func (p *VolumeSnapshotRestoreItemAction) Execute(input *velero.RestoreItemActio
 		newNamespace = vs.Namespace
 	}
 
-	_, snapClient, err := util.GetClients()
+	// If the restore renames the PVC of the volumesnapshot, rename the volumesnapshot too as the PVC
+	// may be restored alongside the one it was backed up from.
+	renameMapping, err := util.GetPVCRenameMapping(input.Restore)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if vs.Spec.Source.PersistentVolumeClaimName != nil {
+		if newPVCName, ok := renameMapping.NewName(vs.Namespace, *vs.Spec.Source.PersistentVolumeClaimName); ok {
+			newName := util.RenamedVolumeSnapshotName(vs.Name, newPVCName)
+			p.Log.Infof("Restoring volumesnapshot %s/%s of renamed PVC %s as %s/%s", vs.Namespace, vs.Name, newPVCName, newNamespace, newName)
+			vs.Name = newName
+		}
+	}
 
-	if !util.IsVolumeSnapshotExists(newNamespace, vs.Name, snapClient.SnapshotV1()) {
-		snapHandle, exists := vs.Annotations[util.VolumeSnapshotHandleAnnotation]
-		if !exists {
-			return nil, errors.Errorf("Volumesnapshot %s/%s does not have a %s annotation", vs.Namespace, vs.Name, util.VolumeSnapshotHandleAnnotation)
+	if !util.IsVolumeSnapshotExists(newNamespace, vs.Name, p.SnapshotClient.SnapshotV1()) {
+		metadata, err := util.GetVolumeSnapshotMetadata(&vs)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if metadata == nil || metadata.SnapshotHandle == "" {
+			return nil, errors.Errorf("Volumesnapshot %s/%s does not have a snapshot handle in its %s annotation", vs.Namespace, vs.Name, util.VolumeSnapshotMetadataAnnotation)
+		}
+		if metadata.Driver == "" {
+			return nil, errors.Errorf("Volumesnapshot %s/%s does not have a CSI driver name in its %s annotation", vs.Namespace, vs.Name, util.VolumeSnapshotMetadataAnnotation)
 		}
 
-		csiDriverName, exists := vs.Annotations[util.CSIDriverNameAnnotation]
-		if !exists {
-			return nil, errors.Errorf("Volumesnapshot %s/%s does not have a %s annotation", vs.Namespace, vs.Name, util.CSIDriverNameAnnotation)
+		pluginConfig, err := util.GetPVCRestorePluginConfig(input.Restore.Namespace, p.Client.CoreV1())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		driverMapping, err := util.ParseCSIDriverMappingConfig(pluginConfig)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if driver := util.MapCSIDriver(metadata.Driver, driverMapping); driver != metadata.Driver {
+			p.Log.Infof("Restoring volumesnapshot %s/%s of driver %s with driver %s", vs.Namespace, vs.Name, metadata.Driver, driver)
+			metadata.Driver = driver
+		}
+		if err := p.restoreVolumeSnapshotClass(&vs, metadata, input.Restore); err != nil {
+			return nil, err
 		}
 
 		p.Log.Debugf("Set VolumeSnapshotContent %s/%s DeletionPolicy to Retain to make sure VS deletion in namespace will not delete Snapshot on cloud provider.",
@@ -111,15 +210,16 @@ func (p *VolumeSnapshotRestoreItemAction) Execute(input *velero.RestoreItemActio
 			},
 			Spec: snapshotv1api.VolumeSnapshotContentSpec{
 				DeletionPolicy: snapshotv1api.VolumeSnapshotContentRetain,
-				Driver:         csiDriverName,
+				Driver:         metadata.Driver,
 				VolumeSnapshotRef: core_v1.ObjectReference{
 					Kind:      util.VolumeSnapshotKindName,
 					Namespace: newNamespace,
 					Name:      vs.Name,
 				},
 				Source: snapshotv1api.VolumeSnapshotContentSource{
-					SnapshotHandle: &snapHandle,
+					SnapshotHandle: &metadata.SnapshotHandle,
 				},
+				SourceVolumeMode: metadata.VolumeMode,
 			},
 		}
 
@@ -129,7 +229,7 @@ func (p *VolumeSnapshotRestoreItemAction) Execute(input *velero.RestoreItemActio
 		// between the volumesnapshotcontent and volumesnapshot objects have to be setup.
 		// Further, it is disallowed to convert a dynamically created volumesnapshotcontent for static binding.
 		// See: https://github.com/kubernetes-csi/external-snapshotter/issues/274
-		vscupd, err := snapClient.SnapshotV1().VolumeSnapshotContents().Create(context.TODO(), &vsc, metav1.CreateOptions{})
+		vscupd, err := p.SnapshotClient.SnapshotV1().VolumeSnapshotContents().Create(context.TODO(), &vsc, metav1.CreateOptions{})
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to create volumesnapshotcontents %s", vsc.GenerateName)
 		}
@@ -139,7 +239,9 @@ func (p *VolumeSnapshotRestoreItemAction) Execute(input *velero.RestoreItemActio
 		resetVolumeSnapshotSpecForRestore(&vs, &vscupd.Name)
 
 		// Reset VolumeSnapshot annotation. By now, only change DeletionPolicy to Retain.
-		resetVolumeSnapshotAnnotation(&vs)
+		if err := resetVolumeSnapshotAnnotation(&vs, metadata); err != nil {
+			return nil, err
+		}
 	}
 
 	vsMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&vs)
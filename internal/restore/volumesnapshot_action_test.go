@@ -17,12 +17,25 @@ limitations under the License.
 package restore
 
 import (
+	"context"
 	"testing"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotfake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	corev1api "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
 )
 
 var (
@@ -88,3 +101,188 @@ func TestResetVolumeSnapshotSpecForRestore(t *testing.T) {
 		})
 	}
 }
+
+func TestVolumeSnapshotRestoreExecute(t *testing.T) {
+	metadata := `{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io","deletionPolicy":"Delete","userCreated":true}`
+
+	tests := []struct {
+		name            string
+		vs              *snapshotv1api.VolumeSnapshot
+		expectedSkip    bool
+		expectedErr     bool
+		expectedContent bool
+		restore         *velerov1api.Restore
+		expectedName    string
+		classes         []runtime.Object
+		pluginConfig    *corev1api.ConfigMap
+		// expectedClass and expectedClassRestore are the class of the restored volumesnapshot and its VolumeSnapshotClassRestoreAnnotation
+		expectedClass        string
+		expectedClassRestore string
+		expectedDriver       string
+	}{
+		{
+			name:            "volumesnapshot created outside of velero is statically bound to its snapshot",
+			vs:              builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation, metadata)).SourcePVC("pvc").Result(),
+			expectedContent: true,
+		},
+		{
+			name: "volumesnapshot of renamed PVC is renamed",
+			vs:   builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation, metadata)).SourcePVC("pvc").Result(),
+			restore: builder.ForRestore("velero", "restore").
+				ObjectMeta(builder.WithAnnotations(util.PVCRenameMappingRestoreAnnotation, "ns/pvc: new-pvc")).Result(),
+			expectedContent: true,
+			expectedName:    util.RenamedVolumeSnapshotName("vs", "new-pvc"),
+		},
+		{
+			name: "volumesnapshot of existing volumesnapshotclass keeps it",
+			vs: builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation, metadata)).
+				SourcePVC("pvc").VolumeSnapshotClass("class").Result(),
+			classes:         []runtime.Object{builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result()},
+			expectedContent: true,
+			expectedClass:   "class",
+		},
+		{
+			name: "volumesnapshot of missing volumesnapshotclass is re-pointed to the labeled class of its driver",
+			vs: builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation, metadata)).
+				SourcePVC("pvc").VolumeSnapshotClass("class").Result(),
+			classes: []runtime.Object{
+				builder.ForVolumeSnapshotClass("other").Driver("hostpath.csi.k8s.io").Result(),
+				builder.ForVolumeSnapshotClass("labeled").Driver("hostpath.csi.k8s.io").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "true")).Result(),
+			},
+			expectedContent:      true,
+			expectedClass:        "labeled",
+			expectedClassRestore: util.VolumeSnapshotClassRestoreRepointed,
+		},
+		{
+			name: "missing volumesnapshotclass is created when there is no class of its driver",
+			vs: builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation,
+				`{"version":1,"snapshotHandle":"handle","driver":"hostpath.csi.k8s.io","volumeSnapshotClassName":"class","volumeSnapshotClassParameters":{"type":"ssd"},"userCreated":true}`)).
+				SourcePVC("pvc").VolumeSnapshotClass("class").Result(),
+			classes:              []runtime.Object{builder.ForVolumeSnapshotClass("other").Driver("ebs.csi.aws.com").Result()},
+			expectedContent:      true,
+			expectedClass:        "class",
+			expectedClassRestore: util.VolumeSnapshotClassRestoreCreated,
+		},
+		{
+			name: "volumesnapshot of mapped driver is re-pointed to the class of the mapped driver",
+			vs: builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation, metadata)).
+				SourcePVC("pvc").VolumeSnapshotClass("class").Result(),
+			classes: []runtime.Object{
+				builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+				builder.ForVolumeSnapshotClass("ebs").Driver("ebs.csi.aws.com").Result(),
+			},
+			pluginConfig:         csiDriverMappingConfig("hostpath.csi.k8s.io: ebs.csi.aws.com"),
+			expectedContent:      true,
+			expectedClass:        "ebs",
+			expectedClassRestore: util.VolumeSnapshotClassRestoreRepointed,
+			expectedDriver:       "ebs.csi.aws.com",
+		},
+		{
+			name: "volumesnapshotclass of another driver with no class of the driver of the volumesnapshot",
+			vs: builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.VolumeSnapshotMetadataAnnotation, metadata)).
+				SourcePVC("pvc").VolumeSnapshotClass("class").Result(),
+			classes:     []runtime.Object{builder.ForVolumeSnapshotClass("class").Driver("ebs.csi.aws.com").Result()},
+			expectedErr: true,
+		},
+		{
+			name:         "volumesnapshot not bound when backed up is skipped",
+			vs:           builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(util.SkippedUnboundVolumeSnapshotAnnotation, "true")).Result(),
+			expectedSkip: true,
+		},
+		{
+			name:        "volumesnapshot without snapshot handle",
+			vs:          builder.ForVolumeSnapshot("ns", "vs").Result(),
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if tc.pluginConfig != nil {
+				client = fake.NewSimpleClientset(tc.pluginConfig)
+			}
+			snapshotClient := snapshotfake.NewSimpleClientset(tc.classes...)
+			vsRIA := VolumeSnapshotRestoreItemAction{
+				Log:            logrus.New(),
+				Client:         client,
+				SnapshotClient: snapshotClient,
+			}
+			expectedDriver := tc.expectedDriver
+			if expectedDriver == "" {
+				expectedDriver = "hostpath.csi.k8s.io"
+			}
+			item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.vs)
+			require.NoError(t, err)
+
+			restore := tc.restore
+			if restore == nil {
+				restore = builder.ForRestore("velero", "restore").Result()
+			}
+			expectedName := tc.expectedName
+			if expectedName == "" {
+				expectedName = tc.vs.Name
+			}
+
+			output, err := vsRIA.Execute(&velero.RestoreItemActionExecuteInput{
+				Item:    &unstructured.Unstructured{Object: item},
+				Restore: restore,
+			})
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSkip, output.SkipRestore)
+
+			vscList, err := snapshotClient.SnapshotV1().VolumeSnapshotContents().List(context.TODO(), metav1.ListOptions{})
+			require.NoError(t, err)
+			if !tc.expectedContent {
+				assert.Empty(t, vscList.Items)
+				return
+			}
+			require.Len(t, vscList.Items, 1)
+			vsc := vscList.Items[0]
+			assert.Equal(t, snapshotv1api.VolumeSnapshotContentRetain, vsc.Spec.DeletionPolicy)
+			assert.Equal(t, expectedDriver, vsc.Spec.Driver)
+			assert.Equal(t, "handle", *vsc.Spec.Source.SnapshotHandle)
+			assert.Equal(t, expectedName, vsc.Spec.VolumeSnapshotRef.Name)
+			assert.Equal(t, "velero-"+expectedName+"-", vsc.GenerateName)
+
+			restored := new(snapshotv1api.VolumeSnapshot)
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(output.UpdatedItem.UnstructuredContent(), restored))
+			assert.Equal(t, expectedName, restored.Name)
+			assert.Nil(t, restored.Spec.Source.PersistentVolumeClaimName)
+			restoredMetadata, err := util.GetVolumeSnapshotMetadata(restored)
+			require.NoError(t, err)
+			assert.Equal(t, snapshotv1api.VolumeSnapshotContentRetain, restoredMetadata.DeletionPolicy)
+			assert.True(t, restoredMetadata.UserCreated)
+			assert.Equal(t, expectedDriver, restoredMetadata.Driver)
+
+			if tc.expectedClass == "" {
+				assert.Nil(t, restored.Spec.VolumeSnapshotClassName)
+				return
+			}
+			require.NotNil(t, restored.Spec.VolumeSnapshotClassName)
+			assert.Equal(t, tc.expectedClass, *restored.Spec.VolumeSnapshotClassName)
+			assert.Equal(t, tc.expectedClassRestore, restored.Annotations[util.VolumeSnapshotClassRestoreAnnotation])
+			if tc.expectedClassRestore == util.VolumeSnapshotClassRestoreRepointed {
+				assert.Equal(t, *tc.vs.Spec.VolumeSnapshotClassName, restored.Annotations[util.BackedUpVolumeSnapshotClassAnnotation])
+			}
+			class, err := snapshotClient.SnapshotV1().VolumeSnapshotClasses().Get(context.TODO(), tc.expectedClass, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, expectedDriver, class.Driver)
+			if tc.expectedClassRestore == util.VolumeSnapshotClassRestoreCreated {
+				assert.Equal(t, util.VolumeSnapshotClassRestoreCreated, class.Annotations[util.VolumeSnapshotClassRestoreAnnotation])
+				assert.Equal(t, map[string]string{"type": "ssd"}, class.Parameters)
+				assert.Equal(t, snapshotv1api.VolumeSnapshotContentDelete, class.DeletionPolicy)
+			}
+		})
+	}
+}
+
+func csiDriverMappingConfig(mapping string) *corev1api.ConfigMap {
+	return builder.ForConfigMap("velero", "restore-config").
+		ObjectMeta(builder.WithLabels("velero.io/plugin-config", "", util.PVCRestoreItemActionName, "RestoreItemAction")).
+		Data(util.CSIDriverMappingConfigKey, mapping).Result()
+}
@@ -17,12 +17,20 @@ limitations under the License.
 package restore
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
+	snapshotter "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/typed/volumesnapshot/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
 	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
@@ -33,7 +41,63 @@ import (
 
 // VolumeSnapshotClassRestoreItemAction is a Velero restore item action plugin for VolumeSnapshotClass
 type VolumeSnapshotClassRestoreItemAction struct {
-	Log logrus.FieldLogger
+	Log            logrus.FieldLogger
+	Client         kubernetes.Interface
+	SnapshotClient snapshotterClientSet.Interface
+}
+
+// volumeSnapshotClassResolution tells how the backed-up VolumeSnapshotClass of a snapshot is resolved in the cluster.
+type volumeSnapshotClassResolution int
+
+const (
+	// volumeSnapshotClassExists is the resolution of a class which exists with the driver of the snapshot.
+	volumeSnapshotClassExists volumeSnapshotClassResolution = iota
+	// volumeSnapshotClassRepointed is the resolution of a class which doesn't exist, or not with the driver of the snapshot,
+	// another class of the driver is used instead.
+	volumeSnapshotClassRepointed
+	// volumeSnapshotClassMissing is the resolution of a class which doesn't exist while there is no class of the driver,
+	// the backed-up class is to be created.
+	volumeSnapshotClassMissing
+)
+
+// resolveVolumeSnapshotClass resolves the backed-up VolumeSnapshotClass of a snapshot of the driver in the cluster, returning the name of
+// the class to use. Another class of the driver is chosen like for a backup, preferring the classes with the velero.io/csi-volumesnapshot-class label,
+// and the resolution fails if several classes of the driver can be chosen. The class is only missing if there is no class of the driver.
+func resolveVolumeSnapshotClass(name, driver string, snapshotClient snapshotter.SnapshotV1Interface, log logrus.FieldLogger) (string, volumeSnapshotClassResolution, error) {
+	class, err := snapshotClient.VolumeSnapshotClasses().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", 0, errors.Wrapf(err, "error getting volumesnapshotclass %s", name)
+	}
+	exists := err == nil
+	if exists && class.Driver == driver {
+		return name, volumeSnapshotClassExists, nil
+	}
+
+	classes, err := snapshotClient.VolumeSnapshotClasses().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return "", 0, errors.Wrap(err, "error listing volumesnapshotclasses")
+	}
+	hasDriverClass := false
+	for i := range classes.Items {
+		if classes.Items[i].Driver == driver {
+			hasDriverClass = true
+			break
+		}
+	}
+	if !hasDriverClass {
+		if exists {
+			return "", 0, errors.Errorf("volumesnapshotclass %s is of driver %s instead of %s, and there is no volumesnapshotclass of driver %s",
+				name, class.Driver, driver, driver)
+		}
+		return name, volumeSnapshotClassMissing, nil
+	}
+
+	// A class of the driver exists, it must be chosen unambiguously rather than creating another one.
+	driverClass, err := util.GetVolumeSnapshotClassForStorageClass(driver, classes, true, log)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "error choosing the volumesnapshotclass of driver %s to use instead of volumesnapshotclass %s", driver, name)
+	}
+	return driverClass.Name, volumeSnapshotClassRepointed, nil
 }
 
 // AppliesTo returns information indicating that VolumeSnapshotClassRestoreItemAction should be invoked while restoring
@@ -44,7 +108,9 @@ func (p *VolumeSnapshotClassRestoreItemAction) AppliesTo() (velero.ResourceSelec
 	}, nil
 }
 
-// Execute restores volumesnapshotclass objects returning any snapshotlister secret as additional items to restore
+// Execute restores volumesnapshotclass objects returning any snapshotlister secret as additional items to restore.
+// A class which doesn't exist in the cluster is skipped if there is another class of its driver, which its volumesnapshots
+// are re-pointed to by VolumeSnapshotRestoreItemAction, else it is restored with its driver mapped by the plugin config.
 func (p *VolumeSnapshotClassRestoreItemAction) Execute(input *velero.RestoreItemActionExecuteInput) (*velero.RestoreItemActionExecuteOutput, error) {
 	p.Log.Info("Starting VolumeSnapshotClassRestoreItemAction")
 	if boolptr.IsSetToFalse(input.Restore.Spec.RestorePVs) {
@@ -57,6 +123,40 @@ func (p *VolumeSnapshotClassRestoreItemAction) Execute(input *velero.RestoreItem
 		return &velero.RestoreItemActionExecuteOutput{}, errors.Wrapf(err, "failed to convert input.Item from unstructured")
 	}
 
+	pluginConfig, err := util.GetPVCRestorePluginConfig(input.Restore.Namespace, p.Client.CoreV1())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	driverMapping, err := util.ParseCSIDriverMappingConfig(pluginConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	driver := util.MapCSIDriver(snapClass.Driver, driverMapping)
+	resolved, resolution, err := resolveVolumeSnapshotClass(snapClass.Name, driver, p.SnapshotClient.SnapshotV1(), p.Log)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	item := input.Item
+	switch resolution {
+	case volumeSnapshotClassRepointed:
+		p.Log.Infof("Volumesnapshotclass %s does not exist for driver %s, skipping its restore as its volumesnapshots are re-pointed to volumesnapshotclass %s",
+			snapClass.Name, driver, resolved)
+		return &velero.RestoreItemActionExecuteOutput{SkipRestore: true}, nil
+	case volumeSnapshotClassMissing:
+		if driver != snapClass.Driver {
+			p.Log.Infof("Restoring volumesnapshotclass %s of driver %s with driver %s", snapClass.Name, snapClass.Driver, driver)
+			snapClass.Driver = driver
+		}
+		p.Log.Infof("Volumesnapshotclass %s does not exist and there is no volumesnapshotclass of driver %s, creating it", snapClass.Name, driver)
+		util.AddAnnotations(&snapClass.ObjectMeta, map[string]string{util.VolumeSnapshotClassRestoreAnnotation: util.VolumeSnapshotClassRestoreCreated})
+		classMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&snapClass)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		item = &unstructured.Unstructured{Object: classMap}
+	}
+
 	additionalItems := []velero.ResourceIdentifier{}
 	if util.IsVolumeSnapshotClassHasListerSecret(&snapClass) {
 		additionalItems = append(additionalItems, velero.ResourceIdentifier{
@@ -69,7 +169,7 @@ func (p *VolumeSnapshotClassRestoreItemAction) Execute(input *velero.RestoreItem
 	p.Log.Infof("Returning from VolumeSnapshotClassRestoreItemAction with %d additionalItems", len(additionalItems))
 
 	return &velero.RestoreItemActionExecuteOutput{
-		UpdatedItem:     input.Item,
+		UpdatedItem:     item,
 		AdditionalItems: additionalItems,
 	}, nil
 }
@@ -0,0 +1,144 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restore
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotfake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	corev1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+func TestVolumeSnapshotClassRestoreExecute(t *testing.T) {
+	tests := []struct {
+		name               string
+		class              *snapshotv1api.VolumeSnapshotClass
+		classes            []runtime.Object
+		pluginConfig       *corev1api.ConfigMap
+		expectedSkip       bool
+		expectedDriver     string
+		expectedAnnotation string
+		expectedErr        bool
+	}{
+		{
+			name:           "existing volumesnapshotclass is restored as is",
+			class:          builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			classes:        []runtime.Object{builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result()},
+			expectedDriver: "hostpath.csi.k8s.io",
+		},
+		{
+			name:  "missing volumesnapshotclass is skipped when there is a class of its driver",
+			class: builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			classes: []runtime.Object{
+				builder.ForVolumeSnapshotClass("other").Driver("hostpath.csi.k8s.io").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "true")).Result(),
+			},
+			expectedSkip: true,
+		},
+		{
+			name:               "missing volumesnapshotclass is restored when there is no class of its driver",
+			class:              builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			classes:            []runtime.Object{builder.ForVolumeSnapshotClass("other").Driver("ebs.csi.aws.com").Result()},
+			expectedDriver:     "hostpath.csi.k8s.io",
+			expectedAnnotation: util.VolumeSnapshotClassRestoreCreated,
+		},
+		{
+			name:               "missing volumesnapshotclass is restored with its mapped driver",
+			class:              builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			pluginConfig:       csiDriverMappingConfig("hostpath.csi.k8s.io: ebs.csi.aws.com"),
+			expectedDriver:     "ebs.csi.aws.com",
+			expectedAnnotation: util.VolumeSnapshotClassRestoreCreated,
+		},
+		{
+			name:         "missing volumesnapshotclass is skipped when there is a class of its mapped driver",
+			class:        builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			classes:      []runtime.Object{builder.ForVolumeSnapshotClass("ebs").Driver("ebs.csi.aws.com").Result()},
+			pluginConfig: csiDriverMappingConfig("hostpath.csi.k8s.io: ebs.csi.aws.com"),
+			expectedSkip: true,
+		},
+		{
+			name:  "missing volumesnapshotclass with several unlabeled classes of its driver",
+			class: builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			classes: []runtime.Object{
+				builder.ForVolumeSnapshotClass("one").Driver("hostpath.csi.k8s.io").Result(),
+				builder.ForVolumeSnapshotClass("two").Driver("hostpath.csi.k8s.io").Result(),
+			},
+			expectedErr: true,
+		},
+		{
+			name:  "missing volumesnapshotclass with ambiguous labeled classes of its driver",
+			class: builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			classes: []runtime.Object{
+				builder.ForVolumeSnapshotClass("one").Driver("hostpath.csi.k8s.io").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "true")).Result(),
+				builder.ForVolumeSnapshotClass("two").Driver("hostpath.csi.k8s.io").ObjectMeta(builder.WithLabels(util.VolumeSnapshotClassSelectorLabel, "true")).Result(),
+			},
+			expectedErr: true,
+		},
+		{
+			name:         "invalid driver mapping",
+			class:        builder.ForVolumeSnapshotClass("class").Driver("hostpath.csi.k8s.io").Result(),
+			pluginConfig: csiDriverMappingConfig("- hostpath.csi.k8s.io"),
+			expectedErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if tc.pluginConfig != nil {
+				client = fake.NewSimpleClientset(tc.pluginConfig)
+			}
+			action := VolumeSnapshotClassRestoreItemAction{
+				Log:            logrus.New(),
+				Client:         client,
+				SnapshotClient: snapshotfake.NewSimpleClientset(tc.classes...),
+			}
+			item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.class)
+			require.NoError(t, err)
+
+			output, err := action.Execute(&velero.RestoreItemActionExecuteInput{
+				Item:    &unstructured.Unstructured{Object: item},
+				Restore: builder.ForRestore("velero", "restore").Result(),
+			})
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSkip, output.SkipRestore)
+			if tc.expectedSkip {
+				return
+			}
+
+			restored := new(snapshotv1api.VolumeSnapshotClass)
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(output.UpdatedItem.UnstructuredContent(), restored))
+			assert.Equal(t, tc.expectedDriver, restored.Driver)
+			assert.Equal(t, tc.expectedAnnotation, restored.Annotations[util.VolumeSnapshotClassRestoreAnnotation])
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"strconv"
+
+	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	velerov2alpha1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v2alpha1"
+)
+
+const (
+	// Environment variables of the Velero server, inherited by the plugin, configuring the clients of the plugin.
+	ClientQPSEnvVar       = "VELERO_CSI_PLUGIN_CLIENT_QPS"
+	ClientBurstEnvVar     = "VELERO_CSI_PLUGIN_CLIENT_BURST"
+	ClientUserAgentEnvVar = "VELERO_CSI_PLUGIN_CLIENT_USER_AGENT"
+
+	// The defaults match the ones of the Velero server.
+	defaultClientQPS       = 20.0
+	defaultClientBurst     = 30
+	defaultClientUserAgent = "velero-plugin-for-csi"
+)
+
+// ClientOptions configures the clients of the plugin.
+type ClientOptions struct {
+	QPS       float32
+	Burst     int
+	UserAgent string
+}
+
+// ClientOptionsFromEnv returns the client options set by the environment, or their defaults.
+func ClientOptionsFromEnv() (ClientOptions, error) {
+	options := ClientOptions{
+		QPS:       defaultClientQPS,
+		Burst:     defaultClientBurst,
+		UserAgent: defaultClientUserAgent,
+	}
+	if value := os.Getenv(ClientQPSEnvVar); value != "" {
+		qps, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return options, errors.Wrapf(err, "error parsing %s", ClientQPSEnvVar)
+		}
+		if qps <= 0 {
+			return options, errors.Errorf("invalid value %q of %s, it must be positive", value, ClientQPSEnvVar)
+		}
+		options.QPS = float32(qps)
+	}
+	if value := os.Getenv(ClientBurstEnvVar); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil {
+			return options, errors.Wrapf(err, "error parsing %s", ClientBurstEnvVar)
+		}
+		if burst <= 0 {
+			return options, errors.Errorf("invalid value %q of %s, it must be positive", value, ClientBurstEnvVar)
+		}
+		options.Burst = burst
+	}
+	if value := os.Getenv(ClientUserAgentEnvVar); value != "" {
+		options.UserAgent = value
+	}
+	return options, nil
+}
+
+// Clients is the set of clients shared by the actions of the plugin.
+type Clients struct {
+	Config         *rest.Config
+	Client         kubernetes.Interface
+	SnapshotClient snapshotterClientSet.Interface
+	CRClient       crclient.Client
+}
+
+// GetClientConfig returns the REST config of the cluster the plugin runs against.
+func GetClientConfig() (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	configOverrides := &clientcmd.ConfigOverrides{}
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+	clientConfig, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return clientConfig, nil
+}
+
+// NewClients builds the clients of the plugin.
+func NewClients(options ClientOptions) (*Clients, error) {
+	clientConfig, err := GetClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientConfig.QPS = options.QPS
+	clientConfig.Burst = options.Burst
+	clientConfig.UserAgent = options.UserAgent
+
+	client, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	snapshotterClient, err := snapshotterClientSet.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := velerov1api.AddToScheme(scheme); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := velerov2alpha1api.AddToScheme(scheme); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	crClient, err := crclient.New(clientConfig, crclient.Options{
+		Scheme: scheme,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &Clients{
+		Config:         clientConfig,
+		Client:         client,
+		SnapshotClient: snapshotterClient,
+		CRClient:       crClient,
+	}, nil
+}
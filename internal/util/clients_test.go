@@ -0,0 +1,91 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOptionsFromEnv(t *testing.T) {
+	testCases := []struct {
+		name            string
+		env             map[string]string
+		expectedOptions ClientOptions
+		expectedErr     string
+	}{
+		{
+			name: "defaults",
+			expectedOptions: ClientOptions{
+				QPS:       defaultClientQPS,
+				Burst:     defaultClientBurst,
+				UserAgent: defaultClientUserAgent,
+			},
+		},
+		{
+			name: "options set by the environment",
+			env: map[string]string{
+				ClientQPSEnvVar:       "50.5",
+				ClientBurstEnvVar:     "100",
+				ClientUserAgentEnvVar: "velero-csi",
+			},
+			expectedOptions: ClientOptions{
+				QPS:       50.5,
+				Burst:     100,
+				UserAgent: "velero-csi",
+			},
+		},
+		{
+			name:        "QPS which is not a number",
+			env:         map[string]string{ClientQPSEnvVar: "fast"},
+			expectedErr: `error parsing VELERO_CSI_PLUGIN_CLIENT_QPS: strconv.ParseFloat: parsing "fast": invalid syntax`,
+		},
+		{
+			name:        "QPS which is not positive",
+			env:         map[string]string{ClientQPSEnvVar: "0"},
+			expectedErr: `invalid value "0" of VELERO_CSI_PLUGIN_CLIENT_QPS, it must be positive`,
+		},
+		{
+			name:        "burst which is not an integer",
+			env:         map[string]string{ClientBurstEnvVar: "10.5"},
+			expectedErr: `error parsing VELERO_CSI_PLUGIN_CLIENT_BURST: strconv.Atoi: parsing "10.5": invalid syntax`,
+		},
+		{
+			name:        "burst which is not positive",
+			env:         map[string]string{ClientBurstEnvVar: "-1"},
+			expectedErr: `invalid value "-1" of VELERO_CSI_PLUGIN_CLIENT_BURST, it must be positive`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, name := range []string{ClientQPSEnvVar, ClientBurstEnvVar, ClientUserAgentEnvVar} {
+				t.Setenv(name, tc.env[name])
+			}
+
+			options, err := ClientOptionsFromEnv()
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOptions, options)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+)
+
+const (
+	// AnnMigratedTo is set by the PV controller on PVs of in-tree plugins migrated to a CSI driver.
+	AnnMigratedTo = "pv.kubernetes.io/migrated-to"
+
+	AWSEBSCSIDriverName    = "ebs.csi.aws.com"
+	GCEPDCSIDriverName     = "pd.csi.storage.gke.io"
+	AzureDiskCSIDriverName = "disk.csi.azure.com"
+	VSphereCSIDriverName   = "csi.vsphere.vmware.com"
+
+	// gcePDUnspecifiedProject is the project the GCE PD CSI driver resolves to its own one,
+	// in-tree PVs don't record their project.
+	gcePDUnspecifiedProject = "UNSPECIFIED"
+	// gcePDZonesSeparator separates the zones of regional GCE PDs in the zone label value.
+	gcePDZonesSeparator = "__"
+)
+
+// inTreeProvisionerCSIDrivers maps the provisioners of the supported in-tree plugins to the CSI drivers they are migrated to.
+var inTreeProvisionerCSIDrivers = map[string]string{
+	"kubernetes.io/aws-ebs":        AWSEBSCSIDriverName,
+	"kubernetes.io/gce-pd":         GCEPDCSIDriverName,
+	"kubernetes.io/azure-disk":     AzureDiskCSIDriverName,
+	"kubernetes.io/vsphere-volume": VSphereCSIDriverName,
+}
+
+// GetProvisionerCSIDriver returns the CSI driver provisioning the volumes of a StorageClass provisioner.
+// The provisioner of a supported in-tree plugin is translated to the CSI driver it is migrated to.
+func GetProvisionerCSIDriver(provisioner string) string {
+	if driver, ok := inTreeProvisionerCSIDrivers[provisioner]; ok {
+		return driver
+	}
+	return provisioner
+}
+
+// GetCSIPersistentVolumeSource returns the CSI source of the PV. For a PV of an in-tree plugin
+// migrated to CSI, the in-tree source is translated to the source the CSI driver serves it with.
+// nil is returned for PVs which are neither CSI nor migrated from a supported in-tree plugin.
+func GetCSIPersistentVolumeSource(pv *corev1api.PersistentVolume) (*corev1api.CSIPersistentVolumeSource, error) {
+	if pv.Spec.CSI != nil {
+		return pv.Spec.CSI, nil
+	}
+
+	migratedTo := pv.Annotations[AnnMigratedTo]
+	if migratedTo == "" {
+		return nil, nil
+	}
+
+	var driver, volumeHandle string
+	switch {
+	case pv.Spec.AWSElasticBlockStore != nil:
+		driver = AWSEBSCSIDriverName
+		volumeHandle = translateAWSEBSVolumeID(pv.Spec.AWSElasticBlockStore.VolumeID)
+	case pv.Spec.GCEPersistentDisk != nil:
+		driver = GCEPDCSIDriverName
+		handle, err := translateGCEPDVolumeHandle(pv)
+		if err != nil {
+			return nil, err
+		}
+		volumeHandle = handle
+	case pv.Spec.AzureDisk != nil:
+		driver = AzureDiskCSIDriverName
+		volumeHandle = pv.Spec.AzureDisk.DataDiskURI
+	case pv.Spec.VsphereVolume != nil:
+		driver = VSphereCSIDriverName
+		volumeHandle = pv.Spec.VsphereVolume.VolumePath
+	default:
+		// Translation of other in-tree plugins is not supported, handle the PV as non-CSI.
+		return nil, nil
+	}
+
+	if driver != migratedTo {
+		return nil, errors.Errorf("PV %s is migrated to CSI driver %s, but its in-tree volume source is served by %s", pv.Name, migratedTo, driver)
+	}
+
+	return &corev1api.CSIPersistentVolumeSource{
+		Driver:       driver,
+		VolumeHandle: volumeHandle,
+	}, nil
+}
+
+// translateAWSEBSVolumeID strips the "aws://<zone>/" prefix in-tree volume IDs can have.
+func translateAWSEBSVolumeID(volumeID string) string {
+	if !strings.HasPrefix(volumeID, "aws://") {
+		return volumeID
+	}
+	return volumeID[strings.LastIndex(volumeID, "/")+1:]
+}
+
+// translateGCEPDVolumeHandle builds the handle of the disk from its zone labels, as the GCE PD CSI driver expects it.
+func translateGCEPDVolumeHandle(pv *corev1api.PersistentVolume) (string, error) {
+	zoneLabel := pv.Labels[corev1api.LabelTopologyZone]
+	if zoneLabel == "" {
+		zoneLabel = pv.Labels[corev1api.LabelFailureDomainBetaZone]
+	}
+	if zoneLabel == "" {
+		return "", errors.Errorf("failed to translate GCE PD PV %s to CSI, it has no zone label", pv.Name)
+	}
+
+	pdName := pv.Spec.GCEPersistentDisk.PDName
+	zones := strings.Split(zoneLabel, gcePDZonesSeparator)
+	if len(zones) == 1 {
+		return fmt.Sprintf("projects/%s/zones/%s/disks/%s", gcePDUnspecifiedProject, zones[0], pdName), nil
+	}
+
+	// A regional disk is replicated in zones of the same region, e.g. us-central1-a and us-central1-b.
+	idx := strings.LastIndex(zones[0], "-")
+	if idx <= 0 {
+		return "", errors.Errorf("failed to translate GCE PD PV %s to CSI, invalid zone %s", pv.Name, zones[0])
+	}
+	region := zones[0][:idx]
+	return fmt.Sprintf("projects/%s/regions/%s/disks/%s", gcePDUnspecifiedProject, region, pdName), nil
+}
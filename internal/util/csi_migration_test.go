@@ -0,0 +1,127 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestGetCSIPersistentVolumeSource(t *testing.T) {
+	testCases := []struct {
+		name           string
+		pv             *v1.PersistentVolume
+		expectedSource *v1.CSIPersistentVolumeSource
+		expectError    bool
+	}{
+		{
+			name:           "CSI PV",
+			pv:             builder.ForPersistentVolume("pv").CSI("hostpath", "volume").Result(),
+			expectedSource: &v1.CSIPersistentVolumeSource{Driver: "hostpath", VolumeHandle: "volume"},
+		},
+		{
+			name: "in-tree PV not migrated",
+			pv:   builder.ForPersistentVolume("pv").AWSEBSVolumeID("vol-1").Result(),
+		},
+		{
+			name: "migrated AWS EBS PV",
+			pv: builder.ForPersistentVolume("pv").AWSEBSVolumeID("aws://us-east-1a/vol-1").
+				ObjectMeta(builder.WithAnnotations(AnnMigratedTo, AWSEBSCSIDriverName)).Result(),
+			expectedSource: &v1.CSIPersistentVolumeSource{Driver: AWSEBSCSIDriverName, VolumeHandle: "vol-1"},
+		},
+		{
+			name: "migrated zonal GCE PD PV",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv", Annotations: map[string]string{AnnMigratedTo: GCEPDCSIDriverName}, Labels: map[string]string{v1.LabelTopologyZone: "us-central1-a"}},
+				Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+					GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{PDName: "disk"},
+				}},
+			},
+			expectedSource: &v1.CSIPersistentVolumeSource{Driver: GCEPDCSIDriverName, VolumeHandle: "projects/UNSPECIFIED/zones/us-central1-a/disks/disk"},
+		},
+		{
+			name: "migrated regional GCE PD PV",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv", Annotations: map[string]string{AnnMigratedTo: GCEPDCSIDriverName}, Labels: map[string]string{v1.LabelFailureDomainBetaZone: "us-central1-a__us-central1-b"}},
+				Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+					GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{PDName: "disk"},
+				}},
+			},
+			expectedSource: &v1.CSIPersistentVolumeSource{Driver: GCEPDCSIDriverName, VolumeHandle: "projects/UNSPECIFIED/regions/us-central1/disks/disk"},
+		},
+		{
+			name: "migrated GCE PD PV without zone",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv", Annotations: map[string]string{AnnMigratedTo: GCEPDCSIDriverName}},
+				Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+					GCEPersistentDisk: &v1.GCEPersistentDiskVolumeSource{PDName: "disk"},
+				}},
+			},
+			expectError: true,
+		},
+		{
+			name: "migrated Azure Disk PV",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv", Annotations: map[string]string{AnnMigratedTo: AzureDiskCSIDriverName}},
+				Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+					AzureDisk: &v1.AzureDiskVolumeSource{DataDiskURI: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/disk"},
+				}},
+			},
+			expectedSource: &v1.CSIPersistentVolumeSource{Driver: AzureDiskCSIDriverName, VolumeHandle: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/disk"},
+		},
+		{
+			name: "migrated vSphere PV",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pv", Annotations: map[string]string{AnnMigratedTo: VSphereCSIDriverName}},
+				Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+					VsphereVolume: &v1.VsphereVirtualDiskVolumeSource{VolumePath: "[datastore] kubevols/disk.vmdk"},
+				}},
+			},
+			expectedSource: &v1.CSIPersistentVolumeSource{Driver: VSphereCSIDriverName, VolumeHandle: "[datastore] kubevols/disk.vmdk"},
+		},
+		{
+			name: "migrated to another driver than the in-tree source",
+			pv: builder.ForPersistentVolume("pv").AWSEBSVolumeID("vol-1").
+				ObjectMeta(builder.WithAnnotations(AnnMigratedTo, GCEPDCSIDriverName)).Result(),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source, err := GetCSIPersistentVolumeSource(tc.pv)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSource, source)
+		})
+	}
+}
+
+func TestGetProvisionerCSIDriver(t *testing.T) {
+	assert.Equal(t, AWSEBSCSIDriverName, GetProvisionerCSIDriver("kubernetes.io/aws-ebs"))
+	assert.Equal(t, AWSEBSCSIDriverName, GetProvisionerCSIDriver(AWSEBSCSIDriverName))
+	assert.Equal(t, "hostpath.csi.k8s.io", GetProvisionerCSIDriver("hostpath.csi.k8s.io"))
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package util
 
 const (
-	VolumeSnapshotLabel                             = "velero.io/volume-snapshot-name"
+	VolumeSnapshotLabel = "velero.io/volume-snapshot-name"
+	// VolumeSnapshotMetadataAnnotation records on a backed-up VolumeSnapshot the VolumeSnapshotMetadata of its snapshot.
+	// The handle, driver, restore size and deletion policy annotations below are only read from former backups.
+	VolumeSnapshotMetadataAnnotation                = "velero.io/csi-volumesnapshot-metadata"
 	VolumeSnapshotHandleAnnotation                  = "velero.io/csi-volumesnapshot-handle"
 	VolumeSnapshotRestoreSize                       = "velero.io/vsi-volumesnapshot-restore-size"
 	CSIDriverNameAnnotation                         = "velero.io/csi-driver-name"
@@ -27,6 +30,24 @@ const (
 	VolumeSnapshotClassSelectorLabel                = "velero.io/csi-volumesnapshot-class"
 	VolumeSnapshotClassDriverBackupAnnotationPrefix = "velero.io/csi-volumesnapshot-class"
 	VolumeSnapshotClassDriverPVCAnnotation          = "velero.io/csi-volumesnapshot-class"
+	// VolumeSnapshotClassPriorityAnnotation sets the priority of a VolumeSnapshotClass among the classes of its driver
+	// with the velero.io/csi-volumesnapshot-class label, the highest is chosen.
+	VolumeSnapshotClassPriorityAnnotation = "velero.io/csi-volumesnapshot-class-priority"
+	// VolumeSnapshotClassAmbiguityBackupAnnotation set to "fail" on a backup fails the snapshot when the
+	// VolumeSnapshotClass can't be chosen among several labeled classes, instead of choosing by name.
+	VolumeSnapshotClassAmbiguityBackupAnnotation = "velero.io/csi-volumesnapshot-class-ambiguity"
+	VolumeSnapshotClassAmbiguityFail             = "fail"
+	// VolumeSnapshotClassStorageClassAnnotation names on a StorageClass the VolumeSnapshotClass for its PVCs.
+	VolumeSnapshotClassStorageClassAnnotation = "velero.io/csi-volumesnapshot-class"
+	// VolumeSnapshotClassRestoreAnnotation records on a restored VolumeSnapshot whose VolumeSnapshotClass didn't exist in the cluster
+	// whether it was re-pointed to another class of its driver, the name of the backed-up class is kept in
+	// BackedUpVolumeSnapshotClassAnnotation, or whether the class was created. It is also put on the classes created.
+	VolumeSnapshotClassRestoreAnnotation  = "velero.io/csi-volumesnapshot-class-restore"
+	VolumeSnapshotClassRestoreRepointed   = "Repointed"
+	VolumeSnapshotClassRestoreCreated     = "Created"
+	BackedUpVolumeSnapshotClassAnnotation = "velero.io/csi-backed-up-volumesnapshot-class"
+	// VolumeSnapshotClassPolicyRuleAnnotation records on the PVC the VolumeSnapshotClass policy rule its class was chosen by.
+	VolumeSnapshotClassPolicyRuleAnnotation = "velero.io/csi-volumesnapshot-class-policy-rule"
 
 	// There is no release w/ these constants exported. Using the strings for now.
 	// CSI Labels volumesnapshotclass
@@ -43,6 +64,12 @@ const (
 	// SkippedNoCSIPVAnnotation - Velero checks this annotation on processed PVC to
 	// find out if the snapshot was skipped b/c the PV is not provisioned via CSI
 	SkippedNoCSIPVAnnotation = "backup.velero.io/skipped-no-csi-pv"
+	// SkippedUnboundPVCAnnotation is set on a PVC backed up without a snapshot because it was
+	// not bound to a volume yet, e.g. waiting for its first consumer.
+	SkippedUnboundPVCAnnotation = "backup.velero.io/skipped-unbound-pvc"
+	// SkippedUnboundVolumeSnapshotAnnotation is set on a VolumeSnapshot created outside of Velero which was backed up
+	// before being bound to a snapshot, it is not restored.
+	SkippedUnboundVolumeSnapshotAnnotation = "backup.velero.io/skipped-unbound-volumesnapshot"
 	// ResourceTimeoutAnnotation is the annotation key used to carry the global resoure
 	// timeout value for backup to plugins.
 	ResourceTimeoutAnnotation = "velero.io/resource-timeout"
@@ -52,4 +79,75 @@ const (
 
 	// DataUploadNameAnnotation is the label key for the DataUpload name
 	DataUploadNameAnnotation = "velero.io/data-upload-name"
+
+	// VolumeGroupLabel is the default PVC label whose value groups PVCs that are
+	// snapshotted together through a single VolumeGroupSnapshot.
+	VolumeGroupLabel = "velero.io/volume-group"
+	// VolumeGroupLabelKeyBackupAnnotation is the backup annotation naming the PVC
+	// label key to group PVCs by, overriding VolumeGroupLabel.
+	VolumeGroupLabelKeyBackupAnnotation = "velero.io/csi-volumegroupsnapshot-label-key"
+	// VolumeGroupSnapshotLabel is the label key put on the member VolumeSnapshots
+	// with the name of the VolumeGroupSnapshot that created them.
+	VolumeGroupSnapshotLabel                             = "velero.io/volume-group-snapshot-name"
+	VolumeGroupSnapshotClassSelectorLabel                = "velero.io/csi-volumegroupsnapshot-class"
+	VolumeGroupSnapshotClassDriverBackupAnnotationPrefix = "velero.io/csi-volumegroupsnapshot-class"
+	// ExcludeFromBackupLabel excludes the resource carrying it with the value "true" from backups.
+	ExcludeFromBackupLabel = "velero.io/exclude-from-backup"
+
+	// Pod annotations opting in to quiescing the application before the snapshot of its PVCs.
+	// The freeze and thaw commands are either a single command or a JSON array of command and arguments.
+	QuiesceFreezeCommandAnnotation = "velero.io/csi-freeze-command"
+	QuiesceThawCommandAnnotation   = "velero.io/csi-thaw-command"
+	// QuiesceFSFreezeAnnotation makes the plugin run fsfreeze on the mount path of the PVC
+	// when no freeze and thaw commands are set.
+	QuiesceFSFreezeAnnotation  = "velero.io/csi-fsfreeze"
+	QuiesceContainerAnnotation = "velero.io/csi-quiesce-container"
+	QuiesceTimeoutAnnotation   = "velero.io/csi-quiesce-timeout"
+	QuiesceOnErrorAnnotation   = "velero.io/csi-quiesce-on-error"
+
+	// SnapshotConsistencyAnnotation records on the PVC the consistency level of its snapshot.
+	SnapshotConsistencyAnnotation = "velero.io/csi-snapshot-consistency"
+	ConsistencyLevelApplication   = "application-consistent"
+	ConsistencyLevelFilesystem    = "filesystem-consistent"
+	ConsistencyLevelCrash         = "crash-consistent"
+
+	// VolumeSnapshotInFlightLabel is put on VolumeSnapshots taking a snapshot concurrency slot
+	// until they are ReadyToUse, its value is the CSI driver.
+	VolumeSnapshotInFlightLabel = "velero.io/csi-snapshot-in-flight"
+
+	// VolumeSnapshotNameTemplateBackupAnnotation sets on a backup the template of the names of the VolumeSnapshots it creates.
+	VolumeSnapshotNameTemplateBackupAnnotation = "velero.io/csi-volumesnapshot-name-template"
+
+	// UnboundPVCPolicyBackupAnnotation sets on a backup the policy for the PVCs not bound to a volume it backs up.
+	UnboundPVCPolicyBackupAnnotation = "velero.io/csi-unbound-pvc-policy"
+
+	// SnapshotVerificationAnnotation records on a VolumeSnapshot whether its snapshot could be provisioned
+	// into a volume, SnapshotVerificationMessageAnnotation tells why when it couldn't.
+	SnapshotVerificationAnnotation        = "velero.io/csi-snapshot-verification"
+	SnapshotVerificationMessageAnnotation = "velero.io/csi-snapshot-verification-message"
+	SnapshotVerificationPassed            = "Passed"
+	SnapshotVerificationFailed            = "Failed"
+	// SnapshotVerificationLabel is put on the temporary objects verifying a snapshot, its value is the UID of the VolumeSnapshot.
+	SnapshotVerificationLabel = "velero.io/csi-snapshot-verification-of"
+
+	// ExistingPVCPolicyRestoreAnnotation sets on a restore what is done with a PVC which already exists in the cluster:
+	// it is skipped, replaced, or restored alongside under a name with ExistingPVCSuffixRestoreAnnotation as suffix.
+	ExistingPVCPolicyRestoreAnnotation = "velero.io/csi-existing-pvc-policy"
+	ExistingPVCPolicySkip              = "skip"
+	ExistingPVCPolicyReplace           = "replace"
+	ExistingPVCPolicyRename            = "rename"
+	ExistingPVCSuffixRestoreAnnotation = "velero.io/csi-existing-pvc-suffix"
+	// PVCRenameMappingRestoreAnnotation sets on a restore the names PVCs are restored with, see PVCRenameMapping.
+	PVCRenameMappingRestoreAnnotation = "velero.io/csi-pvc-rename-mapping"
+	// PVCSizeMappingRestoreAnnotation and StorageClassSizeMappingRestoreAnnotation set on a restore the storage size of
+	// the PVCs it restores, per PVC or per StorageClass, see GetRestoreTargetSize.
+	PVCSizeMappingRestoreAnnotation          = "velero.io/csi-pvc-size-mapping"
+	StorageClassSizeMappingRestoreAnnotation = "velero.io/csi-storage-class-size-mapping"
+	// RestoredFromPVCAnnotation records on a PVC restored under another name the name of the backed-up PVC.
+	RestoredFromPVCAnnotation = "velero.io/csi-restored-from-pvc"
+	// ScaledDownByRestoreLabel is put on the workloads scaled down to replace the PVCs they use, its value is the UID of the restore.
+	// ScaledDownReplicasAnnotation records their replicas and ScaledDownForPVCsAnnotation the PVCs they wait for.
+	ScaledDownByRestoreLabel     = "velero.io/csi-scaled-down-by-restore"
+	ScaledDownReplicasAnnotation = "velero.io/csi-scaled-down-replicas"
+	ScaledDownForPVCsAnnotation  = "velero.io/csi-scaled-down-for-pvcs"
 )
@@ -0,0 +1,53 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+)
+
+const (
+	// PVCBackupItemActionName is the name the PVC backup item action is registered with,
+	// its plugin config ConfigMap is labeled with it.
+	PVCBackupItemActionName = "velero.io/csi-pvc-backupper"
+	// PVCRestoreItemActionName is the name the PVC restore item action is registered with.
+	PVCRestoreItemActionName = "velero.io/csi-pvc-restorer"
+)
+
+// GetPVCBackupPluginConfig returns the ConfigMap configuring the PVC backup item action in the Velero namespace,
+// labeled with velero.io/plugin-config and velero.io/csi-pvc-backupper: BackupItemAction. nil is returned if there is none.
+func GetPVCBackupPluginConfig(namespace string, client corev1client.ConfigMapsGetter) (*corev1api.ConfigMap, error) {
+	config, err := common.GetPluginConfig(common.PluginKindBackupItemAction, PVCBackupItemActionName, client.ConfigMaps(namespace))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting config of plugin %s", PVCBackupItemActionName)
+	}
+	return config, nil
+}
+
+// GetPVCRestorePluginConfig returns the ConfigMap configuring the PVC restore item action in the Velero namespace,
+// labeled with velero.io/plugin-config and velero.io/csi-pvc-restorer: RestoreItemAction. nil is returned if there is none.
+func GetPVCRestorePluginConfig(namespace string, client corev1client.ConfigMapsGetter) (*corev1api.ConfigMap, error) {
+	config, err := common.GetPluginConfig(common.PluginKindRestoreItemAction, PVCRestoreItemActionName, client.ConfigMaps(namespace))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting config of plugin %s", PVCRestoreItemActionName)
+	}
+	return config, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+// PVCRenameMapping maps backed-up PVCs to the names they are restored with. A PVC is either
+// "<namespace>/<name>", with the namespace it was backed up in, or "<name>" in any namespace.
+type PVCRenameMapping map[string]string
+
+// GetPVCRenameMapping parses the PVC rename mapping of the restore annotation, a YAML or JSON object.
+// nil is returned if the restore renames no PVC.
+func GetPVCRenameMapping(restore *velerov1api.Restore) (PVCRenameMapping, error) {
+	data, ok := restore.Annotations[PVCRenameMappingRestoreAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	mapping := PVCRenameMapping{}
+	if err := yaml.UnmarshalStrict([]byte(data), &mapping); err != nil {
+		return nil, errors.Wrapf(err, "error parsing annotation %s of restore %s", PVCRenameMappingRestoreAnnotation, restore.Name)
+	}
+	for pvc, newName := range mapping {
+		if errs := validation.IsDNS1123Subdomain(newName); len(errs) > 0 {
+			return nil, errors.Errorf("annotation %s of restore %s renames PVC %s to invalid name %q: %s",
+				PVCRenameMappingRestoreAnnotation, restore.Name, pvc, newName, strings.Join(errs, ", "))
+		}
+	}
+	return mapping, nil
+}
+
+// NewName returns the name the PVC backed up in the namespace is restored with, ok is false if it is not renamed.
+func (m PVCRenameMapping) NewName(namespace, name string) (newName string, ok bool) {
+	if newName, ok = m[namespace+"/"+name]; ok {
+		return newName, true
+	}
+	newName, ok = m[name]
+	return newName, ok
+}
+
+// RenamedVolumeSnapshotName returns the name the VolumeSnapshot of a PVC restored under another name is restored with,
+// so it doesn't collide with the VolumeSnapshot of the PVC it is restored alongside.
+func RenamedVolumeSnapshotName(volumeSnapshotName, newPVCName string) string {
+	prefix := volumeSnapshotName
+	if maxLength := validation.DNS1123LabelMaxLength - volumeSnapshotNameHashLength - 1; len(prefix) > maxLength {
+		prefix = strings.TrimRight(prefix[:maxLength], "-.")
+	}
+	return prefix + "-" + shortHash(newPVCName)
+}
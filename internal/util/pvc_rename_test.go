@@ -0,0 +1,70 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestGetPVCRenameMapping(t *testing.T) {
+	mapping, err := GetPVCRenameMapping(builder.ForRestore("velero", "restore").Result())
+	require.NoError(t, err)
+	assert.Nil(t, mapping)
+
+	mapping, err = GetPVCRenameMapping(builder.ForRestore("velero", "restore").
+		ObjectMeta(builder.WithAnnotations(PVCRenameMappingRestoreAnnotation, `{"db/data": "data-restored", "logs": "logs-restored"}`)).Result())
+	require.NoError(t, err)
+
+	newName, ok := mapping.NewName("db", "data")
+	assert.True(t, ok)
+	assert.Equal(t, "data-restored", newName)
+	_, ok = mapping.NewName("other", "data")
+	assert.False(t, ok)
+	newName, ok = mapping.NewName("other", "logs")
+	assert.True(t, ok)
+	assert.Equal(t, "logs-restored", newName)
+
+	// YAML is accepted as well
+	mapping, err = GetPVCRenameMapping(builder.ForRestore("velero", "restore").
+		ObjectMeta(builder.WithAnnotations(PVCRenameMappingRestoreAnnotation, "db/data: data-restored")).Result())
+	require.NoError(t, err)
+	assert.Equal(t, PVCRenameMapping{"db/data": "data-restored"}, mapping)
+
+	_, err = GetPVCRenameMapping(builder.ForRestore("velero", "restore").
+		ObjectMeta(builder.WithAnnotations(PVCRenameMappingRestoreAnnotation, "[data]")).Result())
+	assert.Error(t, err)
+
+	_, err = GetPVCRenameMapping(builder.ForRestore("velero", "restore").
+		ObjectMeta(builder.WithAnnotations(PVCRenameMappingRestoreAnnotation, `{"data": "Data_Restored"}`)).Result())
+	assert.Error(t, err)
+}
+
+func TestRenamedVolumeSnapshotName(t *testing.T) {
+	assert.Equal(t, "velero-data-abcde-"+shortHash("data-restored"), RenamedVolumeSnapshotName("velero-data-abcde", "data-restored"))
+	assert.NotEqual(t, RenamedVolumeSnapshotName("velero-data-abcde", "data-restored"), RenamedVolumeSnapshotName("velero-data-abcde", "data-copy"))
+
+	long := strings.Repeat("a", 63)
+	name := RenamedVolumeSnapshotName(long, "data-restored")
+	assert.Len(t, name, 63)
+	assert.Equal(t, strings.Repeat("a", 54)+"-"+shortHash("data-restored"), name)
+}
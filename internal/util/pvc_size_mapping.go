@@ -0,0 +1,75 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+// GetRestoreTargetSize returns the storage size the restore asks for the PVC backed up in the namespace, restored with the storage class,
+// and the annotation it is set by. The PVC is either "<namespace>/<name>" or "<name>" in the PVCSizeMappingRestoreAnnotation, which takes
+// precedence over the StorageClassSizeMappingRestoreAnnotation. nil is returned if the restore sets no size for the PVC.
+func GetRestoreTargetSize(restore *velerov1api.Restore, namespace, name, storageClass string) (*resource.Quantity, string, error) {
+	pvcSizes, err := parseSizeMapping(restore, PVCSizeMappingRestoreAnnotation)
+	if err != nil {
+		return nil, "", err
+	}
+	if size, ok := pvcSizes[namespace+"/"+name]; ok {
+		return &size, PVCSizeMappingRestoreAnnotation, nil
+	}
+	if size, ok := pvcSizes[name]; ok {
+		return &size, PVCSizeMappingRestoreAnnotation, nil
+	}
+
+	storageClassSizes, err := parseSizeMapping(restore, StorageClassSizeMappingRestoreAnnotation)
+	if err != nil {
+		return nil, "", err
+	}
+	if size, ok := storageClassSizes[storageClass]; ok && storageClass != "" {
+		return &size, StorageClassSizeMappingRestoreAnnotation, nil
+	}
+	return nil, "", nil
+}
+
+// parseSizeMapping parses the storage sizes of the restore annotation, a YAML or JSON object of quantities.
+func parseSizeMapping(restore *velerov1api.Restore, annotation string) (map[string]resource.Quantity, error) {
+	data, ok := restore.Annotations[annotation]
+	if !ok {
+		return nil, nil
+	}
+
+	mapping := map[string]string{}
+	if err := yaml.UnmarshalStrict([]byte(data), &mapping); err != nil {
+		return nil, errors.Wrapf(err, "error parsing annotation %s of restore %s", annotation, restore.Name)
+	}
+	sizes := make(map[string]resource.Quantity, len(mapping))
+	for key, value := range mapping {
+		size, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing size %q of %s in annotation %s of restore %s", value, key, annotation, restore.Name)
+		}
+		if size.Sign() <= 0 {
+			return nil, errors.Errorf("annotation %s of restore %s sets size %s of %s, which is not positive", annotation, restore.Name, value, key)
+		}
+		sizes[key] = size
+	}
+	return sizes, nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestGetRestoreTargetSize(t *testing.T) {
+	tests := []struct {
+		name               string
+		annotations        []string
+		storageClass       string
+		expectedSize       string
+		expectedAnnotation string
+		expectedErr        bool
+	}{
+		{
+			name: "no size",
+		},
+		{
+			name:               "size of the PVC in its namespace",
+			annotations:        []string{PVCSizeMappingRestoreAnnotation, `{"db/data": "20Gi", "data": "15Gi"}`},
+			expectedSize:       "20Gi",
+			expectedAnnotation: PVCSizeMappingRestoreAnnotation,
+		},
+		{
+			name:               "size of the PVC in any namespace",
+			annotations:        []string{PVCSizeMappingRestoreAnnotation, "data: 15Gi"},
+			expectedSize:       "15Gi",
+			expectedAnnotation: PVCSizeMappingRestoreAnnotation,
+		},
+		{
+			name: "size of the PVC takes precedence over the size of its storage class",
+			annotations: []string{PVCSizeMappingRestoreAnnotation, "data: 15Gi",
+				StorageClassSizeMappingRestoreAnnotation, "gp3: 30Gi"},
+			storageClass:       "gp3",
+			expectedSize:       "15Gi",
+			expectedAnnotation: PVCSizeMappingRestoreAnnotation,
+		},
+		{
+			name: "size of the storage class",
+			annotations: []string{PVCSizeMappingRestoreAnnotation, "other: 15Gi",
+				StorageClassSizeMappingRestoreAnnotation, "gp3: 30Gi"},
+			storageClass:       "gp3",
+			expectedSize:       "30Gi",
+			expectedAnnotation: StorageClassSizeMappingRestoreAnnotation,
+		},
+		{
+			name:        "invalid size",
+			annotations: []string{PVCSizeMappingRestoreAnnotation, "data: big"},
+			expectedErr: true,
+		},
+		{
+			name:         "size which is not positive",
+			annotations:  []string{StorageClassSizeMappingRestoreAnnotation, "gp3: 0"},
+			storageClass: "gp3",
+			expectedErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			restore := builder.ForRestore("velero", "restore").ObjectMeta(builder.WithAnnotations(tc.annotations...)).Result()
+			size, annotation, err := GetRestoreTargetSize(restore, "db", "data", tc.storageClass)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expectedSize == "" {
+				assert.Nil(t, size)
+				return
+			}
+			require.NotNil(t, size)
+			assert.Equal(t, tc.expectedSize, size.String())
+			assert.Equal(t, tc.expectedAnnotation, annotation)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotter "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/typed/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// CancelVolumeSnapshot deletes the volumesnapshot along with its volumesnapshotcontent and the snapshot in the storage provider,
+// and waits until the volumesnapshotcontent is gone. An error naming the snapshot handle is returned if the snapshot may be
+// left behind in the storage provider. If the UID is set, a volumesnapshot with another UID, re-created with the same name, is left alone.
+func CancelVolumeSnapshot(namespace, name string, uid types.UID, snapshotClient snapshotter.SnapshotV1Interface, log logrus.FieldLogger, timeout time.Duration) error {
+	vs, err := snapshotClient.VolumeSnapshots(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		log.Infof("Volumesnapshot %s/%s is already deleted, nothing to cancel", namespace, name)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error getting volumesnapshot %s/%s", namespace, name)
+	}
+	if uid != "" && vs.UID != uid {
+		log.Infof("Volumesnapshot %s/%s with UID %s is already deleted, nothing to cancel", namespace, name, uid)
+		return nil
+	}
+
+	vsc, err := findVolumeSnapshotContent(vs, snapshotClient)
+	if err != nil {
+		return err
+	}
+	if vsc != nil && vsc.Spec.DeletionPolicy != snapshotv1api.VolumeSnapshotContentDelete {
+		// the snapshot in the storage provider is deleted along with the volumesnapshotcontent
+		if err := SetVolumeSnapshotContentDeletionPolicy(vsc.Name, snapshotClient); err != nil {
+			return errors.Wrapf(err, "error setting DeletionPolicy of volumesnapshotcontent %s to Delete", vsc.Name)
+		}
+	}
+
+	log.Infof("Deleting volumesnapshot %s/%s to cancel its snapshot", namespace, name)
+	if err := snapshotClient.VolumeSnapshots(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "error deleting volumesnapshot %s/%s", namespace, name)
+	}
+	if vsc == nil {
+		return nil
+	}
+
+	err = wait.PollUntilContextTimeout(context.Background(), time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := snapshotClient.VolumeSnapshotContents().Get(ctx, vsc.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "error getting volumesnapshotcontent %s", vsc.Name)
+		}
+		return false, nil
+	})
+	if err != nil {
+		handle := "with no handle yet"
+		if vsc.Status != nil && vsc.Status.SnapshotHandle != nil {
+			handle = *vsc.Status.SnapshotHandle
+		}
+		log.Warnf("Snapshot %s of driver %s may be left in the storage provider: volumesnapshotcontent %s was not deleted: %v", handle, vsc.Spec.Driver, vsc.Name, err)
+		return errors.Wrapf(err, "volumesnapshotcontent %s of volumesnapshot %s/%s was not deleted, snapshot %s of driver %s may be left in the storage provider",
+			vsc.Name, namespace, name, handle, vsc.Spec.Driver)
+	}
+	log.Infof("Deleted volumesnapshotcontent %s of volumesnapshot %s/%s", vsc.Name, namespace, name)
+	return nil
+}
+
+// findVolumeSnapshotContent returns the volumesnapshotcontent bound to the volumesnapshot, or referencing it when the volumesnapshot
+// doesn't know about it yet. nil is returned if there is none.
+func findVolumeSnapshotContent(vs *snapshotv1api.VolumeSnapshot, snapshotClient snapshotter.SnapshotV1Interface) (*snapshotv1api.VolumeSnapshotContent, error) {
+	if vs.Status != nil && vs.Status.BoundVolumeSnapshotContentName != nil {
+		vsc, err := snapshotClient.VolumeSnapshotContents().Get(context.TODO(), *vs.Status.BoundVolumeSnapshotContentName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting volumesnapshotcontent %s", *vs.Status.BoundVolumeSnapshotContentName)
+		}
+		return vsc, nil
+	}
+
+	vscList, err := snapshotClient.VolumeSnapshotContents().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing volumesnapshotcontents")
+	}
+	for i := range vscList.Items {
+		ref := vscList.Items[i].Spec.VolumeSnapshotRef
+		if ref.Namespace == vs.Namespace && ref.Name == vs.Name && ref.UID == vs.UID {
+			return &vscList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotFake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestCancelVolumeSnapshot(t *testing.T) {
+	handle := "handle"
+	newVSC := func(vsUID string) *snapshotv1api.VolumeSnapshotContent {
+		vsc := builder.ForVolumeSnapshotContent("vsc").DeletionPolicy(snapshotv1api.VolumeSnapshotContentRetain).
+			Status(&snapshotv1api.VolumeSnapshotContentStatus{SnapshotHandle: &handle}).Result()
+		vsc.Spec.Driver = "hostpath.csi.k8s.io"
+		vsc.Spec.VolumeSnapshotRef = corev1api.ObjectReference{Namespace: "ns", Name: "vs", UID: types.UID(vsUID)}
+		return vsc
+	}
+
+	testCases := []struct {
+		name              string
+		objs              []runtime.Object
+		controllerDeletes bool
+		expectedErr       string
+	}{
+		{
+			name: "volumesnapshot is already deleted",
+		},
+		{
+			name: "volumesnapshot and its content are deleted",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				newVSC(""),
+			},
+			controllerDeletes: true,
+		},
+		{
+			name: "content of a volumesnapshot not bound yet is found by its reference",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithUID("vs-uid")).Result(),
+				newVSC("vs-uid"),
+			},
+			controllerDeletes: true,
+		},
+		{
+			name: "content is left behind",
+			objs: []runtime.Object{
+				builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName("vsc").Result(),
+				newVSC(""),
+			},
+			expectedErr: "volumesnapshotcontent vsc of volumesnapshot ns/vs was not deleted, snapshot handle of driver hostpath.csi.k8s.io may be left in the storage provider",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClient := snapshotFake.NewSimpleClientset(tc.objs...)
+			if tc.controllerDeletes {
+				// the snapshot controller deletes the content of a deleted volumesnapshot with the Delete policy
+				fakeClient.PrependReactor("delete", "volumesnapshots", func(action clienttesting.Action) (bool, runtime.Object, error) {
+					vsc, err := fakeClient.Tracker().Get(snapshotv1api.SchemeGroupVersion.WithResource("volumesnapshotcontents"), "", "vsc")
+					require.NoError(t, err)
+					if vsc.(*snapshotv1api.VolumeSnapshotContent).Spec.DeletionPolicy == snapshotv1api.VolumeSnapshotContentDelete {
+						require.NoError(t, fakeClient.Tracker().Delete(snapshotv1api.SchemeGroupVersion.WithResource("volumesnapshotcontents"), "", "vsc"))
+					}
+					return false, nil, nil
+				})
+			}
+
+			err := CancelVolumeSnapshot("ns", "vs", "", fakeClient.SnapshotV1(), logrus.New(), 100*time.Millisecond)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				vsc, err := fakeClient.SnapshotV1().VolumeSnapshotContents().Get(context.TODO(), "vsc", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, snapshotv1api.VolumeSnapshotContentDelete, vsc.Spec.DeletionPolicy)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = fakeClient.SnapshotV1().VolumeSnapshots("ns").Get(context.TODO(), "vs", metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+			_, err = fakeClient.SnapshotV1().VolumeSnapshotContents().Get(context.TODO(), "vsc", metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+		})
+	}
+}
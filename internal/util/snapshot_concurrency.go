@@ -0,0 +1,176 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotter "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/typed/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+	"github.com/vmware-tanzu/velero/pkg/util/boolptr"
+)
+
+const (
+	// SnapshotConcurrencyConfigKey is the key of the snapshot concurrency limits in the plugin config ConfigMap.
+	SnapshotConcurrencyConfigKey = "snapshotConcurrency"
+)
+
+// SnapshotConcurrencyConfig caps the number of VolumeSnapshots created by backups which are not ReadyToUse yet.
+// A limit of 0 means no limit.
+type SnapshotConcurrencyConfig struct {
+	MaxInFlight          int            `json:"maxInFlight,omitempty"`
+	MaxInFlightPerDriver map[string]int `json:"maxInFlightPerDriver,omitempty"`
+}
+
+// ParseSnapshotConcurrencyConfig parses the snapshot concurrency limits of the plugin config ConfigMap.
+// nil is returned if the ConfigMap sets no limit.
+func ParseSnapshotConcurrencyConfig(config *corev1api.ConfigMap) (*SnapshotConcurrencyConfig, error) {
+	if config == nil {
+		return nil, nil
+	}
+	data, ok := config.Data[SnapshotConcurrencyConfigKey]
+	if !ok {
+		return nil, nil
+	}
+
+	concurrency := &SnapshotConcurrencyConfig{}
+	if err := yaml.UnmarshalStrict([]byte(data), concurrency); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s of ConfigMap %s/%s", SnapshotConcurrencyConfigKey, config.Namespace, config.Name)
+	}
+	return concurrency, nil
+}
+
+// driverLimit returns the limit of in-flight snapshots of the driver, 0 if there is none.
+func (c *SnapshotConcurrencyConfig) driverLimit(driver string) int {
+	return c.MaxInFlightPerDriver[driver]
+}
+
+// WaitForSnapshotSlot waits until the number of slots can be taken without going over the limits of in-flight VolumeSnapshots,
+// globally and for the driver. The VolumeSnapshots then created must be labeled with SnapshotInFlightLabels so they take the slots.
+func WaitForSnapshotSlot(driver string, slots int, concurrency *SnapshotConcurrencyConfig, snapshotClient snapshotter.SnapshotV1Interface,
+	crClient crclient.Client, log logrus.FieldLogger, timeout time.Duration) error {
+	if concurrency == nil || (concurrency.MaxInFlight <= 0 && concurrency.driverLimit(driver) <= 0) {
+		return nil
+	}
+	if concurrency.MaxInFlight > 0 && slots > concurrency.MaxInFlight {
+		return errors.Errorf("%d snapshot slots can't be taken together, the limit is %d", slots, concurrency.MaxInFlight)
+	}
+	if limit := concurrency.driverLimit(driver); limit > 0 && slots > limit {
+		return errors.Errorf("%d snapshot slots can't be taken together, the limit of driver %s is %d", slots, driver, limit)
+	}
+	if timeout <= 0 {
+		timeout = defaultCSISnapshotTimeout
+	}
+	interval := 5 * time.Second
+
+	err := wait.PollUntilContextTimeout(context.Background(), interval, timeout, true, func(ctx context.Context) (bool, error) {
+		vsList, err := snapshotClient.VolumeSnapshots(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: VolumeSnapshotInFlightLabel})
+		if err != nil {
+			return false, errors.Wrap(err, "error listing in-flight volumesnapshots")
+		}
+		activeBackups, err := getActiveBackupUIDs(ctx, crClient)
+		if err != nil {
+			return false, err
+		}
+
+		total, forDriver := 0, 0
+		for i := range vsList.Items {
+			vs := &vsList.Items[i]
+			// a volumesnapshot whose slot was not released, e.g. because its backup failed, is done once ready,
+			// failed or deleted, or once its backup is no longer running
+			if vs.Status != nil && (boolptr.IsSetToTrue(vs.Status.ReadyToUse) || vs.Status.Error != nil) {
+				continue
+			}
+			if vs.DeletionTimestamp != nil {
+				continue
+			}
+			if backupUID, ok := vs.Labels[velerov1api.BackupUIDLabel]; ok && !activeBackups[backupUID] {
+				continue
+			}
+			total++
+			if vs.Labels[VolumeSnapshotInFlightLabel] == label.GetValidName(driver) {
+				forDriver++
+			}
+		}
+
+		if concurrency.MaxInFlight > 0 && total+slots > concurrency.MaxInFlight {
+			log.Infof("Waiting for a snapshot slot, %d volumesnapshots are in flight, the limit is %d. Retrying in %ds", total, concurrency.MaxInFlight, interval/time.Second)
+			return false, nil
+		}
+		if limit := concurrency.driverLimit(driver); limit > 0 && forDriver+slots > limit {
+			log.Infof("Waiting for a snapshot slot, %d volumesnapshots of driver %s are in flight, the limit is %d. Retrying in %ds", forDriver, driver, limit, interval/time.Second)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) {
+			return errors.Errorf("timed out after %v waiting for a snapshot slot for driver %s", timeout, driver)
+		}
+		return err
+	}
+	return nil
+}
+
+// getActiveBackupUIDs returns the UIDs of the backups which may still be taking snapshots.
+func getActiveBackupUIDs(ctx context.Context, crClient crclient.Client) (map[string]bool, error) {
+	backupList := new(velerov1api.BackupList)
+	if err := crClient.List(ctx, backupList); err != nil {
+		return nil, errors.Wrap(err, "error listing backups")
+	}
+
+	active := map[string]bool{}
+	for _, backup := range backupList.Items {
+		switch backup.Status.Phase {
+		case "", velerov1api.BackupPhaseNew, velerov1api.BackupPhaseInProgress,
+			velerov1api.BackupPhaseWaitingForPluginOperations, velerov1api.BackupPhaseWaitingForPluginOperationsPartiallyFailed:
+			active[string(backup.UID)] = true
+		}
+	}
+	return active, nil
+}
+
+// SnapshotInFlightLabels returns the labels making a VolumeSnapshot of the driver take an in-flight snapshot slot.
+func SnapshotInFlightLabels(driver string) map[string]string {
+	return map[string]string{VolumeSnapshotInFlightLabel: label.GetValidName(driver)}
+}
+
+// ReleaseSnapshotSlot removes the in-flight label of the VolumeSnapshot, freeing its slot.
+func ReleaseSnapshotSlot(vs *snapshotv1api.VolumeSnapshot, snapshotClient snapshotter.SnapshotV1Interface, log logrus.FieldLogger) {
+	if _, ok := vs.Labels[VolumeSnapshotInFlightLabel]; !ok {
+		return
+	}
+	pb := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":null}}}`, VolumeSnapshotInFlightLabel))
+	if _, err := snapshotClient.VolumeSnapshots(vs.Namespace).Patch(context.TODO(), vs.Name, types.MergePatchType, pb, metav1.PatchOptions{}); err != nil {
+		log.Warnf("Failed to release the snapshot slot of volumesnapshot %s/%s: %v", vs.Namespace, vs.Name, err)
+		return
+	}
+	log.Debugf("Released the snapshot slot of volumesnapshot %s/%s", vs.Namespace, vs.Name)
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotFake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+	velerotest "github.com/vmware-tanzu/velero/pkg/test"
+)
+
+func TestParseSnapshotConcurrencyConfig(t *testing.T) {
+	concurrency, err := ParseSnapshotConcurrencyConfig(nil)
+	require.NoError(t, err)
+	assert.Nil(t, concurrency)
+
+	concurrency, err = ParseSnapshotConcurrencyConfig(builder.ForConfigMap("velero", "config").Result())
+	require.NoError(t, err)
+	assert.Nil(t, concurrency)
+
+	concurrency, err = ParseSnapshotConcurrencyConfig(builder.ForConfigMap("velero", "config").
+		Data(SnapshotConcurrencyConfigKey, "maxInFlight: 10\nmaxInFlightPerDriver:\n  ebs.csi.aws.com: 2").Result())
+	require.NoError(t, err)
+	assert.Equal(t, 10, concurrency.MaxInFlight)
+	assert.Equal(t, 2, concurrency.driverLimit("ebs.csi.aws.com"))
+	assert.Equal(t, 0, concurrency.driverLimit("foo.csi.k8s.io"))
+
+	_, err = ParseSnapshotConcurrencyConfig(builder.ForConfigMap("velero", "config").Data(SnapshotConcurrencyConfigKey, "maxInFlights: 10").Result())
+	assert.Error(t, err)
+}
+
+func inFlightVolumeSnapshot(name, driver string, readyToUse bool) *snapshotv1api.VolumeSnapshot {
+	return &snapshotv1api.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns",
+			Name:      name,
+			Labels:    SnapshotInFlightLabels(driver),
+		},
+		Status: &snapshotv1api.VolumeSnapshotStatus{
+			ReadyToUse: &readyToUse,
+		},
+	}
+}
+
+func backupVolumeSnapshot(vs *snapshotv1api.VolumeSnapshot, backupUID string) *snapshotv1api.VolumeSnapshot {
+	vs.Labels[velerov1api.BackupUIDLabel] = backupUID
+	return vs
+}
+
+func TestWaitForSnapshotSlot(t *testing.T) {
+	testCases := []struct {
+		name        string
+		concurrency *SnapshotConcurrencyConfig
+		driver      string
+		slots       int
+		objs        []runtime.Object
+		backups     []runtime.Object
+		expectErr   bool
+	}{
+		{
+			name:   "no limit",
+			driver: "foo.csi.k8s.io",
+			objs:   []runtime.Object{inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false)},
+		},
+		{
+			name:        "below the global limit",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 2},
+			driver:      "foo.csi.k8s.io",
+			objs:        []runtime.Object{inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false)},
+		},
+		{
+			name:        "global limit reached",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 2},
+			driver:      "foo.csi.k8s.io",
+			objs: []runtime.Object{
+				inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false),
+				inFlightVolumeSnapshot("vs-2", "bar.csi.k8s.io", false),
+			},
+			expectErr: true,
+		},
+		{
+			name:        "driver limit reached",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlightPerDriver: map[string]int{"foo.csi.k8s.io": 1}},
+			driver:      "foo.csi.k8s.io",
+			objs:        []runtime.Object{inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false)},
+			expectErr:   true,
+		},
+		{
+			name:        "snapshots of other drivers don't count against the driver limit",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlightPerDriver: map[string]int{"foo.csi.k8s.io": 1}},
+			driver:      "foo.csi.k8s.io",
+			objs:        []runtime.Object{inFlightVolumeSnapshot("vs-1", "bar.csi.k8s.io", false)},
+		},
+		{
+			name:        "ready snapshots whose slot was not released don't count",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 1},
+			driver:      "foo.csi.k8s.io",
+			objs:        []runtime.Object{inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", true)},
+		},
+		{
+			name:        "failed snapshots whose slot was not released don't count",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 1},
+			driver:      "foo.csi.k8s.io",
+			objs: []runtime.Object{func() *snapshotv1api.VolumeSnapshot {
+				vs := inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false)
+				vs.Status.Error = &snapshotv1api.VolumeSnapshotError{}
+				return vs
+			}()},
+		},
+		{
+			name:        "deleted snapshots whose slot was not released don't count",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 1},
+			driver:      "foo.csi.k8s.io",
+			objs: []runtime.Object{func() *snapshotv1api.VolumeSnapshot {
+				vs := inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false)
+				vs.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+				vs.Finalizers = []string{"snapshot.storage.kubernetes.io/volumesnapshot-as-source-protection"}
+				return vs
+			}()},
+		},
+		{
+			name:        "snapshots of backups no longer running don't count",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 2},
+			driver:      "foo.csi.k8s.io",
+			objs: []runtime.Object{
+				backupVolumeSnapshot(inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false), "failed-uid"),
+				backupVolumeSnapshot(inFlightVolumeSnapshot("vs-2", "foo.csi.k8s.io", false), "deleted-uid"),
+			},
+			backups: []runtime.Object{
+				builder.ForBackup("velero", "failed").ObjectMeta(builder.WithUID("failed-uid")).Phase(velerov1api.BackupPhaseFailed).Result(),
+			},
+		},
+		{
+			name:        "snapshots of running backups count",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 1},
+			driver:      "foo.csi.k8s.io",
+			objs: []runtime.Object{
+				backupVolumeSnapshot(inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false), "running-uid"),
+			},
+			backups: []runtime.Object{
+				builder.ForBackup("velero", "running").ObjectMeta(builder.WithUID("running-uid")).Phase(velerov1api.BackupPhaseWaitingForPluginOperations).Result(),
+			},
+			expectErr: true,
+		},
+		{
+			name:        "several slots below the limits",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 3, MaxInFlightPerDriver: map[string]int{"foo.csi.k8s.io": 3}},
+			driver:      "foo.csi.k8s.io",
+			slots:       2,
+			objs:        []runtime.Object{inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false)},
+		},
+		{
+			name:        "several slots over the global limit",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlight: 3},
+			driver:      "foo.csi.k8s.io",
+			slots:       3,
+			objs:        []runtime.Object{inFlightVolumeSnapshot("vs-1", "bar.csi.k8s.io", false)},
+			expectErr:   true,
+		},
+		{
+			name:        "more slots than the driver limit",
+			concurrency: &SnapshotConcurrencyConfig{MaxInFlightPerDriver: map[string]int{"foo.csi.k8s.io": 2}},
+			driver:      "foo.csi.k8s.io",
+			slots:       3,
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClient := snapshotFake.NewSimpleClientset(tc.objs...)
+			slots := tc.slots
+			if slots == 0 {
+				slots = 1
+			}
+			err := WaitForSnapshotSlot(tc.driver, slots, tc.concurrency, fakeClient.SnapshotV1(),
+				velerotest.NewFakeControllerRuntimeClient(t, tc.backups...), logrus.New(), time.Millisecond)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReleaseSnapshotSlot(t *testing.T) {
+	vs := inFlightVolumeSnapshot("vs-1", "foo.csi.k8s.io", false)
+	fakeClient := snapshotFake.NewSimpleClientset(vs)
+
+	ReleaseSnapshotSlot(vs, fakeClient.SnapshotV1(), logrus.New())
+
+	updated, err := fakeClient.SnapshotV1().VolumeSnapshots("ns").Get(context.TODO(), "vs-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, updated.Labels, VolumeSnapshotInFlightLabel)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"regexp"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SnapshotErrorPatternsConfigKey is the key of the snapshot error patterns in the plugin config ConfigMap.
+	SnapshotErrorPatternsConfigKey = "snapshotErrorPatterns"
+)
+
+// SnapshotErrorCategory tells whether a snapshot error reported by the snapshot controller may go away.
+type SnapshotErrorCategory string
+
+const (
+	// SnapshotErrorRetryable errors are expected to go away when the snapshot controller retries.
+	SnapshotErrorRetryable SnapshotErrorCategory = "Retryable"
+	// SnapshotErrorQuota errors go away once the storage provider has room for the snapshot, they are retried too.
+	SnapshotErrorQuota SnapshotErrorCategory = "Quota"
+	// SnapshotErrorFatal errors won't go away, the snapshot is failed.
+	SnapshotErrorFatal SnapshotErrorCategory = "Fatal"
+)
+
+// SnapshotErrorPatterns are regular expressions matched against snapshot error messages, per category.
+type SnapshotErrorPatterns struct {
+	Retryable []string `json:"retryable,omitempty"`
+	Quota     []string `json:"quota,omitempty"`
+	Fatal     []string `json:"fatal,omitempty"`
+}
+
+// SnapshotErrorPatternsConfig is the configuration of the snapshot error patterns in the plugin config ConfigMap.
+// The patterns of the driver of a snapshot are tried first, then the patterns for all the drivers, then the built-in ones.
+type SnapshotErrorPatternsConfig struct {
+	SnapshotErrorPatterns `json:",inline"`
+	Drivers               map[string]SnapshotErrorPatterns `json:"drivers,omitempty"`
+}
+
+// builtinSnapshotErrorPatterns are the patterns of the errors commonly reported by CSI drivers and the snapshot controller.
+var builtinSnapshotErrorPatterns = SnapshotErrorPatterns{
+	Retryable: []string{
+		`(?i)the object has been modified`,
+		`(?i)deadline exceeded`,
+		`(?i)timed? ?out`,
+		`(?i)connection (refused|reset)`,
+		`(?i)unavailable`,
+		`(?i)throttl`,
+		`(?i)too many requests`,
+		`(?i)rate ?exceeded`,
+		`(?i)try again`,
+	},
+	Quota: []string{
+		`(?i)quota`,
+		`(?i)limit ?exceeded`,
+		`(?i)exceeded .*limit`,
+		`(?i)insufficient (capacity|space|storage)`,
+		`(?i)no space left`,
+	},
+	Fatal: []string{
+		`(?i)not found`,
+		`(?i)invalid`,
+		`(?i)not supported|unsupported`,
+		`(?i)permission denied|forbidden|unauthori[sz]ed|access ?denied`,
+	},
+}
+
+// snapshotErrorMatcher is a compiled set of patterns of each category.
+type snapshotErrorMatcher struct {
+	// the categories are matched in this order, so that e.g. a quota error mentioning a retry is a quota error
+	categories []SnapshotErrorCategory
+	patterns   map[SnapshotErrorCategory][]*regexp.Regexp
+}
+
+func newSnapshotErrorMatcher(patterns SnapshotErrorPatterns) (*snapshotErrorMatcher, error) {
+	m := &snapshotErrorMatcher{
+		categories: []SnapshotErrorCategory{SnapshotErrorQuota, SnapshotErrorFatal, SnapshotErrorRetryable},
+		patterns:   map[SnapshotErrorCategory][]*regexp.Regexp{},
+	}
+	for category, exprs := range map[SnapshotErrorCategory][]string{
+		SnapshotErrorRetryable: patterns.Retryable,
+		SnapshotErrorQuota:     patterns.Quota,
+		SnapshotErrorFatal:     patterns.Fatal,
+	} {
+		for _, expr := range exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error compiling %s snapshot error pattern %q", category, expr)
+			}
+			m.patterns[category] = append(m.patterns[category], re)
+		}
+	}
+	return m, nil
+}
+
+func (m *snapshotErrorMatcher) match(message string) (SnapshotErrorCategory, bool) {
+	if m == nil {
+		return "", false
+	}
+	for _, category := range m.categories {
+		for _, re := range m.patterns[category] {
+			if re.MatchString(message) {
+				return category, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SnapshotErrorClassifier classifies the errors reported on VolumeSnapshots and VolumeSnapshotContents.
+// A nil classifier only uses the built-in patterns.
+type SnapshotErrorClassifier struct {
+	drivers map[string]*snapshotErrorMatcher
+	all     *snapshotErrorMatcher
+}
+
+// NewSnapshotErrorClassifier returns a classifier using the patterns of the plugin config ConfigMap, if any,
+// before the built-in patterns.
+func NewSnapshotErrorClassifier(config *corev1api.ConfigMap) (*SnapshotErrorClassifier, error) {
+	classifier := &SnapshotErrorClassifier{drivers: map[string]*snapshotErrorMatcher{}}
+	if config == nil {
+		return classifier, nil
+	}
+	data, ok := config.Data[SnapshotErrorPatternsConfigKey]
+	if !ok {
+		return classifier, nil
+	}
+
+	patterns := &SnapshotErrorPatternsConfig{}
+	if err := yaml.UnmarshalStrict([]byte(data), patterns); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s of ConfigMap %s/%s", SnapshotErrorPatternsConfigKey, config.Namespace, config.Name)
+	}
+	var err error
+	if classifier.all, err = newSnapshotErrorMatcher(patterns.SnapshotErrorPatterns); err != nil {
+		return nil, err
+	}
+	for driver, driverPatterns := range patterns.Drivers {
+		if classifier.drivers[driver], err = newSnapshotErrorMatcher(driverPatterns); err != nil {
+			return nil, errors.Wrapf(err, "error compiling snapshot error patterns of driver %s", driver)
+		}
+	}
+	return classifier, nil
+}
+
+func mustNewSnapshotErrorMatcher(patterns SnapshotErrorPatterns) *snapshotErrorMatcher {
+	m, err := newSnapshotErrorMatcher(patterns)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+var (
+	builtinSnapshotErrorMatcher = mustNewSnapshotErrorMatcher(builtinSnapshotErrorPatterns)
+	// builtinVolumeSnapshotErrorMatcher leaves out the built-in fatal patterns: the errors reported on VolumeSnapshots
+	// are mostly races of the snapshot controller, e.g. a volumesnapshotcontent not found yet, which go away.
+	builtinVolumeSnapshotErrorMatcher = mustNewSnapshotErrorMatcher(SnapshotErrorPatterns{
+		Retryable: builtinSnapshotErrorPatterns.Retryable,
+		Quota:     builtinSnapshotErrorPatterns.Quota,
+	})
+)
+
+// Classify returns the category of the error message reported for a snapshot of the driver.
+// Messages matching no pattern are of the fallback category.
+func (c *SnapshotErrorClassifier) Classify(driver, message string, fallback SnapshotErrorCategory) SnapshotErrorCategory {
+	return c.classify(driver, message, fallback, builtinSnapshotErrorMatcher)
+}
+
+func (c *SnapshotErrorClassifier) classify(driver, message string, fallback SnapshotErrorCategory, builtin *snapshotErrorMatcher) SnapshotErrorCategory {
+	if c != nil {
+		if category, ok := c.drivers[driver].match(message); ok {
+			return category
+		}
+		if category, ok := c.all.match(message); ok {
+			return category
+		}
+	}
+	if category, ok := builtin.match(message); ok {
+		return category
+	}
+	return fallback
+}
+
+// ClassifyVolumeSnapshotError returns the category of the error of the VolumeSnapshot, if it has one.
+// The errors reported on VolumeSnapshots are retryable unless they match a configured fatal pattern.
+func (c *SnapshotErrorClassifier) ClassifyVolumeSnapshotError(driver string, err *snapshotv1api.VolumeSnapshotError) (SnapshotErrorCategory, string, bool) {
+	if err == nil {
+		return "", "", false
+	}
+	message := ""
+	if err.Message != nil {
+		message = *err.Message
+	}
+	return c.classify(driver, message, SnapshotErrorRetryable, builtinVolumeSnapshotErrorMatcher), message, true
+}
+
+// ClassifyVolumeSnapshotContentError returns the category of the error of the VolumeSnapshotContent, if it has one.
+// The errors reported on VolumeSnapshotContents matching no pattern are fatal.
+func (c *SnapshotErrorClassifier) ClassifyVolumeSnapshotContentError(vsc *snapshotv1api.VolumeSnapshotContent) (SnapshotErrorCategory, string, bool) {
+	if vsc.Status == nil || vsc.Status.Error == nil {
+		return "", "", false
+	}
+	message := ""
+	if vsc.Status.Error.Message != nil {
+		message = *vsc.Status.Error.Message
+	}
+	return c.Classify(vsc.Spec.Driver, message, SnapshotErrorFatal), message, true
+}
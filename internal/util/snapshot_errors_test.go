@@ -0,0 +1,150 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+const testSnapshotErrorPatterns = `
+fatal: ["(?i)volume is being deleted"]
+drivers:
+  ebs.csi.aws.com:
+    retryable: ["SnapshotCreationPerVolumeRateExceeded"]
+    quota: ["(?i)maximum number of snapshots"]
+`
+
+func TestNewSnapshotErrorClassifier(t *testing.T) {
+	classifier, err := NewSnapshotErrorClassifier(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, classifier)
+
+	_, err = NewSnapshotErrorClassifier(builder.ForConfigMap("velero", "config").Data(SnapshotErrorPatternsConfigKey, "fatal: [\"(\"]").Result())
+	assert.Error(t, err)
+
+	_, err = NewSnapshotErrorClassifier(builder.ForConfigMap("velero", "config").Data(SnapshotErrorPatternsConfigKey, "transient: [foo]").Result())
+	assert.Error(t, err)
+}
+
+func TestSnapshotErrorClassifierClassify(t *testing.T) {
+	classifier, err := NewSnapshotErrorClassifier(builder.ForConfigMap("velero", "config").Data(SnapshotErrorPatternsConfigKey, testSnapshotErrorPatterns).Result())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		classifier *SnapshotErrorClassifier
+		driver     string
+		message    string
+		fallback   SnapshotErrorCategory
+		expected   SnapshotErrorCategory
+	}{
+		{
+			name:     "built-in retryable pattern",
+			message:  "Operation cannot be fulfilled: the object has been modified; please apply your changes to the latest version and try again",
+			fallback: SnapshotErrorFatal,
+			expected: SnapshotErrorRetryable,
+		},
+		{
+			name:     "built-in quota pattern",
+			message:  "rpc error: code = ResourceExhausted desc = Quota 'SNAPSHOTS' exceeded",
+			fallback: SnapshotErrorFatal,
+			expected: SnapshotErrorQuota,
+		},
+		{
+			name:     "built-in fatal pattern",
+			message:  "volumesnapshotclass \"foo\" not found",
+			fallback: SnapshotErrorRetryable,
+			expected: SnapshotErrorFatal,
+		},
+		{
+			name:     "no pattern matches",
+			message:  "something happened",
+			fallback: SnapshotErrorRetryable,
+			expected: SnapshotErrorRetryable,
+		},
+		{
+			name:     "pattern for all drivers",
+			driver:   "foo.csi.k8s.io",
+			message:  "volume is being deleted",
+			fallback: SnapshotErrorRetryable,
+			expected: SnapshotErrorFatal,
+		},
+		{
+			name:     "driver pattern takes precedence over built-in patterns",
+			driver:   "ebs.csi.aws.com",
+			message:  "SnapshotCreationPerVolumeRateExceeded: limit exceeded",
+			fallback: SnapshotErrorFatal,
+			expected: SnapshotErrorRetryable,
+		},
+		{
+			name:     "driver pattern doesn't apply to other drivers",
+			driver:   "foo.csi.k8s.io",
+			message:  "maximum number of snapshots reached",
+			fallback: SnapshotErrorFatal,
+			expected: SnapshotErrorFatal,
+		},
+		{
+			name:     "nil classifier uses the built-in patterns",
+			message:  "rpc error: code = Unavailable",
+			fallback: SnapshotErrorFatal,
+			expected: SnapshotErrorRetryable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := classifier
+			if tc.name == "nil classifier uses the built-in patterns" {
+				c = nil
+			}
+			assert.Equal(t, tc.expected, c.Classify(tc.driver, tc.message, tc.fallback))
+		})
+	}
+}
+
+func TestClassifyVolumeSnapshotError(t *testing.T) {
+	classifier, err := NewSnapshotErrorClassifier(builder.ForConfigMap("velero", "config").Data(SnapshotErrorPatternsConfigKey, testSnapshotErrorPatterns).Result())
+	require.NoError(t, err)
+
+	_, _, ok := classifier.ClassifyVolumeSnapshotError("foo.csi.k8s.io", nil)
+	assert.False(t, ok)
+
+	for message, expected := range map[string]SnapshotErrorCategory{
+		// the built-in fatal patterns don't apply to volumesnapshot errors
+		"Failed to check and update snapshot content: volumesnapshotcontents \"snapcontent-1\" not found": SnapshotErrorRetryable,
+		"invalid snapshot class": SnapshotErrorRetryable,
+		"rpc error: code = ResourceExhausted desc = Quota 'SNAPSHOTS' exceeded": SnapshotErrorQuota,
+		// configured fatal patterns do
+		"volume is being deleted": SnapshotErrorFatal,
+	} {
+		category, actualMessage, ok := classifier.ClassifyVolumeSnapshotError("foo.csi.k8s.io", &snapshotv1api.VolumeSnapshotError{Message: &message})
+		assert.True(t, ok)
+		assert.Equal(t, message, actualMessage)
+		assert.Equal(t, expected, category, message)
+	}
+
+	var nilClassifier *SnapshotErrorClassifier
+	message := "volumesnapshotclass \"foo\" not found"
+	category, _, _ := nilClassifier.ClassifyVolumeSnapshotError("foo.csi.k8s.io", &snapshotv1api.VolumeSnapshotError{Message: &message})
+	assert.Equal(t, SnapshotErrorRetryable, category)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VolumeSnapshotMetadataVersion is the version of the VolumeSnapshotMetadata record written by the plugin.
+// Records of a later version can't be read.
+const VolumeSnapshotMetadataVersion = 1
+
+// VolumeSnapshotMetadata records, in the VolumeSnapshotMetadataAnnotation of a backed-up VolumeSnapshot,
+// what is needed to restore its snapshot.
+type VolumeSnapshotMetadata struct {
+	Version int `json:"version"`
+	// SnapshotHandle and Driver identify the snapshot in the storage provider.
+	SnapshotHandle string `json:"snapshotHandle,omitempty"`
+	Driver         string `json:"driver,omitempty"`
+	// DeletionPolicy is the deletion policy of the VolumeSnapshotContent when the VolumeSnapshot was backed up.
+	DeletionPolicy                snapshotv1api.DeletionPolicy `json:"deletionPolicy,omitempty"`
+	VolumeSnapshotClassName       string                       `json:"volumeSnapshotClassName,omitempty"`
+	VolumeSnapshotClassParameters map[string]string            `json:"volumeSnapshotClassParameters,omitempty"`
+	RestoreSize                   *resource.Quantity           `json:"restoreSize,omitempty"`
+	CreationTime                  *metav1.Time                 `json:"creationTime,omitempty"`
+	// SourceVolumeHandle and VolumeMode are the CSI volume handle and the volume mode of the snapshotted volume.
+	SourceVolumeHandle string                          `json:"sourceVolumeHandle,omitempty"`
+	VolumeMode         *corev1api.PersistentVolumeMode `json:"volumeMode,omitempty"`
+	// UserCreated tells the VolumeSnapshot was not created by Velero, its snapshot is never deleted by Velero.
+	UserCreated bool `json:"userCreated,omitempty"`
+}
+
+// NewVolumeSnapshotMetadata returns the metadata of the snapshot of the VolumeSnapshotContent and of its VolumeSnapshotClass, if any.
+func NewVolumeSnapshotMetadata(vsc *snapshotv1api.VolumeSnapshotContent, class *snapshotv1api.VolumeSnapshotClass) *VolumeSnapshotMetadata {
+	metadata := &VolumeSnapshotMetadata{
+		Version:        VolumeSnapshotMetadataVersion,
+		Driver:         vsc.Spec.Driver,
+		DeletionPolicy: vsc.Spec.DeletionPolicy,
+		VolumeMode:     vsc.Spec.SourceVolumeMode,
+	}
+	if vsc.Spec.Source.VolumeHandle != nil {
+		metadata.SourceVolumeHandle = *vsc.Spec.Source.VolumeHandle
+	}
+	if vsc.Spec.VolumeSnapshotClassName != nil {
+		metadata.VolumeSnapshotClassName = *vsc.Spec.VolumeSnapshotClassName
+	}
+	if class != nil {
+		metadata.VolumeSnapshotClassName = class.Name
+		metadata.VolumeSnapshotClassParameters = class.Parameters
+	}
+	if vsc.Status != nil {
+		if vsc.Status.SnapshotHandle != nil {
+			metadata.SnapshotHandle = *vsc.Status.SnapshotHandle
+		}
+		if vsc.Status.RestoreSize != nil {
+			metadata.RestoreSize = resource.NewQuantity(*vsc.Status.RestoreSize, resource.BinarySI)
+		}
+		if vsc.Status.CreationTime != nil {
+			creationTime := metav1.Unix(0, *vsc.Status.CreationTime)
+			metadata.CreationTime = &creationTime
+		}
+	}
+	return metadata
+}
+
+// Annotations returns the annotations recording the metadata on a VolumeSnapshot.
+func (m *VolumeSnapshotMetadata) Annotations() (map[string]string, error) {
+	record, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding volumesnapshot metadata")
+	}
+	return map[string]string{VolumeSnapshotMetadataAnnotation: string(record)}, nil
+}
+
+// GetVolumeSnapshotMetadata returns the metadata recorded on the backed-up VolumeSnapshot. The metadata of
+// VolumeSnapshots backed up before the record was introduced is read from the loose annotations they have.
+// nil is returned if the VolumeSnapshot has no metadata at all.
+func GetVolumeSnapshotMetadata(vs *snapshotv1api.VolumeSnapshot) (*VolumeSnapshotMetadata, error) {
+	if record, ok := vs.Annotations[VolumeSnapshotMetadataAnnotation]; ok {
+		metadata := &VolumeSnapshotMetadata{}
+		if err := json.Unmarshal([]byte(record), metadata); err != nil {
+			return nil, errors.Wrapf(err, "error decoding %s annotation of volumesnapshot %s/%s", VolumeSnapshotMetadataAnnotation, vs.Namespace, vs.Name)
+		}
+		if metadata.Version > VolumeSnapshotMetadataVersion {
+			return nil, errors.Errorf("version %d of %s annotation of volumesnapshot %s/%s is not supported, the latest supported version is %d",
+				metadata.Version, VolumeSnapshotMetadataAnnotation, vs.Namespace, vs.Name, VolumeSnapshotMetadataVersion)
+		}
+		return metadata, nil
+	}
+
+	return getLegacyVolumeSnapshotMetadata(vs)
+}
+
+// getLegacyVolumeSnapshotMetadata reads the metadata from the annotations recorded on VolumeSnapshots by former versions of the plugin.
+func getLegacyVolumeSnapshotMetadata(vs *snapshotv1api.VolumeSnapshot) (*VolumeSnapshotMetadata, error) {
+	metadata := &VolumeSnapshotMetadata{
+		SnapshotHandle: vs.Annotations[VolumeSnapshotHandleAnnotation],
+		Driver:         vs.Annotations[CSIDriverNameAnnotation],
+		DeletionPolicy: snapshotv1api.DeletionPolicy(vs.Annotations[CSIVSCDeletionPolicy]),
+	}
+	if restoreSize, ok := vs.Annotations[VolumeSnapshotRestoreSize]; ok {
+		quantity, err := resource.ParseQuantity(restoreSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s annotation %s of volumesnapshot %s/%s into restore size",
+				VolumeSnapshotRestoreSize, restoreSize, vs.Namespace, vs.Name)
+		}
+		metadata.RestoreSize = &quantity
+	}
+	if metadata.SnapshotHandle == "" && metadata.Driver == "" && metadata.DeletionPolicy == "" && metadata.RestoreSize == nil {
+		return nil, nil
+	}
+	return metadata, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestVolumeSnapshotMetadata(t *testing.T) {
+	handle := "handle"
+	volumeHandle := "volume-handle"
+	className := "class"
+	restoreSize := int64(1 << 30)
+	creationTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	creationTimeNano := creationTime.UnixNano()
+	volumeMode := corev1api.PersistentVolumeFilesystem
+
+	vsc := builder.ForVolumeSnapshotContent("vsc").DeletionPolicy(snapshotv1api.VolumeSnapshotContentRetain).
+		VolumeSnapshotClassName(className).Status(&snapshotv1api.VolumeSnapshotContentStatus{
+		SnapshotHandle: &handle,
+		RestoreSize:    &restoreSize,
+		CreationTime:   &creationTimeNano,
+	}).Result()
+	vsc.Spec.Driver = "hostpath.csi.k8s.io"
+	vsc.Spec.Source.VolumeHandle = &volumeHandle
+	vsc.Spec.SourceVolumeMode = &volumeMode
+	class := builder.ForVolumeSnapshotClass(className).Driver("hostpath.csi.k8s.io").Result()
+	class.Parameters = map[string]string{"type": "ssd"}
+
+	metadata := NewVolumeSnapshotMetadata(vsc, class)
+	annotations, err := metadata.Annotations()
+	require.NoError(t, err)
+	assert.Len(t, annotations, 1)
+
+	// the metadata is read back from the record
+	vs := builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotationsMap(annotations)).Result()
+	got, err := GetVolumeSnapshotMetadata(vs)
+	require.NoError(t, err)
+	assert.Equal(t, VolumeSnapshotMetadataVersion, got.Version)
+	assert.Equal(t, handle, got.SnapshotHandle)
+	assert.Equal(t, "hostpath.csi.k8s.io", got.Driver)
+	assert.Equal(t, snapshotv1api.VolumeSnapshotContentRetain, got.DeletionPolicy)
+	assert.Equal(t, className, got.VolumeSnapshotClassName)
+	assert.Equal(t, map[string]string{"type": "ssd"}, got.VolumeSnapshotClassParameters)
+	assert.Equal(t, int64(1<<30), got.RestoreSize.Value())
+	assert.True(t, creationTime.Equal(got.CreationTime.Time))
+	assert.Equal(t, volumeHandle, got.SourceVolumeHandle)
+	assert.Equal(t, &volumeMode, got.VolumeMode)
+}
+
+func TestGetVolumeSnapshotMetadata(t *testing.T) {
+	restoreSize := resource.MustParse("10Gi")
+
+	testCases := []struct {
+		name        string
+		annotations []string
+		expected    *VolumeSnapshotMetadata
+		expectedErr bool
+	}{
+		{
+			name:     "no metadata",
+			expected: nil,
+		},
+		{
+			name: "legacy annotations",
+			annotations: []string{
+				VolumeSnapshotHandleAnnotation, "handle",
+				CSIDriverNameAnnotation, "driver",
+				CSIVSCDeletionPolicy, "Retain",
+				VolumeSnapshotRestoreSize, "10Gi",
+			},
+			expected: &VolumeSnapshotMetadata{SnapshotHandle: "handle", Driver: "driver", DeletionPolicy: "Retain", RestoreSize: &restoreSize},
+		},
+		{
+			name:        "legacy restore size annotation is invalid",
+			annotations: []string{VolumeSnapshotRestoreSize, "ten"},
+			expectedErr: true,
+		},
+		{
+			name:        "record takes precedence over legacy annotations",
+			annotations: []string{VolumeSnapshotMetadataAnnotation, `{"version":1,"snapshotHandle":"handle","driver":"driver"}`, VolumeSnapshotHandleAnnotation, "legacy"},
+			expected:    &VolumeSnapshotMetadata{Version: 1, SnapshotHandle: "handle", Driver: "driver"},
+		},
+		{
+			name:        "record is invalid",
+			annotations: []string{VolumeSnapshotMetadataAnnotation, `{"version":`},
+			expectedErr: true,
+		},
+		{
+			name:        "record of a later version",
+			annotations: []string{VolumeSnapshotMetadataAnnotation, `{"version":2}`},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vs := builder.ForVolumeSnapshot("ns", "vs").ObjectMeta(builder.WithAnnotations(tc.annotations...)).Result()
+			metadata, err := GetVolumeSnapshotMetadata(vs)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, metadata)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SnapshotVerificationConfigKey is the key of the snapshot verification settings in the plugin config ConfigMap.
+	SnapshotVerificationConfigKey = "snapshotVerification"
+
+	defaultSnapshotVerificationTimeout = 10 * time.Minute
+)
+
+// SnapshotVerificationConfig enables the verification of the snapshots taken by backups, by provisioning
+// a temporary PVC from each snapshot once it is ready.
+type SnapshotVerificationConfig struct {
+	// Timeout is how long the temporary PVC, and the check pod if any, have to succeed.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// StorageClassName is the StorageClass of the temporary PVCs, the StorageClass of the snapshotted PVC by default.
+	StorageClassName string `json:"storageClassName,omitempty"`
+	// Check, if set, runs a pod mounting the temporary PVC which must succeed for the snapshot to be verified.
+	Check *SnapshotVerificationCheck `json:"check,omitempty"`
+}
+
+// SnapshotVerificationCheck is the container run against the volume provisioned from a snapshot.
+// The volume is mounted at /data, or attached at /dev/data for block volumes.
+type SnapshotVerificationCheck struct {
+	Image   string   `json:"image"`
+	Command []string `json:"command,omitempty"`
+}
+
+// ParseSnapshotVerificationConfig parses the snapshot verification settings of the plugin config ConfigMap.
+// nil is returned if the ConfigMap doesn't enable the verification.
+func ParseSnapshotVerificationConfig(config *corev1api.ConfigMap) (*SnapshotVerificationConfig, error) {
+	if config == nil {
+		return nil, nil
+	}
+	data, ok := config.Data[SnapshotVerificationConfigKey]
+	if !ok {
+		return nil, nil
+	}
+
+	verification := &SnapshotVerificationConfig{}
+	if err := yaml.UnmarshalStrict([]byte(data), verification); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s of ConfigMap %s/%s", SnapshotVerificationConfigKey, config.Namespace, config.Name)
+	}
+	if verification.Check != nil && verification.Check.Image == "" {
+		return nil, errors.Errorf("error parsing %s of ConfigMap %s/%s: the check has no image", SnapshotVerificationConfigKey, config.Namespace, config.Name)
+	}
+	if verification.Timeout.Duration <= 0 {
+		verification.Timeout.Duration = defaultSnapshotVerificationTimeout
+	}
+	return verification, nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestParseSnapshotVerificationConfig(t *testing.T) {
+	verification, err := ParseSnapshotVerificationConfig(nil)
+	require.NoError(t, err)
+	assert.Nil(t, verification)
+
+	verification, err = ParseSnapshotVerificationConfig(builder.ForConfigMap("velero", "config").Data("foo", "bar").Result())
+	require.NoError(t, err)
+	assert.Nil(t, verification)
+
+	verification, err = ParseSnapshotVerificationConfig(builder.ForConfigMap("velero", "config").Data(SnapshotVerificationConfigKey, "{}").Result())
+	require.NoError(t, err)
+	assert.Equal(t, defaultSnapshotVerificationTimeout, verification.Timeout.Duration)
+	assert.Nil(t, verification.Check)
+
+	verification, err = ParseSnapshotVerificationConfig(builder.ForConfigMap("velero", "config").Data(SnapshotVerificationConfigKey,
+		"timeout: 2m\nstorageClassName: fast\ncheck:\n  image: busybox\n  command: [ls, /data]").Result())
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, verification.Timeout.Duration)
+	assert.Equal(t, "fast", verification.StorageClassName)
+	assert.Equal(t, &SnapshotVerificationCheck{Image: "busybox", Command: []string{"ls", "/data"}}, verification.Check)
+
+	_, err = ParseSnapshotVerificationConfig(builder.ForConfigMap("velero", "config").Data(SnapshotVerificationConfigKey, "check:\n  command: [ls]").Result())
+	assert.Error(t, err)
+
+	_, err = ParseSnapshotVerificationConfig(builder.ForConfigMap("velero", "config").Data(SnapshotVerificationConfigKey, "enabled: true").Result())
+	assert.Error(t, err)
+}
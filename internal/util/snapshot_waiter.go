@@ -0,0 +1,228 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotter "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/typed/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	snapshotWaitersLock sync.Mutex
+	// snapshotWaiters holds the waiter of each snapshot client volumesnapshots were waited for through.
+	snapshotWaiters = map[snapshotter.SnapshotV1Interface]*snapshotWaiter{}
+)
+
+// snapshotWaiter watches the volumesnapshots and volumesnapshotcontents of the cluster with informers,
+// and wakes up the goroutines waiting for a volumesnapshot on every change. The informers are shared by
+// all the goroutines waiting through the same snapshot client. They are started by the first wait and keep
+// running for the lifetime of the process, as the actions of the plugin share a single snapshot client.
+type snapshotWaiter struct {
+	client      snapshotter.SnapshotV1Interface
+	vsInformer  cache.SharedIndexInformer
+	vscInformer cache.SharedIndexInformer
+
+	lock        sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// getSnapshotWaiter returns the waiter of the snapshot client, starting it on the first wait through the client.
+func getSnapshotWaiter(client snapshotter.SnapshotV1Interface) *snapshotWaiter {
+	snapshotWaitersLock.Lock()
+	defer snapshotWaitersLock.Unlock()
+
+	w, ok := snapshotWaiters[client]
+	if !ok {
+		w = newSnapshotWaiter(client)
+		snapshotWaiters[client] = w
+	}
+	return w
+}
+
+func newSnapshotWaiter(client snapshotter.SnapshotV1Interface) *snapshotWaiter {
+	w := &snapshotWaiter{
+		client: client,
+		vsInformer: cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.VolumeSnapshots(metav1.NamespaceAll).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.VolumeSnapshots(metav1.NamespaceAll).Watch(context.TODO(), options)
+			},
+		}, &snapshotv1api.VolumeSnapshot{}, 0, cache.Indexers{}),
+		vscInformer: cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.VolumeSnapshotContents().List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.VolumeSnapshotContents().Watch(context.TODO(), options)
+			},
+		}, &snapshotv1api.VolumeSnapshotContent{}, 0, cache.Indexers{}),
+		subscribers: map[chan struct{}]struct{}{},
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { w.notify() },
+		UpdateFunc: func(interface{}, interface{}) { w.notify() },
+		DeleteFunc: func(interface{}) { w.notify() },
+	}
+	// the handlers can't fail to be added to informers which are not started yet
+	_, _ = w.vsInformer.AddEventHandler(handler)
+	_, _ = w.vscInformer.AddEventHandler(handler)
+
+	go w.vsInformer.Run(wait.NeverStop)
+	go w.vscInformer.Run(wait.NeverStop)
+	return w
+}
+
+func (w *snapshotWaiter) subscribe() chan struct{} {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	ch := make(chan struct{}, 1)
+	w.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (w *snapshotWaiter) unsubscribe(ch chan struct{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.subscribers, ch)
+}
+
+// notify wakes up every subscriber, a subscriber which was not woken up since the last notification is not blocked on.
+func (w *snapshotWaiter) notify() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for ch := range w.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// waitForSnapshotHandle waits until the volumesnapshotcontent bound to the volumesnapshot has a snapshot handle,
+// or the context is done. The last volumesnapshotcontent seen is returned along with the error when the wait is interrupted.
+// A fatal error of the volumesnapshotcontent ends the wait.
+func (w *snapshotWaiter) waitForSnapshotHandle(ctx context.Context, volSnap *snapshotv1api.VolumeSnapshot,
+	classifier *SnapshotErrorClassifier, log logrus.FieldLogger) (*snapshotv1api.VolumeSnapshotContent, error) {
+	notifications := w.subscribe()
+	defer w.unsubscribe(notifications)
+
+	if !cache.WaitForCacheSync(ctx.Done(), w.vsInformer.HasSynced, w.vscInformer.HasSynced) {
+		return nil, wait.ErrorInterrupted(ctx.Err())
+	}
+
+	var snapshotContent *snapshotv1api.VolumeSnapshotContent
+	lastMessage := ""
+	for {
+		var message string
+		var err error
+		snapshotContent, message, err = w.checkSnapshotHandle(ctx, volSnap)
+		if err != nil {
+			return nil, err
+		}
+		if message == "" {
+			return snapshotContent, nil
+		}
+
+		var category SnapshotErrorCategory
+		var errorMessage string
+		hasError := false
+		if snapshotContent != nil {
+			category, errorMessage, hasError = classifier.ClassifyVolumeSnapshotContentError(snapshotContent)
+		}
+		if hasError && category == SnapshotErrorFatal {
+			log.Errorf("Volumesnapshotcontent %s has %s error: %v", snapshotContent.Name, category, errorMessage)
+			return nil, errors.Errorf("volumesnapshotcontent %s for volumesnapshot %s/%s has %s error: %s",
+				snapshotContent.Name, volSnap.Namespace, volSnap.Name, category, errorMessage)
+		}
+
+		// log the state of the volumesnapshot once, not on every unrelated change
+		if hasError {
+			message += fmt.Sprintf(", it has %s error: %s", category, errorMessage)
+		}
+		if message != lastMessage {
+			if hasError {
+				log.Warn(message)
+			} else {
+				log.Info(message)
+			}
+			lastMessage = message
+		}
+
+		select {
+		case <-notifications:
+		case <-ctx.Done():
+			return snapshotContent, wait.ErrorInterrupted(ctx.Err())
+		}
+	}
+}
+
+// checkSnapshotHandle returns the volumesnapshotcontent bound to the volumesnapshot and, if it has no snapshot handle yet,
+// a message saying what is waited for.
+func (w *snapshotWaiter) checkSnapshotHandle(ctx context.Context, volSnap *snapshotv1api.VolumeSnapshot) (*snapshotv1api.VolumeSnapshotContent, string, error) {
+	obj, exists, err := w.vsInformer.GetStore().GetByKey(volSnap.Namespace + "/" + volSnap.Name)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if !exists {
+		// the informer may not have seen a volumesnapshot just created yet
+		if _, err := w.client.VolumeSnapshots(volSnap.Namespace).Get(ctx, volSnap.Name, metav1.GetOptions{}); err != nil {
+			return nil, "", errors.Wrapf(err, fmt.Sprintf("failed to get volumesnapshot %s/%s", volSnap.Namespace, volSnap.Name))
+		}
+		return nil, fmt.Sprintf("Waiting for volumesnapshot %s/%s to be watched", volSnap.Namespace, volSnap.Name), nil
+	}
+	vs := obj.(*snapshotv1api.VolumeSnapshot)
+
+	if vs.Status == nil || vs.Status.BoundVolumeSnapshotContentName == nil {
+		return nil, fmt.Sprintf("Waiting for CSI driver to reconcile volumesnapshot %s/%s", volSnap.Namespace, volSnap.Name), nil
+	}
+
+	vscName := *vs.Status.BoundVolumeSnapshotContentName
+	obj, exists, err = w.vscInformer.GetStore().GetByKey(vscName)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if !exists {
+		if _, err := w.client.VolumeSnapshotContents().Get(ctx, vscName, metav1.GetOptions{}); err != nil {
+			return nil, "", errors.Wrapf(err, fmt.Sprintf("failed to get volumesnapshotcontent %s for volumesnapshot %s/%s", vscName, vs.Namespace, vs.Name))
+		}
+		return nil, fmt.Sprintf("Waiting for volumesnapshotcontent %s to be watched", vscName), nil
+	}
+	snapshotContent := obj.(*snapshotv1api.VolumeSnapshotContent)
+
+	// we need to wait for the VolumeSnaphotContent to have a snapshot handle because during restore,
+	// we'll use that snapshot handle as the source for the VolumeSnapshotContent so it's statically
+	// bound to the existing snapshot.
+	if snapshotContent.Status == nil || snapshotContent.Status.SnapshotHandle == nil {
+		return snapshotContent, fmt.Sprintf("Waiting for volumesnapshotcontents %s to have snapshot handle", snapshotContent.Name), nil
+	}
+
+	return snapshotContent.DeepCopy(), "", nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotFake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestGetVolumeSnapshotContentForVolumeSnapshotWakesUpOnChange(t *testing.T) {
+	fakeClient := snapshotFake.NewSimpleClientset()
+	snapshotClient := fakeClient.SnapshotV1()
+
+	var vsList []*snapshotv1api.VolumeSnapshot
+	for _, name := range []string{"vs-1", "vs-2", "vs-3"} {
+		vs, err := snapshotClient.VolumeSnapshots("ns").Create(context.TODO(), builder.ForVolumeSnapshot("ns", name).Result(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		vsList = append(vsList, vs)
+	}
+
+	// all the volumesnapshots are waited for concurrently through the same waiter
+	wg := sync.WaitGroup{}
+	results := make([]*snapshotv1api.VolumeSnapshotContent, len(vsList))
+	for i := range vsList {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vsc, err := GetVolumeSnapshotContentForVolumeSnapshot(vsList[i], snapshotClient, nil, logrus.New(), true, time.Minute)
+			assert.NoError(t, err)
+			results[i] = vsc
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for _, vs := range vsList {
+		vscName := "content-" + vs.Name
+		handle := "handle-" + vs.Name
+		_, err := snapshotClient.VolumeSnapshotContents().Create(context.TODO(),
+			builder.ForVolumeSnapshotContent(vscName).Status(&snapshotv1api.VolumeSnapshotContentStatus{SnapshotHandle: &handle}).Result(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		vs.Status = &snapshotv1api.VolumeSnapshotStatus{BoundVolumeSnapshotContentName: &vscName}
+		_, err = snapshotClient.VolumeSnapshots(vs.Namespace).UpdateStatus(context.TODO(), vs, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the volumesnapshotcontents")
+	}
+
+	for i, vs := range vsList {
+		require.NotNil(t, results[i])
+		assert.Equal(t, "content-"+vs.Name, results[i].Name)
+	}
+
+	// the informers keep running for the next waits through the client
+	waiter := getSnapshotWaiter(snapshotClient)
+	assert.True(t, waiter.vsInformer.HasSynced())
+	assert.True(t, waiter.vscInformer.HasSynced())
+	vsc, err := GetVolumeSnapshotContentForVolumeSnapshot(vsList[0], snapshotClient, nil, logrus.New(), true, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "content-vs-1", vsc.Name)
+	assert.Same(t, waiter, getSnapshotWaiter(snapshotClient))
+}
+
+func TestGetVolumeSnapshotContentForVolumeSnapshotTimeout(t *testing.T) {
+	vscName := "content"
+	message := "quota exceeded"
+	vs := builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName(vscName).Result()
+	vsc := builder.ForVolumeSnapshotContent(vscName).Status(&snapshotv1api.VolumeSnapshotContentStatus{
+		Error: &snapshotv1api.VolumeSnapshotError{Message: &message},
+	}).Result()
+	fakeClient := snapshotFake.NewSimpleClientset(vs, vsc)
+
+	_, err := GetVolumeSnapshotContentForVolumeSnapshot(vs, fakeClient.SnapshotV1(), nil, logrus.New(), true, 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), message)
+
+	unbound := builder.ForVolumeSnapshot("ns", "unbound").Result()
+	fakeClient = snapshotFake.NewSimpleClientset(unbound)
+	_, err = GetVolumeSnapshotContentForVolumeSnapshot(unbound, fakeClient.SnapshotV1(), nil, logrus.New(), true, 200*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestGetVolumeSnapshotContentForVolumeSnapshotFatalError(t *testing.T) {
+	vscName := "content"
+	message := "invalid snapshot parameters"
+	vs := builder.ForVolumeSnapshot("ns", "vs").Status().BoundVolumeSnapshotContentName(vscName).Result()
+	vsc := builder.ForVolumeSnapshotContent(vscName).Status(&snapshotv1api.VolumeSnapshotContentStatus{
+		Error: &snapshotv1api.VolumeSnapshotError{Message: &message},
+	}).Result()
+	fakeClient := snapshotFake.NewSimpleClientset(vs, vsc)
+
+	// the fatal error ends the wait right away
+	start := time.Now()
+	_, err := GetVolumeSnapshotContentForVolumeSnapshot(vs, fakeClient.SnapshotV1(), nil, logrus.New(), true, time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fatal error: "+message)
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
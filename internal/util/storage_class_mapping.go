@@ -0,0 +1,71 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// StorageClassMappingConfigKey is the key of the StorageClass mapping in the PVC restore plugin config ConfigMap.
+	StorageClassMappingConfigKey = "storageClassMapping"
+	// CSIDriverMappingConfigKey is the key of the CSI driver mapping in the PVC restore plugin config ConfigMap.
+	CSIDriverMappingConfigKey = "csiDriverMapping"
+)
+
+// ParseStorageClassMappingConfig parses the mapping of the StorageClasses of backed-up PVCs to the StorageClasses
+// they are restored with of the plugin config ConfigMap. nil is returned if the ConfigMap sets no mapping.
+func ParseStorageClassMappingConfig(config *corev1api.ConfigMap) (map[string]string, error) {
+	return parseMappingConfig(config, StorageClassMappingConfigKey, "storage class")
+}
+
+// ParseCSIDriverMappingConfig parses the mapping of the CSI drivers of backed-up snapshots to the CSI drivers
+// of the cluster they are restored in of the plugin config ConfigMap. nil is returned if the ConfigMap sets no mapping.
+func ParseCSIDriverMappingConfig(config *corev1api.ConfigMap) (map[string]string, error) {
+	return parseMappingConfig(config, CSIDriverMappingConfigKey, "CSI driver")
+}
+
+func parseMappingConfig(config *corev1api.ConfigMap, key, kind string) (map[string]string, error) {
+	if config == nil {
+		return nil, nil
+	}
+	data, ok := config.Data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	mapping := map[string]string{}
+	if err := yaml.UnmarshalStrict([]byte(data), &mapping); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s of ConfigMap %s/%s", key, config.Namespace, config.Name)
+	}
+	for from, to := range mapping {
+		if to == "" {
+			return nil, errors.Errorf("%s of ConfigMap %s/%s maps %s %s to no %s", key, config.Namespace, config.Name, kind, from, kind)
+		}
+	}
+	return mapping, nil
+}
+
+// MapCSIDriver returns the CSI driver the driver of a backed-up snapshot is mapped to, the driver itself if it is not mapped.
+func MapCSIDriver(driver string, mapping map[string]string) string {
+	if mapped, ok := mapping[driver]; ok {
+		return mapped
+	}
+	return driver
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestParseStorageClassMappingConfig(t *testing.T) {
+	mapping, err := ParseStorageClassMappingConfig(nil)
+	require.NoError(t, err)
+	assert.Nil(t, mapping)
+
+	mapping, err = ParseStorageClassMappingConfig(builder.ForConfigMap("velero", "config").Result())
+	require.NoError(t, err)
+	assert.Nil(t, mapping)
+
+	mapping, err = ParseStorageClassMappingConfig(builder.ForConfigMap("velero", "config").
+		Data(StorageClassMappingConfigKey, "gp2: gp3\nstandard: premium-rwo").Result())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"gp2": "gp3", "standard": "premium-rwo"}, mapping)
+
+	_, err = ParseStorageClassMappingConfig(builder.ForConfigMap("velero", "config").Data(StorageClassMappingConfigKey, "- gp2").Result())
+	assert.Error(t, err)
+
+	_, err = ParseStorageClassMappingConfig(builder.ForConfigMap("velero", "config").Data(StorageClassMappingConfigKey, "gp2: \"\"").Result())
+	assert.EqualError(t, err, "storageClassMapping of ConfigMap velero/config maps storage class gp2 to no storage class")
+}
+
+func TestParseCSIDriverMappingConfig(t *testing.T) {
+	mapping, err := ParseCSIDriverMappingConfig(builder.ForConfigMap("velero", "config").
+		Data(StorageClassMappingConfigKey, "gp2: gp3").Result())
+	require.NoError(t, err)
+	assert.Nil(t, mapping)
+
+	mapping, err = ParseCSIDriverMappingConfig(builder.ForConfigMap("velero", "config").
+		Data(CSIDriverMappingConfigKey, "hostpath.csi.k8s.io: ebs.csi.aws.com").Result())
+	require.NoError(t, err)
+	assert.Equal(t, "ebs.csi.aws.com", MapCSIDriver("hostpath.csi.k8s.io", mapping))
+	assert.Equal(t, "pd.csi.storage.gke.io", MapCSIDriver("pd.csi.storage.gke.io", mapping))
+
+	_, err = ParseCSIDriverMappingConfig(builder.ForConfigMap("velero", "config").Data(CSIDriverMappingConfigKey, "hostpath.csi.k8s.io: \"\"").Result())
+	assert.EqualError(t, err, "csiDriverMapping of ConfigMap velero/config maps CSI driver hostpath.csi.k8s.io to no CSI driver")
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+const (
+	// UnboundPVCPolicyConfigKey is the key of the policy for PVCs not bound to a volume in the plugin config ConfigMap.
+	UnboundPVCPolicyConfigKey = "unboundPVCPolicy"
+
+	// UnboundPVCPolicyFail fails the backup of a PVC not bound to a volume.
+	UnboundPVCPolicyFail = "fail"
+	// UnboundPVCPolicyBackupSpec backs up the spec only of a PVC not bound to a volume.
+	UnboundPVCPolicyBackupSpec = "backupSpec"
+)
+
+// GetUnboundPVCPolicy returns the policy for PVCs not bound to a volume of the backup annotation, else of the plugin config.
+// The backup of unbound PVCs fails when neither sets a policy.
+func GetUnboundPVCPolicy(backup *velerov1api.Backup, config *corev1api.ConfigMap) (string, error) {
+	policy, ok := backup.Annotations[UnboundPVCPolicyBackupAnnotation]
+	if !ok && config != nil {
+		policy, ok = config.Data[UnboundPVCPolicyConfigKey]
+	}
+	if !ok {
+		return UnboundPVCPolicyFail, nil
+	}
+
+	switch policy {
+	case UnboundPVCPolicyFail, UnboundPVCPolicyBackupSpec:
+		return policy, nil
+	default:
+		return "", errors.Errorf("invalid unbound PVC policy %q, expected %q or %q", policy, UnboundPVCPolicyFail, UnboundPVCPolicyBackupSpec)
+	}
+}
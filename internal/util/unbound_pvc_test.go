@@ -0,0 +1,75 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1api "k8s.io/api/core/v1"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestGetUnboundPVCPolicy(t *testing.T) {
+	config := builder.ForConfigMap("velero", "config").Data(UnboundPVCPolicyConfigKey, UnboundPVCPolicyBackupSpec).Result()
+	testCases := []struct {
+		name           string
+		backup         *velerov1api.Backup
+		config         *corev1api.ConfigMap
+		expectedPolicy string
+		expectedErr    string
+	}{
+		{
+			name:           "no policy fails unbound PVCs",
+			backup:         builder.ForBackup("velero", "backup").Result(),
+			config:         builder.ForConfigMap("velero", "config").Result(),
+			expectedPolicy: UnboundPVCPolicyFail,
+		},
+		{
+			name:           "policy of the plugin config",
+			backup:         builder.ForBackup("velero", "backup").Result(),
+			config:         config,
+			expectedPolicy: UnboundPVCPolicyBackupSpec,
+		},
+		{
+			name:           "backup annotation overrides the plugin config",
+			backup:         builder.ForBackup("velero", "backup").ObjectMeta(builder.WithAnnotations(UnboundPVCPolicyBackupAnnotation, UnboundPVCPolicyFail)).Result(),
+			config:         config,
+			expectedPolicy: UnboundPVCPolicyFail,
+		},
+		{
+			name:        "invalid policy",
+			backup:      builder.ForBackup("velero", "backup").ObjectMeta(builder.WithAnnotations(UnboundPVCPolicyBackupAnnotation, "skip")).Result(),
+			expectedErr: `invalid unbound PVC policy "skip", expected "fail" or "backupSpec"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := GetUnboundPVCPolicy(tc.backup, tc.config)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPolicy, policy)
+		})
+	}
+}
@@ -19,6 +19,8 @@ package util
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,18 +30,15 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1api "k8s.io/api/core/v1"
+	storagev1api "k8s.io/api/storage/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/kubernetes"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/tools/clientcmd"
-	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	storagev1client "k8s.io/client-go/kubernetes/typed/storage/v1"
 
 	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
-	velerov2alpha1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v2alpha1"
 	"github.com/vmware-tanzu/velero/pkg/label"
 	"github.com/vmware-tanzu/velero/pkg/util/podvolume"
 )
@@ -47,8 +46,15 @@ import (
 const (
 	VolumeSnapshotKindName    = "VolumeSnapshot"
 	defaultCSISnapshotTimeout = 10 * time.Minute
+
+	defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
 )
 
+// IsPVCBound returns whether the PVC is bound to a volume.
+func IsPVCBound(pvc *corev1api.PersistentVolumeClaim) bool {
+	return pvc.Spec.VolumeName != "" && pvc.Status.Phase == corev1api.ClaimBound
+}
+
 func GetPVForPVC(pvc *corev1api.PersistentVolumeClaim, corev1 corev1client.PersistentVolumesGetter) (*corev1api.PersistentVolume, error) {
 	if pvc.Spec.VolumeName == "" {
 		return nil, errors.Errorf("PVC %s/%s has no volume backing this claim", pvc.Namespace, pvc.Name)
@@ -92,6 +98,29 @@ func GetPodVolumeNameForPVC(pod corev1api.Pod, pvcName string) (string, error) {
 	return "", errors.Errorf("Pod %s/%s does not use PVC %s/%s", pod.Namespace, pod.Name, pod.Namespace, pvcName)
 }
 
+// GetStorageClassOrDefault returns the storage class of the name, or the default storage class of the cluster when the
+// name is empty. nil is returned when the name is empty and the cluster has no default storage class.
+func GetStorageClassOrDefault(name string, storagev1 storagev1client.StorageClassesGetter) (*storagev1api.StorageClass, error) {
+	if name != "" {
+		storageClass, err := storagev1.StorageClasses().Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting storage class %s", name)
+		}
+		return storageClass, nil
+	}
+
+	storageClasses, err := storagev1.StorageClasses().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing storage classes")
+	}
+	for i := range storageClasses.Items {
+		if storageClasses.Items[i].Annotations[defaultStorageClassAnnotation] == "true" {
+			return &storageClasses.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
 func Contains(slice []string, key string) bool {
 	for _, i := range slice {
 		if i == key {
@@ -122,7 +151,12 @@ func IsPVCDefaultToFSBackup(pvcNamespace, pvcName string, podClient corev1client
 
 	return false, nil
 }
-func GetVolumeSnapshotClass(provisioner string, backup *velerov1api.Backup, pvc *corev1api.PersistentVolumeClaim, log logrus.FieldLogger, snapshotClient snapshotter.SnapshotV1Interface) (*snapshotv1api.VolumeSnapshotClass, error) {
+
+// GetVolumeSnapshotClass returns the VolumeSnapshotClass to snapshot the PVC with. It is chosen, in order, from the PVC annotation,
+// the backup annotation for the driver, the matched VolumeSnapshotClass policy rule if any, the StorageClass annotation if the
+// StorageClass is known, then the label of the classes of the driver.
+func GetVolumeSnapshotClass(provisioner string, backup *velerov1api.Backup, pvc *corev1api.PersistentVolumeClaim, rule *VolumeSnapshotClassRule,
+	storageClass *storagev1api.StorageClass, log logrus.FieldLogger, snapshotClient snapshotter.SnapshotV1Interface) (*snapshotv1api.VolumeSnapshotClass, error) {
 	snapshotClasses, err := snapshotClient.VolumeSnapshotClasses().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		return nil, errors.Wrap(err, "error listing volumesnapshot classes")
@@ -145,8 +179,27 @@ func GetVolumeSnapshotClass(provisioner string, backup *velerov1api.Backup, pvc
 		return snapshotClass, nil
 	}
 
+	// Then use the snapshot class of the matched policy rule
+	snapshotClass, err = GetVolumeSnapshotClassFromPolicyRuleForDriver(rule, provisioner, snapshotClasses)
+	if err != nil {
+		log.Warnf("Ignoring volumesnapshotclass policy rule %s: %v", rule.Name, err)
+	}
+	if snapshotClass != nil {
+		return snapshotClass, nil
+	}
+
+	// Then use the snapshot class named in the storage class annotations
+	snapshotClass, err = GetVolumeSnapshotClassFromStorageClassAnnotationsForDriver(storageClass, provisioner, snapshotClasses)
+	if err != nil {
+		log.Warnf("Didn't find VolumeSnapshotClass from StorageClass annotations: %v", err)
+	}
+	if snapshotClass != nil {
+		return snapshotClass, nil
+	}
+
 	// fallback to default behaviour of fetching snapshot class based on label
-	snapshotClass, err = GetVolumeSnapshotClassForStorageClass(provisioner, snapshotClasses)
+	failOnAmbiguity := backup.Annotations[VolumeSnapshotClassAmbiguityBackupAnnotation] == VolumeSnapshotClassAmbiguityFail
+	snapshotClass, err = GetVolumeSnapshotClassForStorageClass(provisioner, snapshotClasses, failOnAmbiguity, log)
 	if err != nil || snapshotClass == nil {
 		return nil, errors.Wrap(err, "error getting volumesnapshotclass")
 	}
@@ -189,33 +242,127 @@ func GetVolumeSnapshotClassFromBackupAnnotationsForDriver(backup *velerov1api.Ba
 	return nil, errors.Errorf("No CSI VolumeSnapshotClass found with name %s for driver %s for backup %s", snapshotClassName, provisioner, backup.Name)
 }
 
+// GetVolumeSnapshotClassFromStorageClassAnnotationsForDriver returns the VolumeSnapshotClass named in the annotation of the StorageClass,
+// which must be for the supplied driver name.
+func GetVolumeSnapshotClassFromStorageClassAnnotationsForDriver(storageClass *storagev1api.StorageClass, provisioner string, snapshotClasses *snapshotv1api.VolumeSnapshotClassList) (*snapshotv1api.VolumeSnapshotClass, error) {
+	if storageClass == nil {
+		return nil, nil
+	}
+	snapshotClassName, ok := storageClass.Annotations[VolumeSnapshotClassStorageClassAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	for _, sc := range snapshotClasses.Items {
+		if strings.EqualFold(snapshotClassName, sc.ObjectMeta.Name) {
+			if !strings.EqualFold(sc.Driver, provisioner) {
+				return nil, errors.Errorf("Incorrect volumesnapshotclass, snapshot class %s is not for driver %s for storage class %s", sc.ObjectMeta.Name, provisioner, storageClass.Name)
+			}
+			return &sc, nil
+		}
+	}
+	return nil, errors.Errorf("No CSI VolumeSnapshotClass found with name %s for driver %s for storage class %s", snapshotClassName, provisioner, storageClass.Name)
+}
+
+// GetVolumeSnapshotClassFromPolicyRuleForDriver returns the VolumeSnapshotClass named by the VolumeSnapshotClass policy rule,
+// which must be for the supplied driver name.
+func GetVolumeSnapshotClassFromPolicyRuleForDriver(rule *VolumeSnapshotClassRule, provisioner string, snapshotClasses *snapshotv1api.VolumeSnapshotClassList) (*snapshotv1api.VolumeSnapshotClass, error) {
+	if rule == nil {
+		return nil, nil
+	}
+	for _, sc := range snapshotClasses.Items {
+		if strings.EqualFold(rule.VolumeSnapshotClass, sc.ObjectMeta.Name) {
+			if !strings.EqualFold(sc.Driver, provisioner) {
+				return nil, errors.Errorf("Incorrect volumesnapshotclass, snapshot class %s is not for driver %s", sc.ObjectMeta.Name, provisioner)
+			}
+			return &sc, nil
+		}
+	}
+	return nil, errors.Errorf("No CSI VolumeSnapshotClass found with name %s for driver %s", rule.VolumeSnapshotClass, provisioner)
+}
+
 // GetVolumeSnapshotClassForStorageClass returns a VolumeSnapshotClass for the supplied volume provisioner/ driver name.
-func GetVolumeSnapshotClassForStorageClass(provisioner string, snapshotClasses *snapshotv1api.VolumeSnapshotClassList) (*snapshotv1api.VolumeSnapshotClass, error) {
-	n := 0
-	var vsclass snapshotv1api.VolumeSnapshotClass
+// When several classes of the driver have the 'velero.io/csi-volumesnapshot-class' label, the one with the highest priority
+// is chosen. Remaining ties are resolved by name with a warning, or fail if failOnAmbiguity is set.
+func GetVolumeSnapshotClassForStorageClass(provisioner string, snapshotClasses *snapshotv1api.VolumeSnapshotClassList,
+	failOnAmbiguity bool, log logrus.FieldLogger) (*snapshotv1api.VolumeSnapshotClass, error) {
+	var driverClasses, labeledClasses []snapshotv1api.VolumeSnapshotClass
 	// We pick the volumesnapshotclass that matches the CSI driver name and has a 'velero.io/csi-volumesnapshot-class'
 	// label. This allows multiple VolumesnapshotClasses for the same driver with different values for the
 	// other fields in the spec.
 	// https://github.com/kubernetes-csi/external-snapshotter/blob/release-4.2/client/config/crd/snapshot.storage.k8s.io_volumesnapshotclasses.yaml
 	for _, sc := range snapshotClasses.Items {
-		_, hasLabelSelector := sc.Labels[VolumeSnapshotClassSelectorLabel]
-		if sc.Driver == provisioner {
-			n += 1
-			vsclass = sc
-			if hasLabelSelector {
-				return &sc, nil
-			}
+		if sc.Driver != provisioner {
+			continue
+		}
+		driverClasses = append(driverClasses, sc)
+		if _, hasLabelSelector := sc.Labels[VolumeSnapshotClassSelectorLabel]; hasLabelSelector {
+			labeledClasses = append(labeledClasses, sc)
 		}
 	}
-	// If there's only one volumesnapshotclass for the driver, return it.
-	if n == 1 {
-		return &vsclass, nil
+
+	switch {
+	case len(labeledClasses) == 1:
+		return &labeledClasses[0], nil
+	case len(labeledClasses) > 1:
+		return resolveLabeledVolumeSnapshotClasses(provisioner, labeledClasses, failOnAmbiguity, log)
+	case len(driverClasses) == 1:
+		// If there's only one volumesnapshotclass for the driver, return it.
+		return &driverClasses[0], nil
 	}
 	return nil, errors.Errorf("failed to get volumesnapshotclass for provisioner %s, ensure that the desired volumesnapshot class has the %s label", provisioner, VolumeSnapshotClassSelectorLabel)
 }
 
+// resolveLabeledVolumeSnapshotClasses chooses among several labeled classes of the driver the one with the highest priority.
+func resolveLabeledVolumeSnapshotClasses(provisioner string, classes []snapshotv1api.VolumeSnapshotClass,
+	failOnAmbiguity bool, log logrus.FieldLogger) (*snapshotv1api.VolumeSnapshotClass, error) {
+	// sort by decreasing priority then by name, so the same class is chosen from one backup to the next
+	sort.SliceStable(classes, func(i, j int) bool {
+		pi, pj := getVolumeSnapshotClassPriority(&classes[i]), getVolumeSnapshotClassPriority(&classes[j])
+		if pi != pj {
+			return pi > pj
+		}
+		return classes[i].Name < classes[j].Name
+	})
+
+	candidates := make([]string, 0, len(classes))
+	for i := range classes {
+		candidates = append(candidates, fmt.Sprintf("%s(priority=%d)", classes[i].Name, getVolumeSnapshotClassPriority(&classes[i])))
+	}
+
+	chosen := &classes[0]
+	if getVolumeSnapshotClassPriority(chosen) > getVolumeSnapshotClassPriority(&classes[1]) {
+		log.Infof("Chose volumesnapshotclass %s by priority among the classes labeled %s for driver %s: %v",
+			chosen.Name, VolumeSnapshotClassSelectorLabel, provisioner, candidates)
+		return chosen, nil
+	}
+
+	if failOnAmbiguity {
+		return nil, errors.Errorf("ambiguous volumesnapshotclass for provisioner %s, several classes with the %s label have the highest priority: %v. Set the %s annotation to prioritize one",
+			provisioner, VolumeSnapshotClassSelectorLabel, candidates, VolumeSnapshotClassPriorityAnnotation)
+	}
+	log.Warnf("Ambiguous volumesnapshotclass for driver %s, several classes with the %s label have the highest priority: %v. Chose %s by name, set the %s annotation to prioritize one",
+		provisioner, VolumeSnapshotClassSelectorLabel, candidates, chosen.Name, VolumeSnapshotClassPriorityAnnotation)
+	return chosen, nil
+}
+
+// getVolumeSnapshotClassPriority returns the priority of the class from its priority annotation,
+// else from the value of its 'velero.io/csi-volumesnapshot-class' label if it is an integer, else 0.
+func getVolumeSnapshotClassPriority(class *snapshotv1api.VolumeSnapshotClass) int {
+	if value, ok := class.Annotations[VolumeSnapshotClassPriorityAnnotation]; ok {
+		if priority, err := strconv.Atoi(value); err == nil {
+			return priority
+		}
+	}
+	if priority, err := strconv.Atoi(class.Labels[VolumeSnapshotClassSelectorLabel]); err == nil {
+		return priority
+	}
+	return 0
+}
+
 // GetVolumeSnapshotContentForVolumeSnapshot returns the volumesnapshotcontent object associated with the volumesnapshot
-func GetVolumeSnapshotContentForVolumeSnapshot(volSnap *snapshotv1api.VolumeSnapshot, snapshotClient snapshotter.SnapshotV1Interface, log logrus.FieldLogger, shouldWait bool, csiSnapshotTimeout time.Duration) (*snapshotv1api.VolumeSnapshotContent, error) {
+// When waiting, the errors of the volumesnapshotcontent are classified by the classifier, and a fatal error ends the wait.
+func GetVolumeSnapshotContentForVolumeSnapshot(volSnap *snapshotv1api.VolumeSnapshot, snapshotClient snapshotter.SnapshotV1Interface, classifier *SnapshotErrorClassifier,
+	log logrus.FieldLogger, shouldWait bool, csiSnapshotTimeout time.Duration) (*snapshotv1api.VolumeSnapshotContent, error) {
 	if !shouldWait {
 		if volSnap.Status == nil || volSnap.Status.BoundVolumeSnapshotContentName == nil {
 			// volumesnapshot hasn't been reconciled and we're not waiting for it.
@@ -228,47 +375,19 @@ func GetVolumeSnapshotContentForVolumeSnapshot(volSnap *snapshotv1api.VolumeSnap
 		return vsc, nil
 	}
 
-	// We'll wait 10m for the VSC to be reconciled polling every 5s unless csiSnapshotTimeout is set
+	// We'll wait 10m for the VSC to be reconciled unless csiSnapshotTimeout is set. The volumesnapshots and
+	// volumesnapshotcontents are watched by informers shared by the concurrent waits.
 	timeout := defaultCSISnapshotTimeout
 	if csiSnapshotTimeout > 0 {
 		timeout = csiSnapshotTimeout
 	}
-	interval := 5 * time.Second
-	var snapshotContent *snapshotv1api.VolumeSnapshotContent
-
-	err := wait.PollUntilContextTimeout(context.Background(), interval, timeout, true, func(ctx context.Context) (bool, error) {
-		vs, err := snapshotClient.VolumeSnapshots(volSnap.Namespace).Get(ctx, volSnap.Name, metav1.GetOptions{})
-		if err != nil {
-			return false, errors.Wrapf(err, fmt.Sprintf("failed to get volumesnapshot %s/%s", volSnap.Namespace, volSnap.Name))
-		}
-
-		if vs.Status == nil || vs.Status.BoundVolumeSnapshotContentName == nil {
-			log.Infof("Waiting for CSI driver to reconcile volumesnapshot %s/%s. Retrying in %ds", volSnap.Namespace, volSnap.Name, interval/time.Second)
-			return false, nil
-		}
-
-		snapshotContent, err = snapshotClient.VolumeSnapshotContents().Get(ctx, *vs.Status.BoundVolumeSnapshotContentName, metav1.GetOptions{})
-		if err != nil {
-			return false, errors.Wrapf(err, fmt.Sprintf("failed to get volumesnapshotcontent %s for volumesnapshot %s/%s", *vs.Status.BoundVolumeSnapshotContentName, vs.Namespace, vs.Name))
-		}
-
-		// we need to wait for the VolumeSnaphotContent to have a snapshot handle because during restore,
-		// we'll use that snapshot handle as the source for the VolumeSnapshotContent so it's statically
-		// bound to the existing snapshot.
-		if snapshotContent.Status == nil || snapshotContent.Status.SnapshotHandle == nil {
-			log.Infof("Waiting for volumesnapshotcontents %s to have snapshot handle. Retrying in %ds", snapshotContent.Name, interval/time.Second)
-			if snapshotContent.Status != nil && snapshotContent.Status.Error != nil {
-				log.Warnf("Volumesnapshotcontent %s has error: %v", snapshotContent.Name, *snapshotContent.Status.Error.Message)
-			}
-			return false, nil
-		}
-
-		return true, nil
-	})
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
+	snapshotContent, err := getSnapshotWaiter(snapshotClient).waitForSnapshotHandle(ctx, volSnap, classifier, log)
 	if err != nil {
-		if err == wait.ErrorInterrupted(errors.New("timed out waiting for the condition")) {
-			if snapshotContent != nil && snapshotContent.Status != nil && snapshotContent.Status.Error != nil {
+		if wait.Interrupted(err) {
+			if snapshotContent != nil && snapshotContent.Status != nil && snapshotContent.Status.Error != nil && snapshotContent.Status.Error.Message != nil {
 				log.Errorf("Timed out awaiting reconciliation of volumesnapshot, Volumesnapshotcontent %s has error: %v", snapshotContent.Name, *snapshotContent.Status.Error.Message)
 				return nil, errors.Errorf("CSI got timed out with error: %v", *snapshotContent.Status.Error.Message)
 			} else {
@@ -281,49 +400,6 @@ func GetVolumeSnapshotContentForVolumeSnapshot(volSnap *snapshotv1api.VolumeSnap
 	return snapshotContent, nil
 }
 
-func GetClients() (*kubernetes.Clientset, snapshotterClientSet.Interface, error) {
-	client, snapshotterClient, _, err := GetFullClients()
-
-	return client, snapshotterClient, err
-}
-
-func GetFullClients() (*kubernetes.Clientset, snapshotterClientSet.Interface, crclient.Client, error) {
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-	clientConfig, err := kubeConfig.ClientConfig()
-	if err != nil {
-		return nil, nil, nil, errors.WithStack(err)
-	}
-
-	client, err := kubernetes.NewForConfig(clientConfig)
-	if err != nil {
-		return nil, nil, nil, errors.WithStack(err)
-	}
-
-	snapshotterClient, err := snapshotterClientSet.NewForConfig(clientConfig)
-	if err != nil {
-		return nil, nil, nil, errors.WithStack(err)
-	}
-
-	scheme := runtime.NewScheme()
-	if err := velerov1api.AddToScheme(scheme); err != nil {
-		return nil, nil, nil, errors.WithStack(err)
-	}
-	if err := velerov2alpha1api.AddToScheme(scheme); err != nil {
-		return nil, nil, nil, errors.WithStack(err)
-	}
-
-	crClient, err := crclient.New(clientConfig, crclient.Options{
-		Scheme: scheme,
-	})
-	if err != nil {
-		return nil, nil, nil, errors.WithStack(err)
-	}
-
-	return client, snapshotterClient, crClient, nil
-}
-
 // IsVolumeSnapshotClassHasListerSecret returns whether a volumesnapshotclass has a snapshotlister secret
 func IsVolumeSnapshotClassHasListerSecret(vc *snapshotv1api.VolumeSnapshotClass) bool {
 	// https://github.com/kubernetes-csi/external-snapshotter/blob/master/pkg/utils/util.go#L59-L60
@@ -461,6 +537,17 @@ func DeleteVolumeSnapshot(vs snapshotv1api.VolumeSnapshot, vsc snapshotv1api.Vol
 	}
 }
 
+// GetResourceTimeout reads the resource timeout from the backup annotation, if not set, the default value is returned.
+func GetResourceTimeout(backup *velerov1api.Backup, log logrus.FieldLogger) time.Duration {
+	timeout, err := time.ParseDuration(backup.Annotations[ResourceTimeoutAnnotation])
+	if err != nil {
+		log.Warnf("fail to parse resource timeout annotation %s: %s", backup.Annotations[ResourceTimeoutAnnotation], err.Error())
+		timeout = 10 * time.Minute
+	}
+	log.Debugf("resource timeout is set to %s", timeout.String())
+	return timeout
+}
+
 // recreateVolumeSnapshotContent will delete then re-create VolumeSnapshotContent,
 // because some parameter in VolumeSnapshotContent Spec is immutable, e.g. VolumeSnapshotRef
 // and Source. Source is updated to let csi-controller thinks the VSC is statically provsisioned with VS.
@@ -468,16 +555,10 @@ func DeleteVolumeSnapshot(vs snapshotv1api.VolumeSnapshot, vsc snapshotv1api.Vol
 // VSC can be deleted.
 func recreateVolumeSnapshotContent(vsc snapshotv1api.VolumeSnapshotContent, backup *velerov1api.Backup,
 	snapshotClient snapshotter.SnapshotV1Interface, log logrus.FieldLogger) error {
-	// Read resource timeout from backup annotation, if not set, use default value.
-	timeout, err := time.ParseDuration(backup.Annotations[ResourceTimeoutAnnotation])
-	if err != nil {
-		log.Warnf("fail to parse resource timeout annotation %s: %s", backup.Annotations[ResourceTimeoutAnnotation], err.Error())
-		timeout = 10 * time.Minute
-	}
-	log.Debugf("resource timeout is set to %s", timeout.String())
+	timeout := GetResourceTimeout(backup, log)
 	interval := 1 * time.Second
 
-	err = snapshotClient.VolumeSnapshotContents().Delete(context.TODO(), vsc.Name, metav1.DeleteOptions{})
+	err := snapshotClient.VolumeSnapshotContents().Delete(context.TODO(), vsc.Name, metav1.DeleteOptions{})
 	if err != nil {
 		return errors.Wrapf(err, "fail to delete VolumeSnapshotContent: %s", vsc.Name)
 	}
@@ -27,6 +27,7 @@ import (
 	"github.com/stretchr/testify/require"
 	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	v1 "k8s.io/api/core/v1"
+	storagev1api "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
@@ -747,12 +748,14 @@ func TestGetVolumeSnapshotClass(t *testing.T) {
 	fakeClient := snapshotFake.NewSimpleClientset(objs...)
 
 	testCases := []struct {
-		name        string
-		driverName  string
-		pvc         *v1.PersistentVolumeClaim
-		backup      *velerov1api.Backup
-		expectedVSC *snapshotv1api.VolumeSnapshotClass
-		expectError bool
+		name         string
+		driverName   string
+		pvc          *v1.PersistentVolumeClaim
+		backup       *velerov1api.Backup
+		rule         *VolumeSnapshotClassRule
+		storageClass *storagev1api.StorageClass
+		expectedVSC  *snapshotv1api.VolumeSnapshotClass
+		expectError  bool
 	}{
 		{
 			name:        "no annotations on pvc and backup, should find hostpath volumesnapshotclass using default behaviour of labels",
@@ -810,6 +813,54 @@ func TestGetVolumeSnapshotClass(t *testing.T) {
 			expectedVSC: nil,
 			expectError: true,
 		},
+		{
+			name:        "no annotations on pvc and backup, use VSC of policy rule",
+			driverName:  "foo.csi.k8s.io",
+			pvc:         pvcNone,
+			backup:      backupNone,
+			rule:        &VolumeSnapshotClassRule{Name: "foo", VolumeSnapshotClass: "foowithoutlabel"},
+			expectedVSC: fooClassWithoutLabel,
+		},
+		{
+			name:        "VSC annotations on backup take precedence over policy rule",
+			driverName:  "bar.csi.k8s.io",
+			pvc:         pvcNone,
+			backup:      backupBar2,
+			rule:        &VolumeSnapshotClassRule{Name: "bar", VolumeSnapshotClass: "bar"},
+			expectedVSC: barClass2,
+		},
+		{
+			name:        "VSC of policy rule is for another driver, fallback to default behaviour of labels",
+			driverName:  "bar.csi.k8s.io",
+			pvc:         pvcNone,
+			backup:      backupNone,
+			rule:        &VolumeSnapshotClassRule{Name: "foo", VolumeSnapshotClass: "foowithoutlabel"},
+			expectedVSC: barClass,
+		},
+		{
+			name:         "VSC annotation on storage class",
+			driverName:   "foo.csi.k8s.io",
+			pvc:          pvcNone,
+			backup:       backupNone,
+			storageClass: builder.ForStorageClass("sc").ObjectMeta(builder.WithAnnotations(VolumeSnapshotClassStorageClassAnnotation, "foowithoutlabel")).Result(),
+			expectedVSC:  fooClassWithoutLabel,
+		},
+		{
+			name:         "VSC annotation on backup takes precedence over storage class annotation",
+			driverName:   "bar.csi.k8s.io",
+			pvc:          pvcNone,
+			backup:       backupBar2,
+			storageClass: builder.ForStorageClass("sc").ObjectMeta(builder.WithAnnotations(VolumeSnapshotClassStorageClassAnnotation, "bar")).Result(),
+			expectedVSC:  barClass2,
+		},
+		{
+			name:         "VSC annotation on storage class is for another driver, fallback to default behaviour of labels",
+			driverName:   "foo.csi.k8s.io",
+			pvc:          pvcNone,
+			backup:       backupNone,
+			storageClass: builder.ForStorageClass("sc").ObjectMeta(builder.WithAnnotations(VolumeSnapshotClassStorageClassAnnotation, "bar")).Result(),
+			expectedVSC:  fooClass,
+		},
 		{
 			name:        "foo2 VSC annotations on pvc, but doesn't exist in cluster, fallback to default behaviour of labels",
 			driverName:  "foo.csi.k8s.io",
@@ -821,7 +872,7 @@ func TestGetVolumeSnapshotClass(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			actualSnapshotClass, actualError := GetVolumeSnapshotClass(tc.driverName, tc.backup, tc.pvc, logrus.New(), fakeClient.SnapshotV1())
+			actualSnapshotClass, actualError := GetVolumeSnapshotClass(tc.driverName, tc.backup, tc.pvc, tc.rule, tc.storageClass, logrus.New(), fakeClient.SnapshotV1())
 			if tc.expectError {
 				assert.NotNil(t, actualError)
 				assert.Nil(t, actualSnapshotClass)
@@ -883,16 +934,59 @@ func TestGetVolumeSnapshotClassForStorageClass(t *testing.T) {
 		Driver: "amb.csi.k8s.io",
 	}
 
+	labeledClass2 := &snapshotv1api.VolumeSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "labeled2",
+			Labels: map[string]string{VolumeSnapshotClassSelectorLabel: "true"},
+		},
+		Driver: "labeled.csi.k8s.io",
+	}
+
+	labeledClass1 := &snapshotv1api.VolumeSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "labeled1",
+			Labels: map[string]string{VolumeSnapshotClassSelectorLabel: "true"},
+		},
+		Driver: "labeled.csi.k8s.io",
+	}
+
+	priorityLabelClass := &snapshotv1api.VolumeSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "b-priority-label",
+			Labels: map[string]string{VolumeSnapshotClassSelectorLabel: "10"},
+		},
+		Driver: "priority.csi.k8s.io",
+	}
+
+	priorityAnnotationClass := &snapshotv1api.VolumeSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "c-priority-annotation",
+			Labels:      map[string]string{VolumeSnapshotClassSelectorLabel: "true"},
+			Annotations: map[string]string{VolumeSnapshotClassPriorityAnnotation: "20"},
+		},
+		Driver: "priority.csi.k8s.io",
+	}
+
+	noPriorityClass := &snapshotv1api.VolumeSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "a-no-priority",
+			Labels: map[string]string{VolumeSnapshotClassSelectorLabel: "true"},
+		},
+		Driver: "priority.csi.k8s.io",
+	}
+
 	snapshotClasses := &snapshotv1api.VolumeSnapshotClassList{
 		Items: []snapshotv1api.VolumeSnapshotClass{
-			*hostpathClass, *fooClass, *barClass, *bazClass, *ambClass1, *ambClass2},
+			*hostpathClass, *fooClass, *barClass, *bazClass, *ambClass1, *ambClass2,
+			*labeledClass2, *labeledClass1, *noPriorityClass, *priorityLabelClass, *priorityAnnotationClass},
 	}
 
 	testCases := []struct {
-		name        string
-		driverName  string
-		expectedVSC *snapshotv1api.VolumeSnapshotClass
-		expectError bool
+		name            string
+		driverName      string
+		failOnAmbiguity bool
+		expectedVSC     *snapshotv1api.VolumeSnapshotClass
+		expectError     bool
 	}{
 		{
 			name:        "should find hostpath volumesnapshotclass",
@@ -924,6 +1018,23 @@ func TestGetVolumeSnapshotClassForStorageClass(t *testing.T) {
 			expectedVSC: nil,
 			expectError: true,
 		},
+		{
+			name:        "should find labeled1 volumesnapshotclass by name, b/c several labeled vsclasses have the same priority",
+			driverName:  "labeled.csi.k8s.io",
+			expectedVSC: labeledClass1,
+		},
+		{
+			name:            "should not find labeled volumesnapshotclass when failing on ambiguity, b/c several labeled vsclasses have the same priority",
+			driverName:      "labeled.csi.k8s.io",
+			failOnAmbiguity: true,
+			expectError:     true,
+		},
+		{
+			name:            "should find volumesnapshotclass with the highest priority annotation, over label value priority",
+			driverName:      "priority.csi.k8s.io",
+			failOnAmbiguity: true,
+			expectedVSC:     priorityAnnotationClass,
+		},
 		{
 			name:        "should not find does-not-exist volumesnapshotclass",
 			driverName:  "not-found.csi.k8s.io",
@@ -934,7 +1045,7 @@ func TestGetVolumeSnapshotClassForStorageClass(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			actualVSC, actualError := GetVolumeSnapshotClassForStorageClass(tc.driverName, snapshotClasses)
+			actualVSC, actualError := GetVolumeSnapshotClassForStorageClass(tc.driverName, snapshotClasses, tc.failOnAmbiguity, logrus.New())
 
 			if tc.expectError {
 				assert.NotNil(t, actualError)
@@ -1128,7 +1239,7 @@ func TestGetVolumeSnapshotContentForVolumeSnapshot(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			actualVSC, actualError := GetVolumeSnapshotContentForVolumeSnapshot(tc.volSnap, fakeClient.SnapshotV1(), logrus.New().WithField("fake", "test"), tc.wait, 0)
+			actualVSC, actualError := GetVolumeSnapshotContentForVolumeSnapshot(tc.volSnap, fakeClient.SnapshotV1(), nil, logrus.New().WithField("fake", "test"), tc.wait, 0)
 			if tc.expectError && actualError == nil {
 				assert.NotNil(t, actualError)
 				assert.Nil(t, actualVSC)
@@ -0,0 +1,260 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	groupsnapshotv1alpha1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumegroupsnapshot/v1alpha1"
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotterClientSet "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned"
+	groupsnapshotter "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/typed/volumegroupsnapshot/v1alpha1"
+	snapshotter "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/typed/volumesnapshot/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1api "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/label"
+)
+
+// GetVolumeGroupLabelKey returns the PVC label key used to group PVCs into VolumeGroupSnapshots
+// for the backup. The backup annotation takes precedence over the default label.
+func GetVolumeGroupLabelKey(backup *velerov1api.Backup) string {
+	if key, ok := backup.Annotations[VolumeGroupLabelKeyBackupAnnotation]; ok && len(strings.TrimSpace(key)) > 0 {
+		return strings.TrimSpace(key)
+	}
+	return VolumeGroupLabel
+}
+
+// GetVolumeGroupName returns the name of the volume group the PVC belongs to for the backup, if any.
+func GetVolumeGroupName(pvc *corev1api.PersistentVolumeClaim, backup *velerov1api.Backup) (string, bool) {
+	groupName, ok := pvc.Labels[GetVolumeGroupLabelKey(backup)]
+	if !ok || groupName == "" {
+		return "", false
+	}
+	return groupName, true
+}
+
+// GetVolumeGroupMemberSelector returns the selector of the PVCs of the volume group in the scope of the backup: the PVCs
+// of the group which match the label selector of the backup and are not excluded from backups. The PVCs selected by
+// the orLabelSelectors of a backup can't be expressed by the single selector of a VolumeGroupSnapshot.
+func GetVolumeGroupMemberSelector(backup *velerov1api.Backup, groupName string) (*metav1.LabelSelector, error) {
+	if len(backup.Spec.OrLabelSelectors) > 0 {
+		return nil, errors.Errorf("volume group %s can't be snapshotted together by backup %s, which selects resources with orLabelSelectors", groupName, backup.Name)
+	}
+
+	labelKey := GetVolumeGroupLabelKey(backup)
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{labelKey: groupName}}
+	if backup.Spec.LabelSelector != nil {
+		for k, v := range backup.Spec.LabelSelector.MatchLabels {
+			if k != labelKey {
+				selector.MatchLabels[k] = v
+			}
+		}
+		selector.MatchExpressions = append(selector.MatchExpressions, backup.Spec.LabelSelector.MatchExpressions...)
+	}
+	selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      ExcludeFromBackupLabel,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{"true"},
+	})
+	return selector, nil
+}
+
+// GetVolumeGroupSnapshotName returns the name of the VolumeGroupSnapshot taking the snapshots of a volume group
+// for the backup. The name is deterministic, so all the PVCs of the group share the same VolumeGroupSnapshot.
+func GetVolumeGroupSnapshotName(backup *velerov1api.Backup, groupName string) string {
+	name := strings.ToLower(strings.ReplaceAll(fmt.Sprintf("velero-%s-%s", backup.Name, groupName), "_", "-"))
+	return label.GetValidName(name)
+}
+
+// GetVolumeGroupSnapshotClass returns the VolumeGroupSnapshotClass to use for the supplied CSI driver.
+// A class named in the backup annotations for the driver is preferred, then the class carrying the
+// 'velero.io/csi-volumegroupsnapshot-class' label, then the only class for the driver.
+func GetVolumeGroupSnapshotClass(driver string, backup *velerov1api.Backup, log logrus.FieldLogger,
+	groupSnapshotClient groupsnapshotter.GroupsnapshotV1alpha1Interface) (*groupsnapshotv1alpha1api.VolumeGroupSnapshotClass, error) {
+	classes, err := groupSnapshotClient.VolumeGroupSnapshotClasses().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing volumegroupsnapshot classes")
+	}
+
+	annotationKey := fmt.Sprintf("%s_%s", VolumeGroupSnapshotClassDriverBackupAnnotationPrefix, strings.ToLower(driver))
+	if className, ok := backup.Annotations[annotationKey]; ok {
+		for _, c := range classes.Items {
+			if strings.EqualFold(className, c.Name) {
+				if !strings.EqualFold(c.Driver, driver) {
+					return nil, errors.Errorf("Incorrect volumegroupsnapshotclass, class %s is not for driver %s for backup %s", c.Name, driver, backup.Name)
+				}
+				return &c, nil
+			}
+		}
+		log.Debugf("Didn't find VolumeGroupSnapshotClass %s from Backup annotations", className)
+	}
+
+	n := 0
+	var class groupsnapshotv1alpha1api.VolumeGroupSnapshotClass
+	for _, c := range classes.Items {
+		if c.Driver != driver {
+			continue
+		}
+		if _, hasLabelSelector := c.Labels[VolumeGroupSnapshotClassSelectorLabel]; hasLabelSelector {
+			return &c, nil
+		}
+		n += 1
+		class = c
+	}
+	if n == 1 {
+		return &class, nil
+	}
+	return nil, errors.Errorf("failed to get volumegroupsnapshotclass for driver %s, ensure that the desired volumegroupsnapshot class has the %s label", driver, VolumeGroupSnapshotClassSelectorLabel)
+}
+
+// WaitVolumeGroupSnapshotMembers waits for the VolumeGroupSnapshot to be reconciled by the CSI driver
+// and returns it once the member VolumeSnapshots are listed in its status.
+func WaitVolumeGroupSnapshotMembers(vgs *groupsnapshotv1alpha1api.VolumeGroupSnapshot, groupSnapshotClient groupsnapshotter.GroupsnapshotV1alpha1Interface,
+	log logrus.FieldLogger, csiSnapshotTimeout time.Duration) (*groupsnapshotv1alpha1api.VolumeGroupSnapshot, error) {
+	timeout := defaultCSISnapshotTimeout
+	if csiSnapshotTimeout > 0 {
+		timeout = csiSnapshotTimeout
+	}
+	interval := 5 * time.Second
+	var updated *groupsnapshotv1alpha1api.VolumeGroupSnapshot
+
+	err := wait.PollUntilContextTimeout(context.Background(), interval, timeout, true, func(ctx context.Context) (bool, error) {
+		var err error
+		updated, err = groupSnapshotClient.VolumeGroupSnapshots(vgs.Namespace).Get(ctx, vgs.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, errors.Wrapf(err, fmt.Sprintf("failed to get volumegroupsnapshot %s/%s", vgs.Namespace, vgs.Name))
+		}
+
+		if updated.Status == nil || len(updated.Status.VolumeSnapshotRefList) == 0 {
+			log.Infof("Waiting for CSI driver to reconcile volumegroupsnapshot %s/%s. Retrying in %ds", vgs.Namespace, vgs.Name, interval/time.Second)
+			if updated.Status != nil && updated.Status.Error != nil && updated.Status.Error.Message != nil {
+				log.Warnf("Volumegroupsnapshot %s/%s has error: %v", vgs.Namespace, vgs.Name, *updated.Status.Error.Message)
+			}
+			return false, nil
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) && updated != nil && updated.Status != nil && updated.Status.Error != nil && updated.Status.Error.Message != nil {
+			return nil, errors.Errorf("CSI got timed out with error: %v", *updated.Status.Error.Message)
+		}
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// GetVolumeSnapshotForPVCInGroup returns the member VolumeSnapshot of the VolumeGroupSnapshot taken for the PVC.
+// A member is matched either by its PVC source or by the volume handle recorded on its VolumeSnapshotContent.
+func GetVolumeSnapshotForPVCInGroup(vgs *groupsnapshotv1alpha1api.VolumeGroupSnapshot, pvc *corev1api.PersistentVolumeClaim, pv *corev1api.PersistentVolume,
+	snapshotClient snapshotter.SnapshotV1Interface) (*snapshotv1api.VolumeSnapshot, error) {
+	if vgs.Status == nil {
+		return nil, errors.Errorf("volumegroupsnapshot %s/%s has no status", vgs.Namespace, vgs.Name)
+	}
+
+	csiSource, err := GetCSIPersistentVolumeSource(pv)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range vgs.Status.VolumeSnapshotRefList {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = vgs.Namespace
+		}
+		vs, err := snapshotClient.VolumeSnapshots(namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get member volumesnapshot %s/%s of volumegroupsnapshot %s/%s", namespace, ref.Name, vgs.Namespace, vgs.Name)
+		}
+
+		if vs.Spec.Source.PersistentVolumeClaimName != nil && *vs.Spec.Source.PersistentVolumeClaimName == pvc.Name {
+			return vs, nil
+		}
+
+		if csiSource == nil || vs.Status == nil || vs.Status.BoundVolumeSnapshotContentName == nil {
+			continue
+		}
+		vsc, err := snapshotClient.VolumeSnapshotContents().Get(context.TODO(), *vs.Status.BoundVolumeSnapshotContentName, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get volumesnapshotcontent %s for volumesnapshot %s/%s", *vs.Status.BoundVolumeSnapshotContentName, vs.Namespace, vs.Name)
+		}
+		if vsc.Spec.Source.VolumeHandle != nil && *vsc.Spec.Source.VolumeHandle == csiSource.VolumeHandle {
+			return vs, nil
+		}
+	}
+
+	return nil, errors.Errorf("no member volumesnapshot found for PVC %s/%s in volumegroupsnapshot %s/%s", pvc.Namespace, pvc.Name, vgs.Namespace, vgs.Name)
+}
+
+// CleanupVolumeGroupSnapshot deletes the VolumeGroupSnapshot once none of its member VolumeSnapshots is left.
+// The VolumeGroupSnapshotContent is retained before the deletion, because the member snapshots in the storage
+// provider are still referenced by the VolumeSnapshotContents kept for the backup.
+func CleanupVolumeGroupSnapshot(namespace, name string, snapshotClient snapshotterClientSet.Interface, log logrus.FieldLogger) {
+	vsList, err := snapshotClient.SnapshotV1().VolumeSnapshots(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", VolumeGroupSnapshotLabel, name),
+	})
+	if err != nil {
+		log.Debugf("Failed to list member volumesnapshots of volumegroupsnapshot %s/%s: %v", namespace, name, err)
+		return
+	}
+	if len(vsList.Items) > 0 {
+		log.Debugf("Volumegroupsnapshot %s/%s still has %d member volumesnapshots", namespace, name, len(vsList.Items))
+		return
+	}
+
+	vgs, err := snapshotClient.GroupsnapshotV1alpha1().VolumeGroupSnapshots(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Debugf("Failed to get volumegroupsnapshot %s/%s: %v", namespace, name, err)
+		}
+		return
+	}
+
+	var contentName string
+	if vgs.Status != nil && vgs.Status.BoundVolumeGroupSnapshotContentName != nil {
+		contentName = *vgs.Status.BoundVolumeGroupSnapshotContentName
+		pb := []byte(fmt.Sprintf(`{"spec":{"deletionPolicy":"%s"}}`, snapshotv1api.VolumeSnapshotContentRetain))
+		if _, err := snapshotClient.GroupsnapshotV1alpha1().VolumeGroupSnapshotContents().Patch(context.TODO(), contentName,
+			types.MergePatchType, pb, metav1.PatchOptions{}); err != nil {
+			log.Errorf("Failed to patch DeletionPolicy of volumegroupsnapshotcontent %s: %v", contentName, err)
+			return
+		}
+	}
+
+	if err := snapshotClient.GroupsnapshotV1alpha1().VolumeGroupSnapshots(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("Failed to delete volumegroupsnapshot %s/%s: %v", namespace, name, err)
+		return
+	}
+	if contentName != "" {
+		if err := snapshotClient.GroupsnapshotV1alpha1().VolumeGroupSnapshotContents().Delete(context.TODO(), contentName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			log.Errorf("Failed to delete volumegroupsnapshotcontent %s: %v", contentName, err)
+			return
+		}
+	}
+	log.Infof("Deleted volumegroupsnapshot %s/%s", namespace, name)
+}
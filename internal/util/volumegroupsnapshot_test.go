@@ -0,0 +1,309 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"testing"
+
+	groupsnapshotv1alpha1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumegroupsnapshot/v1alpha1"
+	snapshotv1api "github.com/kubernetes-csi/external-snapshotter/client/v7/apis/volumesnapshot/v1"
+	snapshotFake "github.com/kubernetes-csi/external-snapshotter/client/v7/clientset/versioned/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestGetVolumeGroupName(t *testing.T) {
+	testCases := []struct {
+		name          string
+		backup        *velerov1api.Backup
+		pvc           *v1.PersistentVolumeClaim
+		expectedGroup string
+		expectedOK    bool
+	}{
+		{
+			name:   "PVC without group label",
+			backup: builder.ForBackup("velero", "backup").Result(),
+			pvc:    builder.ForPersistentVolumeClaim("ns", "pvc").Result(),
+		},
+		{
+			name:          "PVC with default group label",
+			backup:        builder.ForBackup("velero", "backup").Result(),
+			pvc:           builder.ForPersistentVolumeClaim("ns", "pvc").ObjectMeta(builder.WithLabels(VolumeGroupLabel, "db")).Result(),
+			expectedGroup: "db",
+			expectedOK:    true,
+		},
+		{
+			name:   "backup annotation overrides the default group label",
+			backup: builder.ForBackup("velero", "backup").ObjectMeta(builder.WithAnnotations(VolumeGroupLabelKeyBackupAnnotation, "app")).Result(),
+			pvc:    builder.ForPersistentVolumeClaim("ns", "pvc").ObjectMeta(builder.WithLabels(VolumeGroupLabel, "db")).Result(),
+		},
+		{
+			name:          "PVC with label named by backup annotation",
+			backup:        builder.ForBackup("velero", "backup").ObjectMeta(builder.WithAnnotations(VolumeGroupLabelKeyBackupAnnotation, "app")).Result(),
+			pvc:           builder.ForPersistentVolumeClaim("ns", "pvc").ObjectMeta(builder.WithLabels("app", "postgres")).Result(),
+			expectedGroup: "postgres",
+			expectedOK:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			group, ok := GetVolumeGroupName(tc.pvc, tc.backup)
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expectedGroup, group)
+		})
+	}
+}
+
+func TestGetVolumeGroupMemberSelector(t *testing.T) {
+	testCases := []struct {
+		name        string
+		backup      *velerov1api.Backup
+		matched     map[string]string
+		notMatched  []map[string]string
+		expectedErr string
+	}{
+		{
+			name:       "PVCs of the group not excluded from backups",
+			backup:     builder.ForBackup("velero", "backup").Result(),
+			matched:    map[string]string{VolumeGroupLabel: "db"},
+			notMatched: []map[string]string{{VolumeGroupLabel: "cache"}, {VolumeGroupLabel: "db", ExcludeFromBackupLabel: "true"}},
+		},
+		{
+			name: "PVCs of the group matching the label selector of the backup",
+			backup: builder.ForBackup("velero", "backup").LabelSelector(&metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "postgres"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"scratch"}},
+				},
+			}).Result(),
+			matched: map[string]string{VolumeGroupLabel: "db", "app": "postgres"},
+			notMatched: []map[string]string{
+				{VolumeGroupLabel: "db"},
+				{VolumeGroupLabel: "db", "app": "postgres", "tier": "scratch"},
+			},
+		},
+		{
+			name: "PVCs selected by orLabelSelectors",
+			backup: builder.ForBackup("velero", "backup").OrLabelSelector([]*metav1.LabelSelector{
+				{MatchLabels: map[string]string{"app": "postgres"}},
+			}).Result(),
+			expectedErr: "volume group db can't be snapshotted together by backup backup, which selects resources with orLabelSelectors",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			labelSelector, err := GetVolumeGroupMemberSelector(tc.backup, "db")
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+			require.NoError(t, err)
+			assert.True(t, selector.Matches(labels.Set(tc.matched)))
+			for _, l := range tc.notMatched {
+				assert.False(t, selector.Matches(labels.Set(l)), l)
+			}
+		})
+	}
+}
+
+func TestGetVolumeGroupSnapshotName(t *testing.T) {
+	backup := builder.ForBackup("velero", "backup").Result()
+	assert.Equal(t, "velero-backup-db-data", GetVolumeGroupSnapshotName(backup, "DB_data"))
+
+	longName := GetVolumeGroupSnapshotName(backup, "a-very-long-volume-group-name-which-does-not-fit-in-a-label-value")
+	assert.Len(t, longName, 63)
+	assert.Equal(t, longName, GetVolumeGroupSnapshotName(backup, "a-very-long-volume-group-name-which-does-not-fit-in-a-label-value"))
+}
+
+func TestGetVolumeGroupSnapshotClass(t *testing.T) {
+	labeledClass := &groupsnapshotv1alpha1api.VolumeGroupSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "labeled",
+			Labels: map[string]string{VolumeGroupSnapshotClassSelectorLabel: "true"},
+		},
+		Driver: "foo.csi.k8s.io",
+	}
+	unlabeledClass := &groupsnapshotv1alpha1api.VolumeGroupSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"},
+		Driver:     "foo.csi.k8s.io",
+	}
+	barClass := &groupsnapshotv1alpha1api.VolumeGroupSnapshotClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar"},
+		Driver:     "bar.csi.k8s.io",
+	}
+
+	testCases := []struct {
+		name          string
+		driver        string
+		backup        *velerov1api.Backup
+		expectedClass string
+		expectError   bool
+	}{
+		{
+			name:          "class from backup annotation",
+			driver:        "foo.csi.k8s.io",
+			backup:        builder.ForBackup("velero", "backup").ObjectMeta(builder.WithAnnotations("velero.io/csi-volumegroupsnapshot-class_foo.csi.k8s.io", "unlabeled")).Result(),
+			expectedClass: "unlabeled",
+		},
+		{
+			name:        "class from backup annotation for another driver",
+			driver:      "foo.csi.k8s.io",
+			backup:      builder.ForBackup("velero", "backup").ObjectMeta(builder.WithAnnotations("velero.io/csi-volumegroupsnapshot-class_foo.csi.k8s.io", "bar")).Result(),
+			expectError: true,
+		},
+		{
+			name:          "labeled class",
+			driver:        "foo.csi.k8s.io",
+			backup:        builder.ForBackup("velero", "backup").Result(),
+			expectedClass: "labeled",
+		},
+		{
+			name:          "only class for the driver",
+			driver:        "bar.csi.k8s.io",
+			backup:        builder.ForBackup("velero", "backup").Result(),
+			expectedClass: "bar",
+		},
+		{
+			name:        "no class for the driver",
+			driver:      "baz.csi.k8s.io",
+			backup:      builder.ForBackup("velero", "backup").Result(),
+			expectError: true,
+		},
+	}
+
+	fakeClient := snapshotFake.NewSimpleClientset(labeledClass, unlabeledClass, barClass)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			class, err := GetVolumeGroupSnapshotClass(tc.driver, tc.backup, logrus.New(), fakeClient.GroupsnapshotV1alpha1())
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedClass, class.Name)
+		})
+	}
+}
+
+func TestGetVolumeSnapshotForPVCInGroup(t *testing.T) {
+	vscName := "member-2-content"
+	volumeHandle := "volume-2"
+	objs := []runtime.Object{
+		builder.ForVolumeSnapshot("ns", "member-1").SourcePVC("pvc-1").Result(),
+		builder.ForVolumeSnapshot("ns", "member-2").Status().BoundVolumeSnapshotContentName(vscName).Result(),
+		&snapshotv1api.VolumeSnapshotContent{
+			ObjectMeta: metav1.ObjectMeta{Name: vscName},
+			Spec: snapshotv1api.VolumeSnapshotContentSpec{
+				Source: snapshotv1api.VolumeSnapshotContentSource{VolumeHandle: &volumeHandle},
+			},
+		},
+	}
+	vgs := &groupsnapshotv1alpha1api.VolumeGroupSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "vgs"},
+		Status: &groupsnapshotv1alpha1api.VolumeGroupSnapshotStatus{
+			VolumeSnapshotRefList: []v1.ObjectReference{
+				{Namespace: "ns", Name: "member-1"},
+				{Name: "member-2"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		pvc         *v1.PersistentVolumeClaim
+		pv          *v1.PersistentVolume
+		expectedVS  string
+		expectError bool
+	}{
+		{
+			name:       "member matched by PVC source",
+			pvc:        builder.ForPersistentVolumeClaim("ns", "pvc-1").Result(),
+			pv:         builder.ForPersistentVolume("pv-1").CSI("hostpath", "volume-1").Result(),
+			expectedVS: "member-1",
+		},
+		{
+			name:       "member matched by volume handle",
+			pvc:        builder.ForPersistentVolumeClaim("ns", "pvc-2").Result(),
+			pv:         builder.ForPersistentVolume("pv-2").CSI("hostpath", "volume-2").Result(),
+			expectedVS: "member-2",
+		},
+		{
+			name:        "PVC is not a member",
+			pvc:         builder.ForPersistentVolumeClaim("ns", "pvc-3").Result(),
+			pv:          builder.ForPersistentVolume("pv-3").CSI("hostpath", "volume-3").Result(),
+			expectError: true,
+		},
+	}
+
+	fakeClient := snapshotFake.NewSimpleClientset(objs...)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vs, err := GetVolumeSnapshotForPVCInGroup(vgs, tc.pvc, tc.pv, fakeClient.SnapshotV1())
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedVS, vs.Name)
+		})
+	}
+}
+
+func TestCleanupVolumeGroupSnapshot(t *testing.T) {
+	contentName := "vgs-content"
+	vgs := &groupsnapshotv1alpha1api.VolumeGroupSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "vgs"},
+		Status: &groupsnapshotv1alpha1api.VolumeGroupSnapshotStatus{
+			BoundVolumeGroupSnapshotContentName: &contentName,
+		},
+	}
+	vgsContent := &groupsnapshotv1alpha1api.VolumeGroupSnapshotContent{
+		ObjectMeta: metav1.ObjectMeta{Name: contentName},
+		Spec: groupsnapshotv1alpha1api.VolumeGroupSnapshotContentSpec{
+			DeletionPolicy: snapshotv1api.VolumeSnapshotContentDelete,
+		},
+	}
+	member := builder.ForVolumeSnapshot("ns", "member").ObjectMeta(builder.WithLabels(VolumeGroupSnapshotLabel, "vgs")).Result()
+
+	fakeClient := snapshotFake.NewSimpleClientset(vgs, vgsContent, member)
+
+	// the volumegroupsnapshot is kept while it has member volumesnapshots
+	CleanupVolumeGroupSnapshot("ns", "vgs", fakeClient, logrus.New())
+	_, err := fakeClient.GroupsnapshotV1alpha1().VolumeGroupSnapshots("ns").Get(context.TODO(), "vgs", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, fakeClient.SnapshotV1().VolumeSnapshots("ns").Delete(context.TODO(), "member", metav1.DeleteOptions{}))
+	CleanupVolumeGroupSnapshot("ns", "vgs", fakeClient, logrus.New())
+	_, err = fakeClient.GroupsnapshotV1alpha1().VolumeGroupSnapshots("ns").Get(context.TODO(), "vgs", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = fakeClient.GroupsnapshotV1alpha1().VolumeGroupSnapshotContents().Get(context.TODO(), contentName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	corev1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+const (
+	// VolumeSnapshotNameTemplateConfigKey is the key of the VolumeSnapshot name template in the plugin config ConfigMap.
+	VolumeSnapshotNameTemplateConfigKey = "volumeSnapshotNameTemplate"
+
+	// volumeSnapshotNameHashLength is the length of the hash in VolumeSnapshot names.
+	volumeSnapshotNameHashLength = 8
+)
+
+var invalidVolumeSnapshotNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// VolumeSnapshotNameParams are the fields available to VolumeSnapshot name templates.
+type VolumeSnapshotNameParams struct {
+	BackupName   string
+	ScheduleName string
+	PVCName      string
+	Namespace    string
+	// Hash is a short hash of the backup name and of the namespace and name of the PVC.
+	Hash string
+}
+
+// GetVolumeSnapshotNameTemplate returns the VolumeSnapshot name template of the backup annotation, else of the plugin config.
+// An empty string is returned when neither sets a template.
+func GetVolumeSnapshotNameTemplate(backup *velerov1api.Backup, config *corev1api.ConfigMap) string {
+	if tmpl, ok := backup.Annotations[VolumeSnapshotNameTemplateBackupAnnotation]; ok {
+		return tmpl
+	}
+	if config != nil {
+		return config.Data[VolumeSnapshotNameTemplateConfigKey]
+	}
+	return ""
+}
+
+// RenderVolumeSnapshotName renders the name of the VolumeSnapshot of the PVC with the template.
+// Characters invalid in a name are replaced by dashes, and names longer than a label value, which the name is
+// also recorded in, are truncated and suffixed with a hash of the full name.
+func RenderVolumeSnapshotName(tmpl string, backup *velerov1api.Backup, pvc *corev1api.PersistentVolumeClaim) (string, error) {
+	t, err := template.New("volumesnapshot-name").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing volumesnapshot name template %q", tmpl)
+	}
+
+	params := VolumeSnapshotNameParams{
+		BackupName:   backup.Name,
+		ScheduleName: backup.Labels[velerov1api.ScheduleNameLabel],
+		PVCName:      pvc.Name,
+		Namespace:    pvc.Namespace,
+		Hash:         shortHash(fmt.Sprintf("%s/%s/%s", backup.Name, pvc.Namespace, pvc.Name)),
+	}
+	sb := &strings.Builder{}
+	if err := t.Execute(sb, params); err != nil {
+		return "", errors.Wrapf(err, "error rendering volumesnapshot name template %q", tmpl)
+	}
+
+	name := strings.Trim(invalidVolumeSnapshotNameChars.ReplaceAllString(strings.ToLower(sb.String()), "-"), "-")
+	if len(name) > validation.DNS1123LabelMaxLength {
+		prefix := strings.TrimRight(name[:validation.DNS1123LabelMaxLength-volumeSnapshotNameHashLength-1], "-")
+		name = prefix + "-" + shortHash(name)
+	}
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return "", errors.Errorf("volumesnapshot name %q rendered from template %q is invalid: %s", name, tmpl, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// DefaultVolumeSnapshotName returns the name of the VolumeSnapshot of the PVC when no template is set.
+// The name is derived from the UIDs of the backup and of the PVC, so a retried item can't create a second VolumeSnapshot.
+func DefaultVolumeSnapshotName(backup *velerov1api.Backup, pvc *corev1api.PersistentVolumeClaim) string {
+	prefix := "velero-" + pvc.Name
+	if maxLength := validation.DNS1123LabelMaxLength - volumeSnapshotNameHashLength - 1; len(prefix) > maxLength {
+		prefix = strings.TrimRight(prefix[:maxLength], "-.")
+	}
+	return prefix + "-" + shortHash(fmt.Sprintf("%s/%s", backup.UID, pvc.UID))
+}
+
+func shortHash(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))[:volumeSnapshotNameHashLength]
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	velerov1api "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+func TestGetVolumeSnapshotNameTemplate(t *testing.T) {
+	config := builder.ForConfigMap("velero", "config").Data(VolumeSnapshotNameTemplateConfigKey, "{{.PVCName}}-{{.Hash}}").Result()
+
+	assert.Equal(t, "", GetVolumeSnapshotNameTemplate(builder.ForBackup("velero", "backup").Result(), nil))
+	assert.Equal(t, "{{.PVCName}}-{{.Hash}}", GetVolumeSnapshotNameTemplate(builder.ForBackup("velero", "backup").Result(), config))
+	assert.Equal(t, "{{.BackupName}}", GetVolumeSnapshotNameTemplate(builder.ForBackup("velero", "backup").
+		ObjectMeta(builder.WithAnnotations(VolumeSnapshotNameTemplateBackupAnnotation, "{{.BackupName}}")).Result(), config))
+}
+
+func TestRenderVolumeSnapshotName(t *testing.T) {
+	backup := builder.ForBackup("velero", "daily-20240101").ObjectMeta(builder.WithLabels(velerov1api.ScheduleNameLabel, "daily")).Result()
+	pvc := builder.ForPersistentVolumeClaim("db", "Data_Volume").Result()
+
+	testCases := []struct {
+		name         string
+		template     string
+		expectedName string
+		expectErr    bool
+	}{
+		{
+			name:         "all fields",
+			template:     "{{.ScheduleName}}-{{.Namespace}}-{{.PVCName}}",
+			expectedName: "daily-db-data-volume",
+		},
+		{
+			name:         "backup name and hash",
+			template:     "{{.BackupName}}-{{.Hash}}",
+			expectedName: "daily-20240101-" + shortHash("daily-20240101/db/Data_Volume"),
+		},
+		{
+			name:      "unknown field",
+			template:  "{{.PVC}}",
+			expectErr: true,
+		},
+		{
+			name:      "invalid template",
+			template:  "{{.PVCName",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, err := RenderVolumeSnapshotName(tc.template, backup, pvc)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedName, name)
+		})
+	}
+
+	// a backup not created by a schedule renders an empty name
+	_, err := RenderVolumeSnapshotName("{{.ScheduleName}}", builder.ForBackup("velero", "manual").Result(), pvc)
+	assert.Error(t, err)
+
+	long := strings.Repeat("a", 70)
+	name, err := RenderVolumeSnapshotName("{{.PVCName}}", backup, builder.ForPersistentVolumeClaim("db", long).Result())
+	require.NoError(t, err)
+	assert.Len(t, name, 63)
+	assert.Equal(t, strings.Repeat("a", 54)+"-"+shortHash(long), name)
+}
+
+func TestDefaultVolumeSnapshotName(t *testing.T) {
+	backup := builder.ForBackup("velero", "backup").ObjectMeta(builder.WithUID("backup-uid")).Result()
+	pvc := builder.ForPersistentVolumeClaim("db", "data").ObjectMeta(builder.WithUID("pvc-uid")).Result()
+
+	name := DefaultVolumeSnapshotName(backup, pvc)
+	assert.Equal(t, "velero-data-"+shortHash("backup-uid/pvc-uid"), name)
+	// the same backup and PVC always get the same name
+	assert.Equal(t, name, DefaultVolumeSnapshotName(backup, pvc))
+
+	other := builder.ForBackup("velero", "backup").ObjectMeta(builder.WithUID("other-uid")).Result()
+	assert.NotEqual(t, name, DefaultVolumeSnapshotName(other, pvc))
+
+	long := strings.Repeat("a", 70)
+	name = DefaultVolumeSnapshotName(backup, builder.ForPersistentVolumeClaim("db", long).ObjectMeta(builder.WithUID("pvc-uid")).Result())
+	assert.Len(t, name, 63)
+	assert.Equal(t, "velero-"+strings.Repeat("a", 47)+"-"+shortHash("backup-uid/pvc-uid"), name)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// VolumeSnapshotClassPolicyConfigKey is the key of the VolumeSnapshotClass policy in the plugin config ConfigMap.
+	VolumeSnapshotClassPolicyConfigKey = "volumeSnapshotClassPolicy"
+)
+
+// VolumeSnapshotClassPolicy is an ordered list of rules choosing the VolumeSnapshotClass of PVCs.
+// The first rule matching a PVC wins.
+type VolumeSnapshotClassPolicy struct {
+	Rules []VolumeSnapshotClassRule `json:"rules"`
+}
+
+// VolumeSnapshotClassRule matches PVCs to a VolumeSnapshotClass. A PVC matches the rule when it
+// matches every criterion set, a criterion not set matches every PVC.
+type VolumeSnapshotClassRule struct {
+	Name                string                `json:"name,omitempty"`
+	Namespaces          []string              `json:"namespaces,omitempty"`
+	NamespaceSelector   *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	PVCSelector         *metav1.LabelSelector `json:"pvcSelector,omitempty"`
+	StorageClasses      []string              `json:"storageClasses,omitempty"`
+	Drivers             []string              `json:"drivers,omitempty"`
+	VolumeSnapshotClass string                `json:"volumeSnapshotClass"`
+}
+
+// ParseVolumeSnapshotClassPolicy parses the VolumeSnapshotClass policy of the plugin config ConfigMap.
+// nil is returned if the ConfigMap has no policy.
+func ParseVolumeSnapshotClassPolicy(config *corev1api.ConfigMap) (*VolumeSnapshotClassPolicy, error) {
+	if config == nil {
+		return nil, nil
+	}
+	data, ok := config.Data[VolumeSnapshotClassPolicyConfigKey]
+	if !ok {
+		return nil, nil
+	}
+
+	policy := &VolumeSnapshotClassPolicy{}
+	if err := yaml.UnmarshalStrict([]byte(data), policy); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s of ConfigMap %s/%s", VolumeSnapshotClassPolicyConfigKey, config.Namespace, config.Name)
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		if rule.VolumeSnapshotClass == "" {
+			return nil, errors.Errorf("rule %s of ConfigMap %s/%s has no volumeSnapshotClass", rule.Name, config.Namespace, config.Name)
+		}
+	}
+	return policy, nil
+}
+
+// Match returns the first rule matching the PVC, or nil if no rule matches. The evaluation of each rule is logged.
+func (p *VolumeSnapshotClassPolicy) Match(pvc *corev1api.PersistentVolumeClaim, namespace *corev1api.Namespace,
+	storageClassName, driver string, log logrus.FieldLogger) (*VolumeSnapshotClassRule, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		reason, err := rule.mismatch(pvc, namespace, storageClassName, driver)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error evaluating volumesnapshotclass policy rule %s", rule.Name)
+		}
+		if reason != "" {
+			log.Debugf("Volumesnapshotclass policy rule %s doesn't match PVC %s/%s: %s", rule.Name, pvc.Namespace, pvc.Name, reason)
+			continue
+		}
+		log.Infof("Volumesnapshotclass policy rule %s matches PVC %s/%s, volumesnapshotclass=%s", rule.Name, pvc.Namespace, pvc.Name, rule.VolumeSnapshotClass)
+		return rule, nil
+	}
+
+	log.Debugf("No volumesnapshotclass policy rule matches PVC %s/%s", pvc.Namespace, pvc.Name)
+	return nil, nil
+}
+
+// mismatch returns why the PVC doesn't match the rule, or an empty string if it does.
+func (r *VolumeSnapshotClassRule) mismatch(pvc *corev1api.PersistentVolumeClaim, namespace *corev1api.Namespace,
+	storageClassName, driver string) (string, error) {
+	if len(r.Namespaces) > 0 && !Contains(r.Namespaces, pvc.Namespace) {
+		return fmt.Sprintf("namespace %s is not in %v", pvc.Namespace, r.Namespaces), nil
+	}
+	if r.NamespaceSelector != nil {
+		var nsLabels map[string]string
+		if namespace != nil {
+			nsLabels = namespace.Labels
+		}
+		selector, err := metav1.LabelSelectorAsSelector(r.NamespaceSelector)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if !selector.Matches(labels.Set(nsLabels)) {
+			return fmt.Sprintf("namespace labels don't match %s", selector), nil
+		}
+	}
+	if r.PVCSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(r.PVCSelector)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if !selector.Matches(labels.Set(pvc.Labels)) {
+			return fmt.Sprintf("PVC labels don't match %s", selector), nil
+		}
+	}
+	if len(r.StorageClasses) > 0 && !Contains(r.StorageClasses, storageClassName) {
+		return fmt.Sprintf("storage class %q is not in %v", storageClassName, r.StorageClasses), nil
+	}
+	if len(r.Drivers) > 0 && !Contains(r.Drivers, driver) {
+		return fmt.Sprintf("driver %s is not in %v", driver, r.Drivers), nil
+	}
+	return "", nil
+}
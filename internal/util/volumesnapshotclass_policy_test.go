@@ -0,0 +1,136 @@
+/*
+Copyright 2024 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/vmware-tanzu/velero/pkg/builder"
+)
+
+const testPolicy = `
+rules:
+- name: gold-tier
+  namespaceSelector:
+    matchLabels:
+      tier: gold
+  volumeSnapshotClass: gold
+- name: databases
+  namespaces: [db]
+  pvcSelector:
+    matchExpressions:
+    - {key: app, operator: In, values: [postgres, mysql]}
+  volumeSnapshotClass: db
+- storageClasses: [local]
+  drivers: [local.csi.k8s.io]
+  volumeSnapshotClass: local
+`
+
+func TestParseVolumeSnapshotClassPolicy(t *testing.T) {
+	policy, err := ParseVolumeSnapshotClassPolicy(nil)
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = ParseVolumeSnapshotClassPolicy(builder.ForConfigMap("velero", "config").Result())
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = ParseVolumeSnapshotClassPolicy(builder.ForConfigMap("velero", "config").Data(VolumeSnapshotClassPolicyConfigKey, testPolicy).Result())
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 3)
+	assert.Equal(t, "databases", policy.Rules[1].Name)
+	assert.Equal(t, "rule-2", policy.Rules[2].Name)
+
+	_, err = ParseVolumeSnapshotClassPolicy(builder.ForConfigMap("velero", "config").Data(VolumeSnapshotClassPolicyConfigKey, "rules:\n- namespaces: [db]").Result())
+	assert.Error(t, err)
+
+	_, err = ParseVolumeSnapshotClassPolicy(builder.ForConfigMap("velero", "config").Data(VolumeSnapshotClassPolicyConfigKey, "rules:\n- unknown: field").Result())
+	assert.Error(t, err)
+}
+
+func TestVolumeSnapshotClassPolicyMatch(t *testing.T) {
+	policy, err := ParseVolumeSnapshotClassPolicy(builder.ForConfigMap("velero", "config").Data(VolumeSnapshotClassPolicyConfigKey, testPolicy).Result())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name             string
+		pvc              *v1.PersistentVolumeClaim
+		namespace        *v1.Namespace
+		storageClassName string
+		driver           string
+		expectedRule     string
+	}{
+		{
+			name:         "namespace labels match the first rule",
+			pvc:          builder.ForPersistentVolumeClaim("db", "pvc").ObjectMeta(builder.WithLabels("app", "postgres")).Result(),
+			namespace:    builder.ForNamespace("db").ObjectMeta(builder.WithLabels("tier", "gold")).Result(),
+			driver:       "foo.csi.k8s.io",
+			expectedRule: "gold-tier",
+		},
+		{
+			name:         "namespace and PVC labels match the second rule",
+			pvc:          builder.ForPersistentVolumeClaim("db", "pvc").ObjectMeta(builder.WithLabels("app", "postgres")).Result(),
+			namespace:    builder.ForNamespace("db").Result(),
+			driver:       "foo.csi.k8s.io",
+			expectedRule: "databases",
+		},
+		{
+			name:      "PVC labels don't match",
+			pvc:       builder.ForPersistentVolumeClaim("db", "pvc").ObjectMeta(builder.WithLabels("app", "redis")).Result(),
+			namespace: builder.ForNamespace("db").Result(),
+			driver:    "foo.csi.k8s.io",
+		},
+		{
+			name:             "storage class and driver match the last rule",
+			pvc:              builder.ForPersistentVolumeClaim("ns", "pvc").Result(),
+			namespace:        builder.ForNamespace("ns").Result(),
+			storageClassName: "local",
+			driver:           "local.csi.k8s.io",
+			expectedRule:     "rule-2",
+		},
+		{
+			name:             "storage class matches but driver doesn't",
+			pvc:              builder.ForPersistentVolumeClaim("ns", "pvc").Result(),
+			namespace:        builder.ForNamespace("ns").Result(),
+			storageClassName: "local",
+			driver:           "foo.csi.k8s.io",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := policy.Match(tc.pvc, tc.namespace, tc.storageClassName, tc.driver, logrus.New())
+			require.NoError(t, err)
+			if tc.expectedRule == "" {
+				assert.Nil(t, rule)
+				return
+			}
+			require.NotNil(t, rule)
+			assert.Equal(t, tc.expectedRule, rule.Name)
+		})
+	}
+
+	var noPolicy *VolumeSnapshotClassPolicy
+	rule, err := noPolicy.Match(builder.ForPersistentVolumeClaim("ns", "pvc").Result(), nil, "", "foo.csi.k8s.io", logrus.New())
+	require.NoError(t, err)
+	assert.Nil(t, rule)
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"sync"
+
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -25,6 +27,7 @@ import (
 	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/restore"
 	"github.com/vmware-tanzu/velero-plugin-for-csi/internal/util"
 	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/framework"
+	"github.com/vmware-tanzu/velero/pkg/podexec"
 )
 
 func main() {
@@ -43,22 +46,58 @@ func main() {
 		Serve()
 }
 
+var (
+	clientsLock sync.Mutex
+	clients     *util.Clients
+)
+
+// getClients returns the clients shared by all the actions of the plugin, built on first use.
+// A failure to build them is not kept, the next action builds them again.
+func getClients() (*util.Clients, error) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	if clients != nil {
+		return clients, nil
+	}
+
+	options, err := util.ClientOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	newClients, err := util.NewClients(options)
+	if err != nil {
+		return nil, err
+	}
+	clients = newClients
+	return clients, nil
+}
+
 func newPVCBackupItemAction(logger logrus.FieldLogger) (interface{}, error) {
-	client, snapshotClient, crClient, err := util.GetFullClients()
+	clients, err := getClients()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	return &backup.PVCBackupItemAction{
-		Log:            logger,
-		Client:         client,
-		SnapshotClient: snapshotClient,
-		CRClient:       crClient,
+		Log:                logger,
+		Client:             clients.Client,
+		SnapshotClient:     clients.SnapshotClient,
+		CRClient:           clients.CRClient,
+		PodCommandExecutor: podexec.NewPodCommandExecutor(clients.Config, clients.Client.CoreV1().RESTClient()),
 	}, nil
 }
 
 func newVolumeSnapshotBackupItemAction(logger logrus.FieldLogger) (interface{}, error) {
-	return &backup.VolumeSnapshotBackupItemAction{Log: logger}, nil
+	clients, err := getClients()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &backup.VolumeSnapshotBackupItemAction{
+		Log:            logger,
+		Client:         clients.Client,
+		SnapshotClient: clients.SnapshotClient,
+	}, nil
 }
 
 func newVolumesnapshotClassBackupItemAction(logger logrus.FieldLogger) (interface{}, error) {
@@ -70,16 +109,16 @@ func newVolumeSnapContentBackupItemAction(logger logrus.FieldLogger) (interface{
 }
 
 func newPVCRestoreItemAction(logger logrus.FieldLogger) (interface{}, error) {
-	client, snapshotClient, crClient, err := util.GetFullClients()
+	clients, err := getClients()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	return &restore.PVCRestoreItemAction{
 		Log:            logger,
-		Client:         client,
-		SnapshotClient: snapshotClient,
-		CRClient:       crClient,
+		Client:         clients.Client,
+		SnapshotClient: clients.SnapshotClient,
+		CRClient:       clients.CRClient,
 	}, nil
 }
 
@@ -88,17 +127,51 @@ func newVolumeSnapshotContentRestoreItemAction(logger logrus.FieldLogger) (inter
 }
 
 func newVolumeSnapshotRestoreItemAction(logger logrus.FieldLogger) (interface{}, error) {
-	return &restore.VolumeSnapshotRestoreItemAction{Log: logger}, nil
+	clients, err := getClients()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &restore.VolumeSnapshotRestoreItemAction{
+		Log:            logger,
+		Client:         clients.Client,
+		SnapshotClient: clients.SnapshotClient,
+	}, nil
 }
 
 func newVolumeSnapshotClassRestoreItemAction(logger logrus.FieldLogger) (interface{}, error) {
-	return &restore.VolumeSnapshotClassRestoreItemAction{Log: logger}, nil
+	clients, err := getClients()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &restore.VolumeSnapshotClassRestoreItemAction{
+		Log:            logger,
+		Client:         clients.Client,
+		SnapshotClient: clients.SnapshotClient,
+	}, nil
 }
 
 func newVolumeSnapshotDeleteItemAction(logger logrus.FieldLogger) (interface{}, error) {
-	return &delete.VolumeSnapshotDeleteItemAction{Log: logger}, nil
+	clients, err := getClients()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &delete.VolumeSnapshotDeleteItemAction{
+		Log:            logger,
+		SnapshotClient: clients.SnapshotClient,
+	}, nil
 }
 
 func newVolumeSnapshotContentDeleteItemAction(logger logrus.FieldLogger) (interface{}, error) {
-	return &delete.VolumeSnapshotContentDeleteItemAction{Log: logger}, nil
+	clients, err := getClients()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &delete.VolumeSnapshotContentDeleteItemAction{
+		Log:            logger,
+		SnapshotClient: clients.SnapshotClient,
+	}, nil
 }